@@ -1,11 +1,27 @@
 package main
 
+import (
+	"github.com/libretro/netplay-lobby-server-go/domain"
+)
+
 // Config is the struct that holds the lobby server configuration
 type Config struct {
-	Server    ServerConfig
-	Database  DatabaseConfig
-	Relay     map[string]string
-	Blacklist BlacklistConfig
+	Server     ServerConfig
+	Lobby      domain.LobbyConfig
+	Database   DatabaseConfig
+	Relay      map[string]string // Legacy relay configuration of handles to "host:port" pairs
+	Relays     []domain.RelayConfig
+	Blacklist  BlacklistConfig
+	Admin      AdminConfig
+	Games      GamesConfig
+	Cores      CoresConfig
+	Federation FederationConfig
+	Webhooks   []domain.WebhookConfig
+}
+
+// RelayConfigs returns the relays of the legacy and the structured relay configuration.
+func (c *Config) RelayConfigs() []domain.RelayConfig {
+	return append(domain.ParseLegacyRelays(c.Relay), c.Relays...)
 }
 
 // ServerConfig holds the basic server config.
@@ -24,5 +40,27 @@ type DatabaseConfig struct {
 // BlacklistConfig configures the different blacklists.
 type BlacklistConfig struct {
 	Strings []string // General blacklisted words as RE
-	IPs     []string
+	IPs     []string // Single IPs or CIDR ranges
+}
+
+// GamesConfig configures the game identification.
+type GamesConfig struct {
+	DatPath     string              // Directory of libretro-database DAT files, an empty path disables the identification
+	CoreSystems map[string][]string // Core names to the DAT system names they emulate
+}
+
+// CoresConfig configures the core metadata.
+type CoresConfig struct {
+	InfoPath string // Directory of libretro core .info files, an empty path disables the core metadata
+}
+
+// FederationConfig configures the mirroring of rooms between lobby instances.
+type FederationConfig struct {
+	Token string              // Bearer token peers need to pull the local rooms. An empty token disables the endpoint.
+	Peers []domain.PeerConfig // Lobbies whose rooms are mirrored
+}
+
+// AdminConfig configures the moderation API.
+type AdminConfig struct {
+	Token string // Bearer token for the /admin routes. An empty token disables the routes.
 }
@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/libretro/netplay-lobby-server-go/domain"
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// AdminDomain interface to decouple the controller logic from the domain code.
+type AdminDomain interface {
+	ListSessions() ([]entity.Session, error)
+	DeleteSession(roomID int32) error
+	BanSession(roomID int32, reason string, username bool) ([]entity.Ban, error)
+	ListBans() []entity.Ban
+	Ban(banType entity.BanType, pattern string, reason string) (*entity.Ban, error)
+	Unban(id uint) error
+}
+
+// AdminSessionResponse is a session DTO that includes the fields hidden from the public listing.
+type AdminSessionResponse struct {
+	ID          string `json:"session_id"`
+	ContentHash string `json:"content_hash"`
+	MitmHandle  string `json:"mitm_handle"`
+	entity.Session
+}
+
+// BanRequest defines the request for a new ban.
+type BanRequest struct {
+	Type    entity.BanType `json:"type" form:"type"`
+	Pattern string         `json:"pattern" form:"pattern"`
+	Reason  string         `json:"reason" form:"reason"`
+}
+
+// BanSessionRequest defines the request for banning the host of a session.
+type BanSessionRequest struct {
+	Reason   string `json:"reason" form:"reason"`
+	Username bool   `json:"username" form:"username"` // Whether the username is banned along with the IP
+}
+
+// AdminController handles all moderation related requests
+type AdminController struct {
+	adminDomain AdminDomain
+	token       string
+}
+
+// NewAdminController returns a new admin controller. All requests need to present the token as bearer token.
+func NewAdminController(adminDomain AdminDomain, token string) *AdminController {
+	return &AdminController{adminDomain, token}
+}
+
+// RegisterRoutes registers all controller routes at an echo framework instance.
+func (c *AdminController) RegisterRoutes(server *echo.Echo) {
+	admin := server.Group("/admin", middleware.KeyAuth(c.authenticate))
+	admin.GET("/sessions", c.ListSessions)
+	admin.DELETE("/sessions/:roomID", c.DeleteSession)
+	admin.POST("/sessions/:roomID/ban", c.BanSession)
+	admin.GET("/bans", c.ListBans)
+	admin.POST("/bans", c.AddBan)
+	admin.DELETE("/bans/:banID", c.DeleteBan)
+}
+
+func (c *AdminController) authenticate(key string, ctx echo.Context) (bool, error) {
+	if c.token == "" {
+		return false, nil
+	}
+	return subtle.ConstantTimeCompare([]byte(key), []byte(c.token)) == 1, nil
+}
+
+// ListSessions handler
+// GET /admin/sessions
+func (c *AdminController) ListSessions(ctx echo.Context) error {
+	logger := ctx.Logger()
+
+	sessions, err := c.adminDomain.ListSessions()
+	if err != nil {
+		logger.Errorf("Can't list sessions: %v", err)
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+
+	response := make([]AdminSessionResponse, len(sessions))
+	for i, session := range sessions {
+		response[i] = AdminSessionResponse{session.ID, session.ContentHash, session.MitmHandle, session}
+	}
+
+	return ctx.JSONPretty(http.StatusOK, response, "  ")
+}
+
+// DeleteSession handler
+// DELETE /admin/sessions/:roomID
+func (c *AdminController) DeleteSession(ctx echo.Context) error {
+	logger := ctx.Logger()
+
+	roomID, err := strconv.ParseInt(ctx.Param("roomID"), 10, 32)
+	if err != nil {
+		return ctx.NoContent(http.StatusBadRequest)
+	}
+
+	if err = c.adminDomain.DeleteSession(int32(roomID)); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return ctx.NoContent(http.StatusNotFound)
+		}
+		logger.Errorf("Can't delete session: %v", err)
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+
+	logger.Warnf("Deleted session with RoomID %d", roomID)
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// BanSession handler
+// POST /admin/sessions/:roomID/ban
+func (c *AdminController) BanSession(ctx echo.Context) error {
+	logger := ctx.Logger()
+
+	roomID, err := strconv.ParseInt(ctx.Param("roomID"), 10, 32)
+	if err != nil {
+		return ctx.NoContent(http.StatusBadRequest)
+	}
+
+	var req BanSessionRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.NoContent(http.StatusBadRequest)
+	}
+
+	bans, err := c.adminDomain.BanSession(int32(roomID), req.Reason, req.Username)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return ctx.NoContent(http.StatusNotFound)
+		} else if errors.Is(err, domain.ErrInvalidBan) {
+			return ctx.NoContent(http.StatusBadRequest)
+		}
+		logger.Errorf("Can't ban session: %v", err)
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+
+	for _, ban := range bans {
+		logger.Warnf("Banned session with RoomID %d: %s", roomID, ban.Pattern)
+	}
+	return ctx.JSONPretty(http.StatusCreated, bans, "  ")
+}
+
+// ListBans handler
+// GET /admin/bans
+func (c *AdminController) ListBans(ctx echo.Context) error {
+	return ctx.JSONPretty(http.StatusOK, c.adminDomain.ListBans(), "  ")
+}
+
+// AddBan handler
+// POST /admin/bans
+func (c *AdminController) AddBan(ctx echo.Context) error {
+	logger := ctx.Logger()
+
+	var req BanRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.NoContent(http.StatusBadRequest)
+	}
+
+	ban, err := c.adminDomain.Ban(req.Type, req.Pattern, req.Reason)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidBan) {
+			return ctx.NoContent(http.StatusBadRequest)
+		}
+		logger.Errorf("Can't add ban: %v", err)
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+
+	logger.Warnf("Added %s ban: %s", ban.Type, ban.Pattern)
+	return ctx.JSONPretty(http.StatusCreated, ban, "  ")
+}
+
+// DeleteBan handler
+// DELETE /admin/bans/:banID
+func (c *AdminController) DeleteBan(ctx echo.Context) error {
+	logger := ctx.Logger()
+
+	banID, err := strconv.ParseUint(ctx.Param("banID"), 10, 32)
+	if err != nil {
+		return ctx.NoContent(http.StatusBadRequest)
+	}
+
+	if err = c.adminDomain.Unban(uint(banID)); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return ctx.NoContent(http.StatusNotFound)
+		}
+		logger.Errorf("Can't delete ban: %v", err)
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/libretro/netplay-lobby-server-go/domain"
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+const testAdminToken = "secret"
+
+type AdminDomainMock struct {
+	mock.Mock
+}
+
+func (m *AdminDomainMock) ListSessions() ([]entity.Session, error) {
+	args := m.Called()
+	sessions, _ := args.Get(0).([]entity.Session)
+	return sessions, args.Error(1)
+}
+
+func (m *AdminDomainMock) DeleteSession(roomID int32) error {
+	args := m.Called(roomID)
+	return args.Error(0)
+}
+
+func (m *AdminDomainMock) BanSession(roomID int32, reason string, username bool) ([]entity.Ban, error) {
+	args := m.Called(roomID, reason, username)
+	bans, _ := args.Get(0).([]entity.Ban)
+	return bans, args.Error(1)
+}
+
+func (m *AdminDomainMock) ListBans() []entity.Ban {
+	args := m.Called()
+	bans, _ := args.Get(0).([]entity.Ban)
+	return bans
+}
+
+func (m *AdminDomainMock) Ban(banType entity.BanType, pattern string, reason string) (*entity.Ban, error) {
+	args := m.Called(banType, pattern, reason)
+	ban, _ := args.Get(0).(*entity.Ban)
+	return ban, args.Error(1)
+}
+
+func (m *AdminDomainMock) Unban(id uint) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func setupAdminController() (*echo.Echo, *AdminDomainMock) {
+	domainMock := &AdminDomainMock{}
+	server := echo.New()
+	NewAdminController(domainMock, testAdminToken).RegisterRoutes(server)
+	return server, domainMock
+}
+
+func adminRequest(server *echo.Echo, method string, path string, body string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminControllerUnauthorized(t *testing.T) {
+	server, domainMock := setupAdminController()
+
+	rec := adminRequest(server, http.MethodGet, "/admin/sessions", "", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = adminRequest(server, http.MethodGet, "/admin/sessions", "", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	domainMock.AssertNotCalled(t, "ListSessions")
+}
+
+func TestAdminControllerListSessions(t *testing.T) {
+	server, domainMock := setupAdminController()
+
+	session := testSession
+	session.ID = "abcdef"
+	session.ContentHash = "123456"
+	session.MitmHandle = "nyc"
+	domainMock.On("ListSessions").Return([]entity.Session{session}, nil)
+
+	rec := adminRequest(server, http.MethodGet, "/admin/sessions", "", testAdminToken)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"session_id": "abcdef"`)
+	assert.Contains(t, rec.Body.String(), `"content_hash": "123456"`)
+	assert.Contains(t, rec.Body.String(), `"mitm_handle": "nyc"`)
+	assert.Contains(t, rec.Body.String(), `"username": "zelda"`)
+}
+
+func TestAdminControllerDeleteSession(t *testing.T) {
+	server, domainMock := setupAdminController()
+
+	domainMock.On("DeleteSession", int32(100)).Return(nil)
+	domainMock.On("DeleteSession", int32(101)).Return(domain.ErrNotFound)
+
+	rec := adminRequest(server, http.MethodDelete, "/admin/sessions/100", "", testAdminToken)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = adminRequest(server, http.MethodDelete, "/admin/sessions/101", "", testAdminToken)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAdminControllerAddBan(t *testing.T) {
+	server, domainMock := setupAdminController()
+
+	domainMock.On("Ban", entity.BanTypeIP, "10.0.0.0/8", "griefing").
+		Return(&entity.Ban{ID: 1, Type: entity.BanTypeIP, Pattern: "10.0.0.0/8", Reason: "griefing"}, nil)
+	domainMock.On("Ban", entity.BanTypeString, "(", "").
+		Return(nil, domain.ErrInvalidBan)
+
+	rec := adminRequest(server, http.MethodPost, "/admin/bans",
+		`{"type":"ip","pattern":"10.0.0.0/8","reason":"griefing"}`, testAdminToken)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"pattern": "10.0.0.0/8"`)
+
+	rec = adminRequest(server, http.MethodPost, "/admin/bans", `{"type":"string","pattern":"("}`, testAdminToken)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAdminControllerBanSession(t *testing.T) {
+	server, domainMock := setupAdminController()
+
+	domainMock.On("BanSession", int32(100), "griefing", true).Return([]entity.Ban{
+		{Type: entity.BanTypeIP, Pattern: "88.12.123.77"},
+		{Type: entity.BanTypeString, Pattern: "^zelda$"},
+	}, nil)
+	domainMock.On("BanSession", int32(101), "", true).Return(nil, domain.ErrInvalidBan)
+	domainMock.On("BanSession", int32(102), "", false).Return(nil, domain.ErrNotFound)
+
+	rec := adminRequest(server, http.MethodPost, "/admin/sessions/100/ban", `{"reason":"griefing","username":true}`, testAdminToken)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"pattern": "88.12.123.77"`)
+	assert.Contains(t, rec.Body.String(), `"pattern": "^zelda$"`)
+
+	rec = adminRequest(server, http.MethodPost, "/admin/sessions/101/ban", `{"username":true}`, testAdminToken)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = adminRequest(server, http.MethodPost, "/admin/sessions/102/ban", `{}`, testAdminToken)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/libretro/netplay-lobby-server-go/domain"
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// APIv2Prefix is the path prefix of the versioned JSON API.
+const APIv2Prefix = "/api/v2"
+
+// Error codes of the versioned JSON API.
+const (
+	ErrorCodeInvalidRequest = "invalid_request"
+	ErrorCodeNotFound       = "not_found"
+	ErrorCodeInternal       = "internal_error"
+)
+
+// SessionV2 is the API v2 presentation of a session. The host IP is never exposed.
+type SessionV2 struct {
+	RoomID              int32     `json:"room_id"`
+	Username            string    `json:"username"`
+	Country             string    `json:"country"`
+	GameName            string    `json:"game_name"`
+	GameCRC             string    `json:"game_crc"`
+	Game                *GameV2   `json:"game,omitempty"` // Only set if a game database is loaded
+	CoreName            string    `json:"core_name"`
+	CoreVersion         string    `json:"core_version"`
+	Core                *CoreV2   `json:"core,omitempty"` // Only set if the .info file of the core is known
+	SubsystemName       string    `json:"subsystem_name"`
+	RetroArchVersion    string    `json:"retroarch_version"`
+	Frontend            string    `json:"frontend"`
+	HostMethod          string    `json:"host_method"` // unknown, manual, upnp or mitm
+	Relay               *RelayV2  `json:"relay,omitempty"`
+	JoinTicket          string    `json:"join_ticket,omitempty"` // Resolves the host address with GET /join
+	Origin              string    `json:"origin,omitempty"`      // Peer lobby the room is mirrored from
+	HasPassword         bool      `json:"has_password"`
+	HasSpectatePassword bool      `json:"has_spectate_password"`
+	Connectable         bool      `json:"connectable"`
+	IsRetroArch         bool      `json:"is_retroarch"`
+	PlayerCount         int16     `json:"player_count"`
+	SpectatorCount      int16     `json:"spectator_count"`
+	CreatedAt           time.Time `json:"created_at"` // RFC 3339
+	UpdatedAt           time.Time `json:"updated_at"` // RFC 3339
+}
+
+// RelayV2 is the API v2 presentation of the relay server a session is hosted on.
+type RelayV2 struct {
+	Address string `json:"address"`
+	Port    uint16 `json:"port"`
+	Session string `json:"session"`
+}
+
+// GameV2 is the API v2 presentation of the game identification.
+type GameV2 struct {
+	Status string `json:"status"` // verified, unknown or mismatch
+	Title  string `json:"title,omitempty"`
+	System string `json:"system,omitempty"`
+	Region string `json:"region,omitempty"`
+}
+
+// CoreV2 is the API v2 presentation of the core metadata.
+type CoreV2 struct {
+	DisplayName   string   `json:"display_name"`
+	SystemName    string   `json:"system_name,omitempty"`
+	Databases     []string `json:"databases,omitempty"`
+	Savestates    string   `json:"savestates"` // none, basic, serialized or deterministic
+	Deterministic bool     `json:"deterministic"`
+	Netplay       bool     `json:"netplay"`
+}
+
+// SessionListV2 is the API v2 response of a session list.
+type SessionListV2 struct {
+	Sessions []SessionV2 `json:"sessions"`
+	Total    int         `json:"total"` // Amount of matching sessions, ignoring limit and offset
+}
+
+// ErrorV2 is the API v2 error response.
+type ErrorV2 struct {
+	Error ErrorDetailV2 `json:"error"`
+}
+
+// ErrorDetailV2 describes an API v2 error with a machine readable code.
+type ErrorDetailV2 struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewSessionV2 converts a session into its API v2 presentation.
+func NewSessionV2(s *entity.Session) SessionV2 {
+	session := SessionV2{
+		RoomID:              s.RoomID,
+		Username:            s.Username,
+		Country:             s.Country,
+		GameName:            s.GameName,
+		GameCRC:             s.GameCRC,
+		CoreName:            s.CoreName,
+		CoreVersion:         s.CoreVersion,
+		SubsystemName:       s.SubsystemName,
+		RetroArchVersion:    s.RetroArchVersion,
+		Frontend:            s.Frontend,
+		HostMethod:          s.HostMethod.String(),
+		JoinTicket:          s.JoinTicket,
+		Origin:              s.Origin,
+		HasPassword:         s.HasPassword,
+		HasSpectatePassword: s.HasSpectatePassword,
+		Connectable:         s.Connectable,
+		IsRetroArch:         s.IsRetroArch,
+		PlayerCount:         s.PlayerCount,
+		SpectatorCount:      s.SpectatorCount,
+		CreatedAt:           s.CreatedAt.UTC(),
+		UpdatedAt:           s.UpdatedAt.UTC(),
+	}
+
+	if c := s.Core; c != nil {
+		session.Core = &CoreV2{c.DisplayName, c.SystemName, c.Databases, c.Savestates, c.Deterministic, c.Netplay}
+	}
+
+	if s.GameStatus != "" {
+		session.Game = &GameV2{s.GameStatus, s.GameTitle, s.GameSystem, s.GameRegion}
+	}
+
+	if s.HostMethod == entity.HostMethodMITM {
+		session.Relay = &RelayV2{s.MitmAddress, s.MitmPort, s.MitmSession}
+	}
+
+	return session
+}
+
+// APIv2Controller serves the versioned JSON API.
+type APIv2Controller struct {
+	sessionDomain SessionDomain
+}
+
+// NewAPIv2Controller returns a new API v2 controller.
+func NewAPIv2Controller(sessionDomain SessionDomain) *APIv2Controller {
+	return &APIv2Controller{sessionDomain}
+}
+
+// RegisterRoutes registers all controller routes at an echo framework instance.
+func (c *APIv2Controller) RegisterRoutes(server *echo.Echo) {
+	group := server.Group(APIv2Prefix)
+	group.GET("/sessions", c.List)
+	group.GET("/sessions/:roomID", c.Get)
+}
+
+// List handler
+// GET /api/v2/sessions
+// Accepts the same filter, sort and pagination query parameters as the legacy list.
+func (c *APIv2Controller) List(ctx echo.Context) error {
+	logger := ctx.Logger()
+
+	var req domain.ListSessionsRequest
+	if err := ctx.Bind(&req); err != nil {
+		return errorV2(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, "Can't parse the query parameters")
+	}
+
+	sessions, count, err := c.sessionDomain.Search(&req)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidFilter) {
+			return errorV2(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, err.Error())
+		}
+		logger.Errorf("Can't render session list: %v", err)
+		return errorV2(ctx, http.StatusInternalServerError, ErrorCodeInternal, "Can't get the sessions")
+	}
+
+	response := SessionListV2{make([]SessionV2, len(sessions)), count}
+	for i := range sessions {
+		response.Sessions[i] = NewSessionV2(&sessions[i])
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+// Get handler
+// GET /api/v2/sessions/:roomID
+func (c *APIv2Controller) Get(ctx echo.Context) error {
+	logger := ctx.Logger()
+
+	roomID, err := strconv.ParseInt(ctx.Param("roomID"), 10, 32)
+	if err != nil {
+		return errorV2(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, "The room ID isn't a valid number")
+	}
+
+	session, err := c.sessionDomain.Get(int32(roomID))
+	if err != nil {
+		logger.Errorf("Can't get session: %v", err)
+		return errorV2(ctx, http.StatusInternalServerError, ErrorCodeInternal, "Can't get the session")
+	}
+	if session == nil {
+		return errorV2(ctx, http.StatusNotFound, ErrorCodeNotFound, "The room doesn't exist")
+	}
+
+	return ctx.JSON(http.StatusOK, NewSessionV2(session))
+}
+
+// errorV2 sends an API v2 error response.
+func errorV2(ctx echo.Context, status int, code string, message string) error {
+	return ctx.JSON(status, ErrorV2{ErrorDetailV2{code, message}})
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/libretro/netplay-lobby-server-go/domain"
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+func TestAPIv2ControllerGet(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+
+	server := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/sessions/100", nil)
+	rec := httptest.NewRecorder()
+	NewAPIv2Controller(domainMock).RegisterRoutes(server)
+
+	session := testSession
+	session.RoomID = 100
+	session.PlayerCount = 2
+	expectedResultBody := `{"room_id":100,"username":"zelda","country":"en","game_name":"supergame",` +
+		`"game_crc":"FFFFFFFF","core_name":"unes","core_version":"0.2.1","subsystem_name":"subsub",` +
+		`"retroarch_version":"1.1.1","frontend":"retro","host_method":"upnp","has_password":false,` +
+		`"has_spectate_password":false,"connectable":true,"is_retroarch":true,"player_count":2,` +
+		`"spectator_count":0,"created_at":"2010-09-12T11:33:05Z","updated_at":"2010-09-12T11:33:05Z"}` + "\n"
+	domainMock.On("Get", int32(100)).Return(&session, nil)
+
+	server.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, expectedResultBody, rec.Body.String())
+}
+
+func TestAPIv2ControllerGetRelay(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+
+	server := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/sessions/100", nil)
+	rec := httptest.NewRecorder()
+	NewAPIv2Controller(domainMock).RegisterRoutes(server)
+
+	session := testSession
+	session.HostMethod = entity.HostMethodMITM
+	session.MitmAddress = "relay.example.com"
+	session.MitmPort = 55356
+	session.MitmSession = "abcdef"
+	domainMock.On("Get", int32(100)).Return(&session, nil)
+
+	server.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"host_method":"mitm"`)
+	assert.Contains(t, rec.Body.String(), `"relay":{"address":"relay.example.com","port":55356,"session":"abcdef"}`)
+	assert.NotContains(t, rec.Body.String(), "127.0.0.1")
+}
+
+func TestAPIv2ControllerGetMetadata(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+
+	server := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/sessions/100", nil)
+	rec := httptest.NewRecorder()
+	NewAPIv2Controller(domainMock).RegisterRoutes(server)
+
+	session := testSession
+	session.GameTitle = "Super Mario Bros. (World)"
+	session.GameSystem = "Nintendo - Nintendo Entertainment System"
+	session.GameRegion = "World"
+	session.GameStatus = domain.GameVerified
+	session.Core = &entity.CoreInfo{
+		DisplayName:   "Nintendo - NES / Famicom (Nestopia UE)",
+		Databases:     []string{"Nintendo - Nintendo Entertainment System"},
+		Savestates:    entity.SavestatesDeterministic,
+		Deterministic: true,
+		Netplay:       true,
+	}
+	domainMock.On("Get", int32(100)).Return(&session, nil)
+
+	server.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"core":{"display_name":"Nintendo - NES / Famicom (Nestopia UE)",`+
+		`"databases":["Nintendo - Nintendo Entertainment System"],"savestates":"deterministic","deterministic":true,"netplay":true}`)
+	assert.Contains(t, rec.Body.String(), `"game":{"status":"verified","title":"Super Mario Bros. (World)",`+
+		`"system":"Nintendo - Nintendo Entertainment System","region":"World"}`)
+}
+
+func TestAPIv2ControllerGetErrors(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+
+	server := echo.New()
+	NewAPIv2Controller(domainMock).RegisterRoutes(server)
+
+	domainMock.On("Get", int32(100)).Return(nil, nil)
+	domainMock.On("Get", int32(101)).Return(nil, errors.New("test error"))
+
+	tests := []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/api/v2/sessions/abc", http.StatusBadRequest, ErrorCodeInvalidRequest},
+		{"/api/v2/sessions/100", http.StatusNotFound, ErrorCodeNotFound},
+		{"/api/v2/sessions/101", http.StatusInternalServerError, ErrorCodeInternal},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		rec := httptest.NewRecorder()
+
+		server.ServeHTTP(rec, req)
+		assert.Equal(t, test.status, rec.Code, test.path)
+		assert.Contains(t, rec.Body.String(), fmt.Sprintf(`{"error":{"code":"%s"`, test.code), test.path)
+	}
+}
+
+func TestAPIv2ControllerList(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+
+	server := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/sessions?core_name=unes&limit=1", nil)
+	rec := httptest.NewRecorder()
+	NewAPIv2Controller(domainMock).RegisterRoutes(server)
+
+	domainMock.On("Search", mock.MatchedBy(
+		func(r *domain.ListSessionsRequest) bool {
+			return r.CoreName == "unes" && r.Limit == 1
+		})).Return([]entity.Session{testSession}, 3, nil)
+
+	server.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `{"sessions":[{"room_id":0,"username":"zelda",`)
+	assert.Contains(t, rec.Body.String(), `"total":3}`)
+}
+
+func TestAPIv2ControllerListEmpty(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+
+	server := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/sessions", nil)
+	rec := httptest.NewRecorder()
+	NewAPIv2Controller(domainMock).RegisterRoutes(server)
+
+	domainMock.On("Search", mock.Anything).Return(nil, 0, nil)
+
+	server.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `{"sessions":[],"total":0}`+"\n", rec.Body.String())
+}
+
+func TestAPIv2ControllerListInvalidFilter(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+
+	server := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/sessions?sort=ip", nil)
+	rec := httptest.NewRecorder()
+	NewAPIv2Controller(domainMock).RegisterRoutes(server)
+
+	domainMock.On("Search", mock.Anything).Return(nil, 0, fmt.Errorf("%w: unknown sort field", domain.ErrInvalidFilter))
+
+	server.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"invalid_request"`)
+}
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// FederationDomain interface to decouple the controller logic from the domain code.
+type FederationDomain interface {
+	Export() ([]entity.Session, error)
+}
+
+// FederationController exports the local sessions to the peer lobbies.
+type FederationController struct {
+	federationDomain FederationDomain
+	token            string
+}
+
+// NewFederationController returns a new federation controller. All requests need to present the token as bearer token.
+func NewFederationController(federationDomain FederationDomain, token string) *FederationController {
+	return &FederationController{federationDomain, token}
+}
+
+// RegisterRoutes registers all controller routes at an echo framework instance.
+func (c *FederationController) RegisterRoutes(server *echo.Echo) {
+	federation := server.Group("/federation", middleware.KeyAuth(c.authenticate))
+	federation.GET("/sessions", c.ListSessions)
+}
+
+func (c *FederationController) authenticate(key string, ctx echo.Context) (bool, error) {
+	if c.token == "" {
+		return false, nil
+	}
+	return subtle.ConstantTimeCompare([]byte(key), []byte(c.token)) == 1, nil
+}
+
+// ListSessions handler
+// GET /federation/sessions
+func (c *FederationController) ListSessions(ctx echo.Context) error {
+	logger := ctx.Logger()
+
+	sessions, err := c.federationDomain.Export()
+	if err != nil {
+		logger.Errorf("Can't export sessions: %v", err)
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+
+	return ctx.JSON(http.StatusOK, sessions)
+}
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+const testFederationToken = "peersecret"
+
+type FederationDomainMock struct {
+	mock.Mock
+}
+
+func (m *FederationDomainMock) Export() ([]entity.Session, error) {
+	args := m.Called()
+	sessions, _ := args.Get(0).([]entity.Session)
+	return sessions, args.Error(1)
+}
+
+func setupFederationController() (*echo.Echo, *FederationDomainMock) {
+	domainMock := &FederationDomainMock{}
+	server := echo.New()
+	NewFederationController(domainMock, testFederationToken).RegisterRoutes(server)
+	return server, domainMock
+}
+
+func federationRequest(server *echo.Echo, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/federation/sessions", nil)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestFederationControllerUnauthorized(t *testing.T) {
+	server, domainMock := setupFederationController()
+
+	rec := federationRequest(server, "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = federationRequest(server, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	domainMock.AssertNotCalled(t, "Export")
+}
+
+func TestFederationControllerListSessions(t *testing.T) {
+	server, domainMock := setupFederationController()
+
+	domainMock.On("Export").Return([]entity.Session{testSession}, nil).Once()
+	domainMock.On("Export").Return(nil, errors.New("test error")).Once()
+
+	rec := federationRequest(server, testFederationToken)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"username":"zelda"`)
+	assert.Contains(t, rec.Body.String(), `"ip":"`)
+
+	rec = federationRequest(server, testFederationToken)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/libretro/netplay-lobby-server-go/domain"
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// MetricsDomain interface to decouple the controller logic from the domain code.
+type MetricsDomain interface {
+	Write(w io.Writer, sessions []entity.Session, relays []domain.RelayStatus) error
+}
+
+// MetricsController exposes the lobby metrics to Prometheus.
+type MetricsController struct {
+	sessionDomain SessionDomain
+	metricsDomain MetricsDomain
+}
+
+// NewMetricsController returns a new metrics controller.
+func NewMetricsController(sessionDomain SessionDomain, metricsDomain MetricsDomain) *MetricsController {
+	return &MetricsController{sessionDomain, metricsDomain}
+}
+
+// RegisterRoutes registers all controller routes at an echo framework instance.
+func (c *MetricsController) RegisterRoutes(server *echo.Echo) {
+	server.GET("/metrics", c.Metrics)
+}
+
+// Metrics handler
+// GET /metrics
+func (c *MetricsController) Metrics(ctx echo.Context) error {
+	logger := ctx.Logger()
+
+	sessions, err := c.sessionDomain.List()
+	if err != nil {
+		logger.Errorf("Can't list sessions for metrics: %v", err)
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+
+	ctx.Response().Header().Set(echo.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	ctx.Response().WriteHeader(http.StatusOK)
+	return c.metricsDomain.Write(ctx.Response(), sessions, c.sessionDomain.GetMitm().Status())
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libretro/netplay-lobby-server-go/domain"
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+func TestMetricsControllerMetrics(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+	metricsDomain := domain.NewMetricsDomain()
+
+	server := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	ctx := server.NewContext(req, rec)
+	handler := NewMetricsController(domainMock, metricsDomain)
+
+	session1 := testSession
+	session2 := testSession
+	session2.HostMethod = entity.HostMethodMITM
+	session2.Connectable = false
+	domainMock.On("List").Return([]entity.Session{session1, session2}, nil)
+	relays := []domain.RelayConfig{{Handle: "nyc", Host: "nyc.example.com", Port: 55435, MaxSessions: 10}}
+	domainMock.On("GetMitm").Return(domain.NewMitmDomain(relays, nil, nil, domain.DefaultLobbyConfig(), nil))
+
+	metricsDomain.ObserveAdd("create")
+	metricsDomain.ObserveProbe(domain.ProbeConnectable, 20*time.Millisecond)
+	metricsDomain.ObserveQuery("get_by_id", 2*time.Millisecond)
+
+	handler.Metrics(ctx)
+
+	body := rec.Body.String()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, body, "lobby_sessions 2\n")
+	assert.Contains(t, body, "lobby_sessions_by_core{core=\"unes\"} 2\n")
+	assert.Contains(t, body, "lobby_sessions_by_host_method{host_method=\"mitm\"} 1\n")
+	assert.Contains(t, body, "lobby_sessions_by_host_method{host_method=\"upnp\"} 1\n")
+	assert.Contains(t, body, "lobby_sessions_by_connectable{connectable=\"false\"} 1\n")
+	assert.Contains(t, body, "lobby_add_requests_total{result=\"create\"} 1\n")
+	assert.Contains(t, body, "lobby_probes_total{result=\"connectable\"} 1\n")
+	assert.Contains(t, body, "lobby_probe_duration_seconds_bucket{le=\"0.01\"} 0\n")
+	assert.Contains(t, body, "lobby_probe_duration_seconds_bucket{le=\"0.05\"} 1\n")
+	assert.Contains(t, body, "lobby_probe_duration_seconds_count 1\n")
+	assert.Contains(t, body, "lobby_db_query_duration_seconds_bucket{query=\"get_by_id\",le=\"+Inf\"} 1\n")
+	assert.Contains(t, body, "lobby_db_query_duration_seconds_count{query=\"get_by_id\"} 1\n")
+	assert.Contains(t, body, "lobby_relay_up{relay=\"nyc\"} 1\n")
+	assert.Contains(t, body, "lobby_relay_max_sessions{relay=\"nyc\"} 10\n")
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
@@ -30,7 +31,12 @@ type SessionDomain interface {
 	Add(request *domain.AddSessionRequest, ip net.IP) (*entity.Session, error)
 	Get(roomID int32) (*entity.Session, error)
 	List() ([]entity.Session, error)
+	Search(request *domain.ListSessionsRequest) ([]entity.Session, int, error)
+	Remove(request *domain.RemoveSessionRequest) error
+	Join(ticket string, ip net.IP) (*entity.Session, error)
 	GetMitm() *domain.MitmDomain
+	GetPrivacy() *domain.PrivacyDomain
+	GetEvents() *domain.EventDomain
 	PurgeOld() error
 }
 
@@ -39,6 +45,9 @@ type SessionsResponse struct {
 	Fields entity.Session `json:"fields"`
 }
 
+// EventKeepAlive is the interval in which a comment is sent on idle event streams.
+const EventKeepAlive = 15 * time.Second
+
 // SessionController handles all session related request
 type SessionController struct {
 	sessionDomain SessionDomain
@@ -53,10 +62,15 @@ func NewSessionController(sessionDomain SessionDomain) *SessionController {
 func (c *SessionController) RegisterRoutes(server *echo.Echo) {
 	server.POST("/add", c.Add)
 	server.POST("/add/", c.Add) // Legacy path
+	server.POST("/remove", c.Remove)
 	server.GET("/list", c.List)
 	server.GET("/list/", c.List) // Legacy path
 	server.GET("/tunnel", c.Tunnel)
 	server.GET("/tunnel/", c.Tunnel) // Legacy path
+	server.GET("/tunnel/status", c.TunnelStatus)
+	server.GET("/tunnel/list", c.TunnelList)
+	server.GET("/events", c.Events)
+	server.GET("/join", c.Join)
 	server.GET("/", c.Index)
 	server.GET("/:roomID", c.Get)
 	server.GET("/:roomID/", c.Get) // Legacy path
@@ -90,6 +104,12 @@ func (c *SessionController) PrerenderTemplates(server *echo.Echo, filePattern st
 	return nil
 }
 
+// indexPage holds the data of the index template.
+type indexPage struct {
+	Sessions []entity.Session
+	Relays   []domain.RelayStatus
+}
+
 // Index handler
 // GET /
 func (c *SessionController) Index(ctx echo.Context) error {
@@ -101,7 +121,7 @@ func (c *SessionController) Index(ctx echo.Context) error {
 		return ctx.NoContent(http.StatusInternalServerError)
 	}
 
-	return ctx.Render(http.StatusOK, "index.html", sessions)
+	return ctx.Render(http.StatusOK, "index.html", indexPage{sessions, c.sessionDomain.GetMitm().Status()})
 }
 
 // Get handler
@@ -132,13 +152,35 @@ func (c *SessionController) Get(ctx echo.Context) error {
 
 // List handler
 // GET /list
+// Optional query parameters filter, sort and paginate the list. The total count of matching sessions
+// is returned in the X-Total-Count header.
 func (c *SessionController) List(ctx echo.Context) error {
 	logger := ctx.Logger()
+	var err error
+	var sessions []entity.Session
 
-	sessions, err := c.sessionDomain.List()
-	if err != nil {
-		logger.Errorf("Can't render session list: %v", err)
-		return ctx.NoContent(http.StatusInternalServerError)
+	if len(ctx.QueryParams()) == 0 {
+		if sessions, err = c.sessionDomain.List(); err != nil {
+			logger.Errorf("Can't render session list: %v", err)
+			return ctx.NoContent(http.StatusInternalServerError)
+		}
+	} else {
+		var req domain.ListSessionsRequest
+		if err = ctx.Bind(&req); err != nil {
+			logger.Errorf("Can't parse session list request: %v", err)
+			return ctx.NoContent(http.StatusBadRequest)
+		}
+
+		var count int
+		if sessions, count, err = c.sessionDomain.Search(&req); err != nil {
+			if errors.Is(err, domain.ErrInvalidFilter) {
+				logger.Errorf("Invalid session list request: %v", err)
+				return ctx.NoContent(http.StatusBadRequest)
+			}
+			logger.Errorf("Can't render session list: %v", err)
+			return ctx.NoContent(http.StatusInternalServerError)
+		}
+		ctx.Response().Header().Set("X-Total-Count", strconv.Itoa(count))
 	}
 
 	// For legacy reasons, we need to put the sessions inside a wrapper object
@@ -172,7 +214,10 @@ func (c *SessionController) Add(ctx echo.Context) error {
 		if errors.Is(err, domain.ErrSessionRejected) {
 			logger.Errorf("Rejected session: %v", session)
 			return ctx.NoContent(http.StatusBadRequest)
+		} else if errors.Is(err, domain.ErrInvalidRoomToken) {
+			return ctx.NoContent(http.StatusForbidden)
 		} else if errors.Is(err, domain.ErrRateLimited) {
+			setRetryAfter(ctx, err)
 			return ctx.NoContent(http.StatusTooManyRequests)
 		}
 		return ctx.NoContent(http.StatusBadRequest)
@@ -180,11 +225,40 @@ func (c *SessionController) Add(ctx echo.Context) error {
 
 	result := "status=OK\n"
 	result += session.PrintForRetroarch()
+	if session.Core != nil && !session.Core.Netplay {
+		result += "warning=The core doesn't support netplay\n"
+	}
 	return ctx.String(http.StatusOK, result)
 }
 
+// Remove handler
+// POST /remove
+// Deletes the room of a host right away. Needs the room token returned by /add.
+func (c *SessionController) Remove(ctx echo.Context) error {
+	logger := ctx.Logger()
+
+	var req domain.RemoveSessionRequest
+	if err := ctx.Bind(&req); err != nil || req.RoomToken == "" {
+		return ctx.NoContent(http.StatusBadRequest)
+	}
+
+	if err := c.sessionDomain.Remove(&req); err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			return ctx.NoContent(http.StatusNotFound)
+		} else if errors.Is(err, domain.ErrInvalidRoomToken) {
+			return ctx.NoContent(http.StatusForbidden)
+		}
+		logger.Errorf("Can't remove session: %v", err)
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+
+	return ctx.String(http.StatusOK, "status=OK\n")
+}
+
 // Tunnel handler
 // GET /tunnel
+// Answers with a healthy relay of the same region if the requested one is down. The name "auto" answers with
+// the healthy relay closest to the client. The answer is remembered for the room the client announces next.
 func (c *SessionController) Tunnel(ctx echo.Context) error {
 	logger := ctx.Logger()
 
@@ -193,7 +267,7 @@ func (c *SessionController) Tunnel(ctx echo.Context) error {
 		return ctx.NoContent(http.StatusBadRequest)
 	}
 
-	tunnel := c.sessionDomain.GetMitm().GetInfo(tunnelName)
+	tunnel := c.sessionDomain.GetMitm().Tunnel(tunnelName, net.ParseIP(ctx.RealIP()))
 	if tunnel == nil {
 		logger.Errorf("Can't find tunnel server: '%s'", tunnelName)
 		return ctx.NoContent(http.StatusNotFound)
@@ -203,3 +277,130 @@ func (c *SessionController) Tunnel(ctx echo.Context) error {
 	result += tunnel.PrintForRetroarch()
 	return ctx.String(http.StatusOK, result)
 }
+
+// Join handler
+// GET /join?ticket=
+// Resolves a join ticket of a room with a hidden host IP to the address of the host.
+func (c *SessionController) Join(ctx echo.Context) error {
+	logger := ctx.Logger()
+
+	ticket := ctx.QueryParam("ticket")
+	if ticket == "" {
+		return ctx.NoContent(http.StatusBadRequest)
+	}
+
+	session, err := c.sessionDomain.Join(ticket, net.ParseIP(ctx.RealIP()))
+	if err != nil {
+		if errors.Is(err, domain.ErrRateLimited) {
+			setRetryAfter(ctx, err)
+			return ctx.NoContent(http.StatusTooManyRequests)
+		} else if errors.Is(err, domain.ErrInvalidTicket) {
+			return ctx.NoContent(http.StatusNotFound)
+		}
+		logger.Errorf("Can't resolve join ticket: %v", err)
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+
+	result := "status=OK\n"
+	result += fmt.Sprintf("ip=%s\n", session.IP)
+	result += fmt.Sprintf("port=%d\n", session.Port)
+	return ctx.String(http.StatusOK, result)
+}
+
+// TunnelStatus handler
+// GET /tunnel/status
+// Returns the health of all relay servers.
+func (c *SessionController) TunnelStatus(ctx echo.Context) error {
+	return ctx.JSONPretty(http.StatusOK, c.sessionDomain.GetMitm().Status(), "  ")
+}
+
+// TunnelList handler
+// GET /tunnel/list
+// Returns the relay choices for the clients.
+func (c *SessionController) TunnelList(ctx echo.Context) error {
+	return ctx.JSONPretty(http.StatusOK, c.sessionDomain.GetMitm().List(), "  ")
+}
+
+// Events handler
+// GET /events
+// Streams the session changes as server-sent events. The stream starts with a "snapshot" event containing
+// all current sessions, followed by "created", "updated", "touched", "purged" and "removed" events.
+func (c *SessionController) Events(ctx echo.Context) error {
+	logger := ctx.Logger()
+
+	events := c.sessionDomain.GetEvents()
+	subscription := events.Subscribe()
+	defer events.Unsubscribe(subscription)
+
+	// Take the snapshot after subscribing, so no event between snapshot and stream gets lost
+	sessions, err := c.sessionDomain.List()
+	if err != nil {
+		logger.Errorf("Can't render session snapshot: %v", err)
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+	if sessions == nil {
+		sessions = []entity.Session{}
+	}
+
+	// Event streams are long lived and can't be bound to the server write timeout
+	if err = http.NewResponseController(ctx.Response().Writer).SetWriteDeadline(time.Time{}); err != nil {
+		logger.Warnf("Can't reset write deadline for event stream: %v", err)
+	}
+
+	response := ctx.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set("Cache-Control", "no-cache")
+	response.WriteHeader(http.StatusOK)
+
+	if err = writeEvent(response, "snapshot", sessions); err != nil {
+		return nil
+	}
+
+	keepAlive := time.NewTicker(EventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Request().Context().Done():
+			return nil
+		case event, ok := <-subscription.Events():
+			if !ok {
+				// The subscriber fell behind, the client needs to reconnect
+				return nil
+			}
+			c.sessionDomain.GetPrivacy().Mask(&event.Session)
+			if err = writeEvent(response, string(event.Type), event.Session); err != nil {
+				return nil
+			}
+		case <-keepAlive.C:
+			if _, err = io.WriteString(response, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			response.Flush()
+		}
+	}
+}
+
+// writeEvent writes a single server-sent event with a JSON payload.
+func writeEvent(response *echo.Response, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if _, err = fmt.Fprintf(response, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	response.Flush()
+
+	return nil
+}
+
+// setRetryAfter sets the Retry-After header in whole seconds if the error is a RateLimitError.
+func setRetryAfter(ctx echo.Context, err error) {
+	var rateLimitErr *domain.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		retryAfter := (rateLimitErr.RetryAfter + time.Second - 1) / time.Second
+		ctx.Response().Header().Set("Retry-After", strconv.FormatInt(int64(retryAfter), 10))
+	}
+}
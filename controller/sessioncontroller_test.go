@@ -1,10 +1,12 @@
 package controller
 
 import (
+	"bufio"
 	"errors"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -66,15 +68,44 @@ func (m *SessionDomainMock) List() ([]entity.Session, error) {
 	return sessions, args.Error(1)
 }
 
+func (m *SessionDomainMock) Search(request *domain.ListSessionsRequest) ([]entity.Session, int, error) {
+	args := m.Called(request)
+	sessions, _ := args.Get(0).([]entity.Session)
+	return sessions, args.Int(1), args.Error(2)
+}
+
 func (m *SessionDomainMock) PurgeOld() error {
 	args := m.Called()
 	return args.Error(0)
 }
 
-func (d *SessionDomainMock) GetMitm() *domain.MitmDomain {
+func (m *SessionDomainMock) Remove(request *domain.RemoveSessionRequest) error {
+	args := m.Called(request)
+	return args.Error(0)
+}
+
+func (m *SessionDomainMock) Join(ticket string, ip net.IP) (*entity.Session, error) {
+	args := m.Called(ticket, ip)
+	session, _ := args.Get(0).(*entity.Session)
+	return session, args.Error(1)
+}
+
+func (m *SessionDomainMock) GetMitm() *domain.MitmDomain {
+	args := m.Called()
+	mitm, _ := args.Get(0).(*domain.MitmDomain)
+	return mitm
+}
+
+func (d *SessionDomainMock) GetPrivacy() *domain.PrivacyDomain {
 	return nil
 }
 
+func (m *SessionDomainMock) GetEvents() *domain.EventDomain {
+	args := m.Called()
+	events, _ := args.Get(0).(*domain.EventDomain)
+	return events
+}
+
 func TestSessionControllerIndex(t *testing.T) {
 	domainMock := &SessionDomainMock{}
 
@@ -92,12 +123,16 @@ func TestSessionControllerIndex(t *testing.T) {
 	session2.Username = "Player 2"
 	sessions := []entity.Session{session1, session2}
 	domainMock.On("List").Return(sessions, nil)
+	relays := []domain.RelayConfig{{Handle: "nyc", Name: "New York", Host: "nyc.example.com", Port: 55435, MaxSessions: 10}}
+	domainMock.On("GetMitm").Return(domain.NewMitmDomain(relays, nil, nil, domain.DefaultLobbyConfig(), nil))
 
 	handler.Index(ctx)
 
 	assert.Equal(t, http.StatusOK, rec.Code)
 	assert.Contains(t, rec.Body.String(), "Player 1")
 	assert.Contains(t, rec.Body.String(), "Player 2")
+	assert.Contains(t, rec.Body.String(), "New York")
+	assert.Contains(t, rec.Body.String(), "0 / 10")
 }
 
 func TestSessionControllerGet(t *testing.T) {
@@ -215,3 +250,277 @@ func TestSessionControllerListError(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, rec.Code)
 	assert.Equal(t, "", rec.Body.String())
 }
+
+func TestSessionControllerListFiltered(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/list?core_name=unes&has_password=0&sort=-created&limit=1&offset=2", nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	handler := NewSessionController(domainMock)
+
+	session := testSession
+	domainMock.On("Search", &domain.ListSessionsRequest{
+		CoreName:    "unes",
+		HasPassword: "0",
+		Sort:        "-created",
+		Limit:       1,
+		Offset:      2,
+	}).Return([]entity.Session{session}, 5, nil)
+
+	handler.List(ctx)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "5", rec.Header().Get("X-Total-Count"))
+	assert.Contains(t, rec.Body.String(), `"fields": {`)
+	assert.Contains(t, rec.Body.String(), `"username": "zelda"`)
+	domainMock.AssertNotCalled(t, "List")
+}
+
+func TestSessionControllerListInvalidFilter(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/list?sort=ip", nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	handler := NewSessionController(domainMock)
+
+	domainMock.On("Search", mock.Anything).Return(nil, 0, domain.ErrInvalidFilter)
+
+	handler.List(ctx)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestSessionControllerAddRateLimited(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/add", strings.NewReader("username=zelda&port=55355"))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	handler := NewSessionController(domainMock)
+
+	domainMock.On("Add", mock.Anything, mock.Anything).Return(nil, &domain.RateLimitError{Reason: "room creation", RetryAfter: 1500 * time.Millisecond})
+
+	handler.Add(ctx)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+}
+
+func TestSessionControllerAddInvalidRoomToken(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/add", strings.NewReader("username=zelda&port=55355&room_token=wrong"))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	handler := NewSessionController(domainMock)
+
+	domainMock.On("Add", mock.MatchedBy(
+		func(r *domain.AddSessionRequest) bool {
+			return r.RoomToken == "wrong"
+		}), mock.Anything).Return(nil, domain.ErrInvalidRoomToken)
+
+	handler.Add(ctx)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestSessionControllerAddNonNetplayCore(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/add", strings.NewReader("username=zelda&port=55355"))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	handler := NewSessionController(domainMock)
+
+	session := testSession
+	session.Core = &entity.CoreInfo{DisplayName: "DOS (DOSBox-SVN)", Savestates: entity.SavestatesBasic}
+	domainMock.On("Add", mock.Anything, mock.Anything).Return(&session, nil)
+
+	handler.Add(ctx)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.HasSuffix(rec.Body.String(), "warning=The core doesn't support netplay\n"))
+}
+
+func TestSessionControllerRemove(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+	handler := NewSessionController(domainMock)
+
+	domainMock.On("Remove", &domain.RemoveSessionRequest{RoomID: 1, RoomToken: "token"}).Return(nil)
+	domainMock.On("Remove", &domain.RemoveSessionRequest{RoomID: 2, RoomToken: "token"}).Return(domain.ErrSessionNotFound)
+	domainMock.On("Remove", &domain.RemoveSessionRequest{RoomID: 1, RoomToken: "wrong"}).Return(domain.ErrInvalidRoomToken)
+	domainMock.On("Remove", &domain.RemoveSessionRequest{RoomID: 3, RoomToken: "token"}).Return(errors.New("test error"))
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{"room_id=1&room_token=token", http.StatusOK},
+		{"room_id=1", http.StatusBadRequest},
+		{"room_id=2&room_token=token", http.StatusNotFound},
+		{"room_id=1&room_token=wrong", http.StatusForbidden},
+		{"room_id=3&room_token=token", http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/remove", strings.NewReader(test.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(req, rec)
+
+		handler.Remove(ctx)
+		assert.Equal(t, test.status, rec.Code, test.body)
+	}
+}
+
+func TestSessionControllerJoin(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/join?ticket=abc", nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	handler := NewSessionController(domainMock)
+
+	session := testSession
+	domainMock.On("Join", "abc", mock.Anything).Return(&session, nil)
+
+	handler.Join(ctx)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "status=OK\nip=127.0.0.1\nport=55355\n", rec.Body.String())
+}
+
+func TestSessionControllerJoinErrors(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+	handler := NewSessionController(domainMock)
+
+	domainMock.On("Join", "expired", mock.Anything).Return(nil, domain.ErrInvalidTicket)
+	domainMock.On("Join", "flood", mock.Anything).Return(nil, &domain.RateLimitError{Reason: "join ticket", RetryAfter: time.Second})
+
+	tests := []struct {
+		query  string
+		status int
+	}{
+		{"", http.StatusBadRequest},
+		{"?ticket=expired", http.StatusNotFound},
+		{"?ticket=flood", http.StatusTooManyRequests},
+	}
+
+	for _, test := range tests {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/join"+test.query, nil)
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(req, rec)
+
+		handler.Join(ctx)
+		assert.Equal(t, test.status, rec.Code, test.query)
+	}
+}
+
+func TestSessionControllerEvents(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+	events := domain.NewEventDomain(domain.EventBufferSize)
+
+	server := echo.New()
+	handler := NewSessionController(domainMock)
+	handler.RegisterRoutes(server)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	session := testSession
+	domainMock.On("GetEvents").Return(events)
+	domainMock.On("List").Return([]entity.Session{session}, nil)
+
+	res, err := http.Get(httpServer.URL + "/events")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(res.Body)
+	readEvent := func() (string, string) {
+		event, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		data, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		_, err = reader.ReadString('\n')
+		require.NoError(t, err)
+		return strings.TrimSpace(event), strings.TrimSpace(data)
+	}
+
+	event, data := readEvent()
+	assert.Equal(t, "event: snapshot", event)
+	assert.True(t, strings.HasPrefix(data, `data: [{"id":0,"username":"zelda"`))
+
+	session.Username = "link"
+	events.Publish(domain.SessionEvent{Type: domain.SessionCreated, Session: session})
+
+	event, data = readEvent()
+	assert.Equal(t, "event: created", event)
+	assert.True(t, strings.HasPrefix(data, `data: {"id":0,"username":"link"`))
+}
+
+func TestSessionControllerTunnel(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+	handler := NewSessionController(domainMock)
+
+	mitmDomain := domain.NewMitmDomain(domain.ParseLegacyRelays(map[string]string{"nyc": "nyc.example.com:55435"}), nil, nil, domain.DefaultLobbyConfig(), nil)
+	domainMock.On("GetMitm").Return(mitmDomain)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/tunnel?name=nyc", nil)
+	rec := httptest.NewRecorder()
+	handler.Tunnel(e.NewContext(req, rec))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "status=OK\ntunnel_addr=nyc.example.com\ntunnel_port=55435\n", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/tunnel?name=unknown", nil)
+	rec = httptest.NewRecorder()
+	handler.Tunnel(e.NewContext(req, rec))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestSessionControllerTunnelStatus(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+	handler := NewSessionController(domainMock)
+
+	mitmDomain := domain.NewMitmDomain(domain.ParseLegacyRelays(map[string]string{"nyc": "nyc.example.com:55435"}), nil, nil, domain.DefaultLobbyConfig(), nil)
+	domainMock.On("GetMitm").Return(mitmDomain)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/tunnel/status", nil)
+	rec := httptest.NewRecorder()
+	handler.TunnelStatus(e.NewContext(req, rec))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"handle": "nyc"`)
+	assert.Contains(t, rec.Body.String(), `"up": true`)
+}
+
+func TestSessionControllerTunnelList(t *testing.T) {
+	domainMock := &SessionDomainMock{}
+	handler := NewSessionController(domainMock)
+
+	relays := []domain.RelayConfig{{Handle: "nyc", Name: "New York", Host: "nyc.example.com", Port: 55435, Region: "na"}}
+	domainMock.On("GetMitm").Return(domain.NewMitmDomain(relays, nil, nil, domain.DefaultLobbyConfig(), nil))
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/tunnel/list", nil)
+	rec := httptest.NewRecorder()
+	handler.TunnelList(e.NewContext(req, rec))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `[
+  {
+    "handle": "nyc",
+    "name": "New York",
+    "region": "na",
+    "up": true
+  }
+]
+`, rec.Body.String())
+}
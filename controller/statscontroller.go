@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/libretro/netplay-lobby-server-go/domain"
+)
+
+// StatsDomain interface to decouple the controller logic from the domain code.
+type StatsDomain interface {
+	Get(period domain.StatsPeriod, request *domain.StatsRequest) ([]domain.StatsBucket, error)
+}
+
+// StatsController serves the play statistics of the session history.
+type StatsController struct {
+	statsDomain StatsDomain
+}
+
+// NewStatsController returns a new statistics controller.
+func NewStatsController(statsDomain StatsDomain) *StatsController {
+	return &StatsController{statsDomain}
+}
+
+// RegisterRoutes registers all controller routes at an echo framework instance.
+func (c *StatsController) RegisterRoutes(server *echo.Echo) {
+	server.GET("/stats/:period", c.Stats)
+}
+
+// Stats handler
+// GET /stats/:period
+func (c *StatsController) Stats(ctx echo.Context) error {
+	logger := ctx.Logger()
+
+	var req domain.StatsRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.NoContent(http.StatusBadRequest)
+	}
+
+	stats, err := c.statsDomain.Get(domain.StatsPeriod(ctx.Param("period")), &req)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidStatsRequest) {
+			return ctx.NoContent(http.StatusBadRequest)
+		}
+		logger.Errorf("Can't get statistics: %v", err)
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+
+	return ctx.JSONPretty(http.StatusOK, stats, "  ")
+}
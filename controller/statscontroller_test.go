@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/libretro/netplay-lobby-server-go/domain"
+)
+
+type StatsDomainMock struct {
+	mock.Mock
+}
+
+func (m *StatsDomainMock) Get(period domain.StatsPeriod, request *domain.StatsRequest) ([]domain.StatsBucket, error) {
+	args := m.Called(period, request)
+	buckets, _ := args.Get(0).([]domain.StatsBucket)
+	return buckets, args.Error(1)
+}
+
+func TestStatsControllerStats(t *testing.T) {
+	domainMock := &StatsDomainMock{}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/stats/daily?from=2020-01-01&to=2020-01-01&limit=1", nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetParamNames("period")
+	ctx.SetParamValues("daily")
+	handler := NewStatsController(domainMock)
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	domainMock.On("Get", domain.StatsDaily, &domain.StatsRequest{From: "2020-01-01", To: "2020-01-01", Limit: 1}).Return([]domain.StatsBucket{{
+		Start:     start,
+		End:       start.AddDate(0, 0, 1),
+		Rooms:     3,
+		PeakRooms: 2,
+		Games:     []domain.StatsEntry{{Name: "supergame", GameCRC: "FFFFFFFF", Rooms: 3, PlayTime: 600, PeakPlayers: 2}},
+		Cores:     []domain.StatsEntry{},
+		Countries: []domain.StatsEntry{},
+	}}, nil)
+
+	handler.Stats(ctx)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"start": "2020-01-01T00:00:00Z"`)
+	assert.Contains(t, rec.Body.String(), `"peak_rooms": 2`)
+	assert.Contains(t, rec.Body.String(), `"game_crc": "FFFFFFFF"`)
+}
+
+func TestStatsControllerStatsInvalidPeriod(t *testing.T) {
+	domainMock := &StatsDomainMock{}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/stats/hourly", nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetParamNames("period")
+	ctx.SetParamValues("hourly")
+	handler := NewStatsController(domainMock)
+
+	domainMock.On("Get", domain.StatsPeriod("hourly"), mock.Anything).Return(nil, domain.ErrInvalidStatsRequest)
+
+	handler.Stats(ctx)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
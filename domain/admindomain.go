@@ -0,0 +1,230 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// ErrNotFound is thrown when the requested session or ban does not exist.
+var ErrNotFound = errors.New("Not found")
+
+// ErrInvalidBan is thrown when a ban has an unknown type or an invalid pattern.
+var ErrInvalidBan = errors.New("Invalid ban")
+
+// BanRepository interface to decouple the domain logic from the repository code.
+type BanRepository interface {
+	Create(b *entity.Ban) error
+	GetAll() ([]entity.Ban, error)
+	Delete(id uint) error
+}
+
+// AdminDomain abstracts the domain logic for moderating sessions.
+type AdminDomain struct {
+	mutex            sync.Mutex
+	sessionRepo      SessionRepository
+	sessionDomain    *SessionDomain
+	banRepo          BanRepository
+	validationDomain *ValidationDomain
+	bans             []entity.Ban
+}
+
+// NewAdminDomain returns an initalized AdminDomain struct. The persisted bans are loaded into the validation domain.
+// Sessions are deleted through the session domain, so they end like any other removed session.
+func NewAdminDomain(
+	sessionRepo SessionRepository,
+	sessionDomain *SessionDomain,
+	banRepo BanRepository,
+	validationDomain *ValidationDomain) (*AdminDomain, error) {
+	bans, err := banRepo.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("Can't load bans: %w", err)
+	}
+
+	d := &AdminDomain{sessionRepo: sessionRepo, sessionDomain: sessionDomain, banRepo: banRepo, validationDomain: validationDomain}
+	if err := d.applyBans(bans); err != nil {
+		return nil, fmt.Errorf("Can't apply persisted bans: %w", err)
+	}
+
+	return d, nil
+}
+
+// Reload replaces the bans with the persisted ones, so the bans other replicas issued or lifted apply here as well.
+func (d *AdminDomain) Reload() error {
+	bans, err := d.banRepo.GetAll()
+	if err != nil {
+		return fmt.Errorf("Can't load bans: %w", err)
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.applyBans(bans); err != nil {
+		return fmt.Errorf("Can't apply persisted bans: %w", err)
+	}
+
+	return nil
+}
+
+// Run reloads the bans in the given interval until the context gets canceled. An interval of zero disables
+// the reloads.
+func (d *AdminDomain) Run(ctx context.Context, interval time.Duration, logger Logger) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := d.Reload(); err != nil {
+			logger.Errorf("Can't reload bans: %v", err)
+		}
+	}
+}
+
+// ListSessions returns all sessions, including the ones that are about to be purged.
+func (d *AdminDomain) ListSessions() ([]entity.Session, error) {
+	return d.sessionRepo.GetAll(time.Time{})
+}
+
+// DeleteSession deletes the session with the given RoomID.
+// Returns ErrNotFound if the session does not exist.
+func (d *AdminDomain) DeleteSession(roomID int32) error {
+	_, err := d.sessionDomain.Delete(roomID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// BanSession bans the IP of the session with the given RoomID and deletes the session. With username set, the exact
+// username is banned as well, so the host can't come back from another IP under the same name. String bans match
+// the other session fields as well and the default username is shared by every host without one, so it can't be banned.
+// Returns ErrNotFound if the session does not exist.
+// Returns ErrInvalidBan if the username is requested to be banned but is the default username.
+func (d *AdminDomain) BanSession(roomID int32, reason string, username bool) ([]entity.Ban, error) {
+	session, err := d.sessionRepo.GetByRoomID(roomID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, ErrNotFound
+	}
+	if username && session.Username == d.sessionDomain.config.DefaultUsername {
+		return nil, fmt.Errorf("%w: can't ban the default username", ErrInvalidBan)
+	}
+
+	ban, err := d.Ban(entity.BanTypeIP, session.IP.String(), reason)
+	if err != nil {
+		return nil, err
+	}
+	bans := []entity.Ban{*ban}
+
+	if username {
+		if ban, err = d.Ban(entity.BanTypeString, "^"+regexp.QuoteMeta(session.Username)+"$", reason); err != nil {
+			return nil, err
+		}
+		bans = append(bans, *ban)
+	}
+
+	// The session may have ended in the meantime
+	if _, err = d.sessionDomain.Delete(roomID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return nil, err
+	}
+
+	return bans, nil
+}
+
+// ListBans returns all runtime bans.
+func (d *AdminDomain) ListBans() []entity.Ban {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	bans := make([]entity.Ban, len(d.bans))
+	copy(bans, d.bans)
+	return bans
+}
+
+// Ban adds and persists a new IP or string ban. IP bans can be single IPs or CIDR ranges,
+// string bans are regular expressions.
+// Returns ErrInvalidBan if the ban can't be parsed.
+func (d *AdminDomain) Ban(banType entity.BanType, pattern string, reason string) (*entity.Ban, error) {
+	if pattern == "" || (banType != entity.BanTypeIP && banType != entity.BanTypeString) {
+		return nil, ErrInvalidBan
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	ban := entity.Ban{Type: banType, Pattern: pattern, Reason: reason}
+	bans := append(d.bans[:len(d.bans):len(d.bans)], ban)
+	if err := d.applyBans(bans); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBan, err)
+	}
+
+	if err := d.banRepo.Create(&ban); err != nil {
+		d.applyBans(bans[:len(bans)-1])
+		return nil, err
+	}
+	d.bans[len(d.bans)-1] = ban
+
+	return &ban, nil
+}
+
+// Unban removes the ban with the given ID.
+// Returns ErrNotFound if the ban does not exist.
+func (d *AdminDomain) Unban(id uint) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	bans := make([]entity.Ban, 0, len(d.bans))
+	for _, ban := range d.bans {
+		if ban.ID != id {
+			bans = append(bans, ban)
+		}
+	}
+	if len(bans) == len(d.bans) {
+		return ErrNotFound
+	}
+
+	if err := d.banRepo.Delete(id); err != nil {
+		return err
+	}
+
+	return d.applyBans(bans)
+}
+
+// applyBans hands the bans over to the validation domain. Needs to be called with the mutex held.
+func (d *AdminDomain) applyBans(bans []entity.Ban) error {
+	var stringBans []string
+	var ipBans []string
+
+	for _, ban := range bans {
+		switch ban.Type {
+		case entity.BanTypeIP:
+			ipBans = append(ipBans, ban.Pattern)
+		case entity.BanTypeString:
+			stringBans = append(stringBans, ban.Pattern)
+		}
+	}
+
+	if err := d.validationDomain.SetBans(stringBans, ipBans); err != nil {
+		return err
+	}
+	d.bans = bans
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package domain
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+	"github.com/libretro/netplay-lobby-server-go/model/repository"
+)
+
+type BanRepositoryMock struct {
+	mock.Mock
+}
+
+func (m *BanRepositoryMock) Create(b *entity.Ban) error {
+	args := m.Called(b)
+	b.ID = uint(len(m.Calls))
+	return args.Error(0)
+}
+
+func (m *BanRepositoryMock) GetAll() ([]entity.Ban, error) {
+	args := m.Called()
+	bans, _ := args.Get(0).([]entity.Ban)
+	return bans, args.Error(1)
+}
+
+func (m *BanRepositoryMock) Delete(id uint) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func setupAdminDomain(t *testing.T, bans []entity.Ban) (*AdminDomain, *ValidationDomain, *SessionRepositoryMock, *BanRepositoryMock) {
+	adminDomain, _, sessionRepoMock, _, banRepoMock := setupAdminDomainWithSessions(t, bans)
+	return adminDomain, adminDomain.validationDomain, sessionRepoMock, banRepoMock
+}
+
+func setupAdminDomainWithSessions(t *testing.T, bans []entity.Ban) (*AdminDomain, *SessionDomain, *SessionRepositoryMock, *HistoryRepositoryMock, *BanRepositoryMock) {
+	sessionDomain, sessionRepoMock, historyMock := setupSessionDomainWithHistory(t)
+	banRepoMock := &BanRepositoryMock{}
+
+	banRepoMock.On("GetAll").Return(bans, nil)
+
+	adminDomain, err := NewAdminDomain(sessionRepoMock, sessionDomain, banRepoMock, sessionDomain.validationDomain)
+	require.NoError(t, err)
+
+	return adminDomain, sessionDomain, sessionRepoMock, historyMock, banRepoMock
+}
+
+func TestAdminDomainLoadsPersistedBans(t *testing.T) {
+	_, validationDomain, _, _ := setupAdminDomain(t, []entity.Ban{
+		{ID: 1, Type: entity.BanTypeIP, Pattern: "88.12.0.0/16"},
+		{ID: 2, Type: entity.BanTypeString, Pattern: "^troll"},
+	})
+
+	assert.False(t, validationDomain.ValdateIP(net.ParseIP("88.12.123.77")))
+	assert.False(t, validationDomain.ValidateString("trollface"))
+	assert.True(t, validationDomain.ValidateString("zelda"))
+}
+
+func TestAdminDomainBan(t *testing.T) {
+	adminDomain, validationDomain, _, banRepoMock := setupAdminDomain(t, nil)
+
+	banRepoMock.On("Create", mock.Anything).Return(nil)
+
+	ban, err := adminDomain.Ban(entity.BanTypeIP, "88.12.0.0/16", "griefing")
+	require.NoError(t, err)
+	require.NotNil(t, ban)
+	assert.NotZero(t, ban.ID)
+
+	assert.False(t, validationDomain.ValdateIP(net.ParseIP("88.12.123.77")))
+	assert.Equal(t, 1, len(adminDomain.ListBans()))
+
+	// Bans from the configuration should still be active
+	assert.False(t, validationDomain.ValdateIP(net.ParseIP("127.0.0.1")))
+}
+
+func TestAdminDomainBanInvalid(t *testing.T) {
+	adminDomain, _, _, _ := setupAdminDomain(t, nil)
+
+	_, err := adminDomain.Ban(entity.BanTypeIP, "88.12.0.0/33", "")
+	assert.True(t, errors.Is(err, ErrInvalidBan))
+
+	_, err = adminDomain.Ban(entity.BanTypeString, "[", "")
+	assert.True(t, errors.Is(err, ErrInvalidBan))
+
+	_, err = adminDomain.Ban("unknown", "zelda", "")
+	assert.True(t, errors.Is(err, ErrInvalidBan))
+
+	assert.Equal(t, 0, len(adminDomain.ListBans()))
+}
+
+func TestAdminDomainUnban(t *testing.T) {
+	adminDomain, validationDomain, _, banRepoMock := setupAdminDomain(t, []entity.Ban{
+		{ID: 1, Type: entity.BanTypeIP, Pattern: "88.12.0.0/16"},
+	})
+
+	banRepoMock.On("Delete", uint(1)).Return(nil)
+
+	err := adminDomain.Unban(1)
+	require.NoError(t, err)
+	assert.True(t, validationDomain.ValdateIP(net.ParseIP("88.12.123.77")))
+
+	err = adminDomain.Unban(1)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestAdminDomainDeleteSession(t *testing.T) {
+	adminDomain, sessionDomain, sessionRepoMock, historyMock, _ := setupAdminDomainWithSessions(t, nil)
+	subscription := sessionDomain.GetEvents().Subscribe()
+	webhookRepo := repository.NewMemoryWebhookRepository()
+	sessionDomain.webhooks = setupWebhookDomain(t, []WebhookConfig{{Name: "discord", URL: "http://localhost/", Secret: testWebhookSecret}}, webhookRepo)
+
+	session := testSession
+	sessionRepoMock.On("GetByRoomID", int32(100)).Return(&session, nil)
+	sessionRepoMock.On("DeleteByRoomID", int32(100)).Return(nil)
+	historyMock.On("Archive", mock.MatchedBy(
+		func(h []entity.SessionHistory) bool {
+			return len(h) == 1 && h[0].RoomID == 100
+		})).Return(nil)
+
+	require.NoError(t, adminDomain.DeleteSession(100))
+	sessionRepoMock.AssertExpectations(t)
+	historyMock.AssertExpectations(t)
+
+	event := <-subscription.Events()
+	assert.Equal(t, SessionRemoved, event.Type)
+	assert.Equal(t, int32(100), event.Session.RoomID)
+
+	queued := getQueued(t, webhookRepo)
+	require.Equal(t, 1, len(queued))
+	assert.Equal(t, "removed", queued[0].Event)
+}
+
+func TestAdminDomainBanSession(t *testing.T) {
+	adminDomain, sessionDomain, sessionRepoMock, historyMock, banRepoMock := setupAdminDomainWithSessions(t, nil)
+	validationDomain := adminDomain.validationDomain
+	subscription := sessionDomain.GetEvents().Subscribe()
+
+	session := testSession
+	session.IP = net.ParseIP("88.12.123.77")
+	sessionRepoMock.On("GetByRoomID", int32(100)).Return(&session, nil)
+	sessionRepoMock.On("DeleteByRoomID", int32(100)).Return(nil)
+	historyMock.On("Archive", mock.Anything).Return(nil)
+	banRepoMock.On("Create", mock.MatchedBy(
+		func(b *entity.Ban) bool {
+			return b.Type == entity.BanTypeIP && b.Pattern == "88.12.123.77"
+		})).Return(nil)
+
+	bans, err := adminDomain.BanSession(100, "griefing", false)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(bans))
+	assert.Equal(t, "griefing", bans[0].Reason)
+	assert.False(t, validationDomain.ValdateIP(session.IP))
+	assert.True(t, validationDomain.ValidateString(session.Username), "The username was banned")
+	sessionRepoMock.AssertCalled(t, "DeleteByRoomID", int32(100))
+	historyMock.AssertCalled(t, "Archive", mock.Anything)
+
+	event := <-subscription.Events()
+	assert.Equal(t, SessionRemoved, event.Type)
+}
+
+func TestAdminDomainBanSessionUsername(t *testing.T) {
+	adminDomain, _, sessionRepoMock, historyMock, banRepoMock := setupAdminDomainWithSessions(t, nil)
+	validationDomain := adminDomain.validationDomain
+
+	session := testSession
+	session.Username = "zel.da"
+	session.IP = net.ParseIP("88.12.123.77")
+	sessionRepoMock.On("GetByRoomID", int32(100)).Return(&session, nil)
+	sessionRepoMock.On("DeleteByRoomID", int32(100)).Return(nil)
+	historyMock.On("Archive", mock.Anything).Return(nil)
+	banRepoMock.On("Create", mock.Anything).Return(nil)
+
+	bans, err := adminDomain.BanSession(100, "griefing", true)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(bans))
+	assert.Equal(t, entity.BanTypeString, bans[1].Type)
+	assert.Equal(t, "griefing", bans[1].Reason)
+	assert.False(t, validationDomain.ValidateString("zel.da"))
+	assert.True(t, validationDomain.ValidateString("zelxda"), "The username ban isn't literal")
+	assert.True(t, validationDomain.ValidateString("zel.dah"), "The username ban isn't exact")
+
+	// Every host without a username shares the default one
+	session.Username = adminDomain.sessionDomain.config.DefaultUsername
+	_, err = adminDomain.BanSession(100, "griefing", true)
+	assert.True(t, errors.Is(err, ErrInvalidBan))
+	assert.Equal(t, 2, len(adminDomain.ListBans()))
+}
+
+func TestAdminDomainDeleteSessionNotFound(t *testing.T) {
+	adminDomain, _, sessionRepoMock, _ := setupAdminDomain(t, nil)
+
+	sessionRepoMock.On("GetByRoomID", int32(100)).Return(nil, nil)
+
+	err := adminDomain.DeleteSession(100)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
@@ -0,0 +1,121 @@
+package domain
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// ErrCoreNotNetplay is thrown when a host announces a room for a core that doesn't support netplay.
+var ErrCoreNotNetplay = errors.New("Core doesn't support netplay")
+
+// CoreInfoDomain provides the metadata of the libretro cores from their .info files.
+type CoreInfoDomain struct {
+	cores map[string]*entity.CoreInfo // Lower case core name to its metadata
+}
+
+// NewCoreInfoDomain loads all .info files in the given directory. Without a path no core is known.
+func NewCoreInfoDomain(path string) (*CoreInfoDomain, error) {
+	d := &CoreInfoDomain{make(map[string]*entity.CoreInfo)}
+	if path == "" {
+		return d, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "*.info"))
+	if err != nil {
+		return nil, fmt.Errorf("Can't list core info files in %s: %w", path, err)
+	}
+	for _, file := range files {
+		if err = d.loadFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// Get returns the metadata of the core with the given name or nil if the core is unknown.
+func (d *CoreInfoDomain) Get(coreName string) *entity.CoreInfo {
+	return d.cores[strings.ToLower(coreName)]
+}
+
+// CoreSystems returns the libretro-database systems of all known cores by their lower case names.
+func (d *CoreInfoDomain) CoreSystems() map[string][]string {
+	systems := make(map[string][]string, len(d.cores))
+	for name, core := range d.cores {
+		if len(core.Databases) > 0 {
+			systems[name] = append([]string(nil), core.Databases...)
+		}
+	}
+	return systems
+}
+
+// loadFile adds the core of an .info file. Files without a core name are ignored.
+func (d *CoreInfoDomain) loadFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("Can't open core info file %s: %w", file, err)
+	}
+	defer f.Close()
+
+	name, core, err := parseCoreInfo(f)
+	if err != nil {
+		return fmt.Errorf("Can't parse core info file %s: %w", file, err)
+	}
+	if name != "" {
+		d.cores[strings.ToLower(name)] = core
+	}
+
+	return nil
+}
+
+// parseCoreInfo parses the "key = value" lines of an .info file and returns the core name with its metadata.
+// Cores without savestate features are assumed to have deterministic savestates like RetroArch does.
+func parseCoreInfo(r io.Reader) (string, *entity.CoreInfo, error) {
+	values := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		values[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", nil, err
+	}
+
+	core := &entity.CoreInfo{
+		DisplayName: values["display_name"],
+		SystemName:  values["systemname"],
+		Savestates:  entity.SavestatesNone,
+	}
+	if values["database"] != "" {
+		core.Databases = strings.Split(values["database"], "|")
+	}
+
+	if values["savestate"] == "true" {
+		switch values["savestate_features"] {
+		case entity.SavestatesBasic, entity.SavestatesSerialized:
+			core.Savestates = values["savestate_features"]
+		default:
+			core.Savestates = entity.SavestatesDeterministic
+		}
+	}
+	core.Deterministic = core.Savestates == entity.SavestatesDeterministic
+	core.Netplay = core.Deterministic
+
+	return values["corename"], core, nil
+}
@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+const testNestopiaInfo = `# Software Information
+display_name = "Nintendo - NES / Famicom (Nestopia UE)"
+authors = "Martin Freij|R. Belmont"
+supported_extensions = "nes|fds|unf|unif"
+corename = "Nestopia"
+license = "GPLv2"
+
+# Hardware Information
+manufacturer = "Nintendo"
+systemname = "Nintendo Entertainment System"
+database = "Nintendo - Nintendo Entertainment System|Nintendo - Family Computer Disk System"
+
+# Libretro Features
+savestate = "true"
+savestate_features = "deterministic"
+`
+
+const testDOSBoxInfo = `display_name = "DOS (DOSBox-SVN)"
+corename = "DOSBox-SVN"
+systemname = "DOS"
+savestate = "true"
+savestate_features = "basic"
+`
+
+func setupCoreInfoDomain(t *testing.T) *CoreInfoDomain {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nestopia_libretro.info"), []byte(testNestopiaInfo), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "dosbox_svn_libretro.info"), []byte(testDOSBoxInfo), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nameless_libretro.info"), []byte(`display_name = "Nameless"`), 0644))
+
+	coreInfoDomain, err := NewCoreInfoDomain(dir)
+	require.NoError(t, err)
+
+	return coreInfoDomain
+}
+
+func TestCoreInfoDomainGet(t *testing.T) {
+	coreInfoDomain := setupCoreInfoDomain(t)
+
+	assert.Equal(t, &entity.CoreInfo{
+		DisplayName:   "Nintendo - NES / Famicom (Nestopia UE)",
+		SystemName:    "Nintendo Entertainment System",
+		Databases:     []string{"Nintendo - Nintendo Entertainment System", "Nintendo - Family Computer Disk System"},
+		Savestates:    entity.SavestatesDeterministic,
+		Deterministic: true,
+		Netplay:       true,
+	}, coreInfoDomain.Get("nestopia"))
+
+	core := coreInfoDomain.Get("DOSBox-SVN")
+	require.NotNil(t, core)
+	assert.Equal(t, entity.SavestatesBasic, core.Savestates)
+	assert.False(t, core.Deterministic)
+	assert.False(t, core.Netplay)
+
+	assert.Nil(t, coreInfoDomain.Get("Nameless"))
+	assert.Nil(t, coreInfoDomain.Get("Unknown Core"))
+
+	assert.Equal(t, map[string][]string{
+		"nestopia": {"Nintendo - Nintendo Entertainment System", "Nintendo - Family Computer Disk System"},
+	}, coreInfoDomain.CoreSystems())
+}
+
+func TestCoreInfoDomainSavestates(t *testing.T) {
+	tests := []struct {
+		info       string
+		savestates string
+	}{
+		{`savestate = "false"`, entity.SavestatesNone},
+		{``, entity.SavestatesNone},
+		{`savestate = "true"`, entity.SavestatesDeterministic},
+		{"savestate = \"true\"\nsavestate_features = \"serialized\"", entity.SavestatesSerialized},
+	}
+
+	for _, test := range tests {
+		_, core, err := parseCoreInfo(strings.NewReader(test.info))
+		require.NoError(t, err)
+		assert.Equal(t, test.savestates, core.Savestates, "Info '%s'", test.info)
+		assert.Equal(t, test.savestates == entity.SavestatesDeterministic, core.Netplay, "Info '%s'", test.info)
+	}
+}
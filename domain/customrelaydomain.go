@@ -0,0 +1,238 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidCustomRelay is thrown when a host announces a custom relay that clients shouldn't be sent to.
+var ErrInvalidCustomRelay = errors.New("Invalid custom relay")
+
+// CustomRelayCacheTTL is how long the resolution and the probe of a custom relay are reused, failed ones as well.
+const CustomRelayCacheTTL = 5 * time.Minute
+
+// maxCustomRelayCacheSize is the amount of cached relays above which the expired ones are dropped.
+const maxCustomRelayCacheSize = 4096
+
+// customRelayCacheEntry is the cached resolution and probe of a custom relay.
+type customRelayCacheEntry struct {
+	addresses  []net.IPAddr
+	resolveErr error
+	probed     bool
+	probeErr   error
+	expires    time.Time
+}
+
+// ipResolver resolves host names, net.Resolver implements it.
+type ipResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// CustomRelayDomain validates the relays hosts bring along with mitm_server=custom. Every client joining the
+// room connects to the custom relay, so it must not point at private networks or blacklisted addresses.
+// The resolutions and probes are cached, so only the first request of a relay waits for them.
+type CustomRelayDomain struct {
+	validationDomain *ValidationDomain
+	resolver         ipResolver
+	domains          []string // Normalized allowlist of domains
+	config           LobbyConfig
+	mutex            sync.Mutex
+	cache            map[string]customRelayCacheEntry // By "host:port"
+}
+
+// NewCustomRelayDomain creates a new custom relay validation from a validated configuration.
+func NewCustomRelayDomain(validationDomain *ValidationDomain, config LobbyConfig) *CustomRelayDomain {
+	domains := make([]string, len(config.CustomRelayDomains))
+	for i, domain := range config.CustomRelayDomains {
+		domains[i] = strings.TrimPrefix(normalizeHost(domain), ".")
+	}
+
+	return &CustomRelayDomain{
+		validationDomain: validationDomain,
+		resolver:         net.DefaultResolver,
+		domains:          domains,
+		config:           config,
+		cache:            make(map[string]customRelayCacheEntry),
+	}
+}
+
+// Validate checks that the custom relay is in one of the allowed domains, only resolves to public addresses
+// outside the IP blacklist and, if enabled, accepts connections on its port. It returns the validated address the
+// room needs to be published with, so the relay's DNS can't point the clients elsewhere later on.
+// Returns an error wrapping ErrInvalidCustomRelay otherwise.
+func (d *CustomRelayDomain) Validate(host string, port uint16) (net.IP, error) {
+	host = normalizeHost(host)
+	if host == "" || port == 0 {
+		return nil, fmt.Errorf("%w: host and port need to be set", ErrInvalidCustomRelay)
+	}
+	if len(d.domains) > 0 && !d.isAllowed(host) {
+		return nil, fmt.Errorf("%w: %s is not in an allowed domain", ErrInvalidCustomRelay, host)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.CustomRelayTimeout)
+	defer cancel()
+
+	key := net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10))
+	entry, found := d.cached(key, time.Now())
+	if !found {
+		entry.addresses, entry.resolveErr = d.resolver.LookupIPAddr(ctx, host)
+		d.store(key, entry)
+	}
+
+	if entry.resolveErr != nil {
+		return nil, fmt.Errorf("%w: can't resolve %s: %v", ErrInvalidCustomRelay, host, entry.resolveErr)
+	}
+	if len(entry.addresses) == 0 {
+		return nil, fmt.Errorf("%w: %s has no addresses", ErrInvalidCustomRelay, host)
+	}
+
+	// Every address counts, clients might connect to any of them. The blacklist can change, so the cached
+	// addresses are checked every time.
+	for _, address := range entry.addresses {
+		if !isPublicIP(address.IP) {
+			return nil, fmt.Errorf("%w: %s resolves to the non-public address %s", ErrInvalidCustomRelay, host, address.IP)
+		}
+		if !d.validationDomain.ValdateIP(address.IP) {
+			return nil, fmt.Errorf("%w: %s resolves to the blacklisted address %s", ErrInvalidCustomRelay, host, address.IP)
+		}
+	}
+
+	if d.config.CustomRelayProbe {
+		if !entry.probed {
+			entry.probeErr = d.probe(ctx, entry.addresses[0].IP, port)
+			entry.probed = true
+			d.store(key, entry)
+		}
+		if entry.probeErr != nil {
+			return nil, fmt.Errorf("%w: %s doesn't accept connections on port %d: %v", ErrInvalidCustomRelay, host, port, entry.probeErr)
+		}
+	}
+
+	return entry.addresses[0].IP, nil
+}
+
+// cached returns the unexpired cache entry of the relay.
+func (d *CustomRelayDomain) cached(key string, now time.Time) (customRelayCacheEntry, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	entry, found := d.cache[key]
+	if !found || !now.Before(entry.expires) {
+		return customRelayCacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+// store caches the entry of the relay and drops the expired ones once the cache is full. New entries expire
+// after CustomRelayCacheTTL.
+func (d *CustomRelayDomain) store(key string, entry customRelayCacheEntry) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := time.Now()
+	if entry.expires.IsZero() {
+		entry.expires = now.Add(CustomRelayCacheTTL)
+	}
+
+	if len(d.cache) >= maxCustomRelayCacheSize {
+		for k, e := range d.cache {
+			if !now.Before(e.expires) {
+				delete(d.cache, k)
+			}
+		}
+	}
+	if len(d.cache) >= maxCustomRelayCacheSize {
+		d.cache = make(map[string]customRelayCacheEntry)
+	}
+
+	d.cache[key] = entry
+}
+
+// isAllowed returns whether the host is one of the allowed domains or a subdomain of them.
+// IP addresses are never allowed.
+func (d *CustomRelayDomain) isAllowed(host string) bool {
+	if net.ParseIP(host) != nil {
+		return false
+	}
+
+	for _, domain := range d.domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// probe connects to the relay port.
+func (d *CustomRelayDomain) probe(ctx context.Context, ip net.IP, port uint16) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), strconv.FormatUint(uint64(port), 10)))
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+// specialPurposeNetworks holds the ranges of the IANA special-purpose address registries that aren't globally
+// reachable, together with multicast and the reserved ranges. IPv4-mapped IPv6 addresses are looked up as IPv4.
+var specialPurposeNetworks = newSpecialPurposeTrie([]string{
+	"0.0.0.0/8",       // This network
+	"10.0.0.0/8",      // Private use
+	"100.64.0.0/10",   // Shared address space (carrier-grade NAT)
+	"127.0.0.0/8",     // Loopback
+	"169.254.0.0/16",  // Link local
+	"172.16.0.0/12",   // Private use
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // Documentation (TEST-NET-1)
+	"192.88.99.0/24",  // Deprecated 6to4 relay anycast
+	"192.168.0.0/16",  // Private use
+	"198.18.0.0/15",   // Benchmarking
+	"198.51.100.0/24", // Documentation (TEST-NET-2)
+	"203.0.113.0/24",  // Documentation (TEST-NET-3)
+	"224.0.0.0/4",     // Multicast
+	"240.0.0.0/4",     // Reserved, includes the limited broadcast address
+	"::/96",           // Unspecified, loopback and the deprecated IPv4-compatible addresses
+	"64:ff9b:1::/48",  // Local-use IPv4/IPv6 translation
+	"100::/64",        // Discard-only
+	"2001::/23",       // IETF protocol assignments
+	"2001:db8::/32",   // Documentation
+	"2002::/16",       // 6to4, embeds IPv4 addresses
+	"3fff::/20",       // Documentation
+	"5f00::/16",       // Segment routing SIDs
+	"fc00::/7",        // Unique local
+	"fe80::/10",       // Link local
+	"fec0::/10",       // Deprecated site local
+	"ff00::/8",        // Multicast
+})
+
+// newSpecialPurposeTrie builds the trie of the given ranges, which need to be valid.
+func newSpecialPurposeTrie(entries []string) *ipTrie {
+	trie := newIPTrie()
+	for _, entry := range entries {
+		network, err := parseIPNetwork(entry)
+		if err != nil {
+			panic(err)
+		}
+		trie.Insert(network)
+	}
+	return trie
+}
+
+// isPublicIP returns whether the IP is a globally reachable unicast address.
+func isPublicIP(ip net.IP) bool {
+	return ip != nil && !specialPurposeNetworks.Contains(ip)
+}
+
+// normalizeHost lowercases a host name and strips the trailing dot of fully qualified names.
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
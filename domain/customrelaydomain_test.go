@@ -0,0 +1,170 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticResolver resolves host names from a fixed table and IP addresses to themselves.
+type staticResolver map[string][]string
+
+func (r staticResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IPAddr{{IP: ip}}, nil
+	}
+
+	entries, found := r[host]
+	if !found {
+		return nil, errors.New("no such host")
+	}
+
+	addresses := make([]net.IPAddr, len(entries))
+	for i, entry := range entries {
+		addresses[i] = net.IPAddr{IP: net.ParseIP(entry)}
+	}
+	return addresses, nil
+}
+
+var testResolver = staticResolver{
+	"relay.example.com":       {"1.1.1.1", "2606:4700:4700::1111"},
+	"eu.relay.example.com":    {"8.8.8.8"},
+	"relay.example.org":       {"9.9.9.9"},
+	"private.example.com":     {"1.1.1.1", "192.168.1.10"},
+	"blacklisted.example.com": {"2001:db8:0:8d3:0:8a2e:70:7344"},
+}
+
+func setupCustomRelayDomain(t *testing.T, domains []string) *CustomRelayDomain {
+	validationDomain, err := NewValidationDomain(testStringBlacklist, testIPBlacklist)
+	require.NoError(t, err)
+
+	config := DefaultLobbyConfig()
+	config.CustomRelayDomains = domains
+
+	customRelayDomain := NewCustomRelayDomain(validationDomain, config)
+	customRelayDomain.resolver = testResolver
+	return customRelayDomain
+}
+
+func TestCustomRelayDomainValidate(t *testing.T) {
+	customRelayDomain := setupCustomRelayDomain(t, nil)
+
+	for _, host := range []string{"relay.example.com", "Relay.Example.com.", "1.1.1.1", "2606:4700:4700::1111"} {
+		_, err := customRelayDomain.Validate(host, 55435)
+		assert.NoError(t, err, "Relay %s was rejected", host)
+	}
+
+	invalid := []struct {
+		host string
+		port uint16
+	}{
+		{"", 55435},
+		{"relay.example.com", 0},
+		{"unknown.example.com", 55435},
+		{"private.example.com", 55435},
+		{"blacklisted.example.com", 55435},
+		{"127.0.0.2", 55435},
+		{"10.0.0.1", 55435},
+		{"169.254.1.1", 55435},
+		{"0.0.0.0", 55435},
+		{"::1", 55435},
+		{"fe80::1", 55435},
+		{"fd00::1", 55435},
+		{"224.0.0.1", 55435},
+		{"100.64.0.1", 55435},
+		{"192.0.0.8", 55435},
+		{"198.18.0.1", 55435},
+		{"203.0.113.1", 55435},
+		{"240.0.0.1", 55435},
+		{"255.255.255.255", 55435},
+		{"::ffff:10.0.0.1", 55435},
+		{"::10.0.0.1", 55435},
+		{"2001:db8::1", 55435},
+		{"2002:a00:1::1", 55435},
+		{"64:ff9b:1::a00:1", 55435},
+	}
+	for _, relay := range invalid {
+		_, err := customRelayDomain.Validate(relay.host, relay.port)
+		assert.True(t, errors.Is(err, ErrInvalidCustomRelay), "Relay %s:%d wasn't rejected", relay.host, relay.port)
+	}
+}
+
+func TestCustomRelayDomainAllowlist(t *testing.T) {
+	customRelayDomain := setupCustomRelayDomain(t, []string{"Relay.Example.com."})
+
+	address, err := customRelayDomain.Validate("relay.example.com", 55435)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.1.1.1", address.String())
+	address, err = customRelayDomain.Validate("eu.relay.example.com", 55435)
+	assert.NoError(t, err)
+	assert.Equal(t, "8.8.8.8", address.String())
+
+	for _, host := range []string{"relay.example.org", "evilrelay.example.com", "1.1.1.1"} {
+		_, err := customRelayDomain.Validate(host, 55435)
+		assert.True(t, errors.Is(err, ErrInvalidCustomRelay), "Relay %s wasn't rejected", host)
+	}
+}
+
+func TestCustomRelayDomainProbe(t *testing.T) {
+	customRelayDomain := setupCustomRelayDomain(t, nil)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+
+	assert.NoError(t, customRelayDomain.probe(context.Background(), net.ParseIP("127.0.0.1"), port))
+
+	listener.Close()
+	assert.Error(t, customRelayDomain.probe(context.Background(), net.ParseIP("127.0.0.1"), port))
+}
+
+// countingResolver counts the lookups of the wrapped resolver.
+type countingResolver struct {
+	ipResolver
+	lookups int
+}
+
+func (r *countingResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.lookups++
+	return r.ipResolver.LookupIPAddr(ctx, host)
+}
+
+func TestCustomRelayDomainCache(t *testing.T) {
+	customRelayDomain := setupCustomRelayDomain(t, nil)
+	resolver := &countingResolver{ipResolver: testResolver}
+	customRelayDomain.resolver = resolver
+
+	_, err := customRelayDomain.Validate("relay.example.com", 55435)
+	assert.NoError(t, err)
+	_, err = customRelayDomain.Validate("Relay.Example.com.", 55435)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, resolver.lookups, "The resolution wasn't cached")
+
+	// Failed resolutions are cached as well
+	for i := 0; i < 2; i++ {
+		_, err := customRelayDomain.Validate("unknown.example.com", 55435)
+		assert.True(t, errors.Is(err, ErrInvalidCustomRelay))
+	}
+	assert.Equal(t, 2, resolver.lookups)
+
+	// The cached addresses are checked against the current blacklist
+	require.NoError(t, customRelayDomain.validationDomain.Reload(testStringBlacklist, []string{"1.1.1.1"}))
+	_, err = customRelayDomain.Validate("relay.example.com", 55435)
+	assert.True(t, errors.Is(err, ErrInvalidCustomRelay), "Newly blacklisted relay wasn't rejected")
+
+	// Expired entries are resolved again
+	for key, entry := range customRelayDomain.cache {
+		entry.expires = time.Now()
+		customRelayDomain.cache[key] = entry
+	}
+	require.NoError(t, customRelayDomain.validationDomain.Reload(testStringBlacklist, testIPBlacklist))
+	_, err = customRelayDomain.Validate("relay.example.com", 55435)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, resolver.lookups)
+}
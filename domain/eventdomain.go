@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"sync"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// EventBufferSize is the default amount of events buffered per subscriber.
+const EventBufferSize = 64
+
+// SessionEventType enum
+type SessionEventType string
+
+// SessionEventType enum values
+const (
+	SessionCreated SessionEventType = "created"
+	SessionUpdated SessionEventType = "updated"
+	SessionTouched SessionEventType = "touched"
+	SessionPurged  SessionEventType = "purged"
+	SessionRemoved SessionEventType = "removed"
+)
+
+// SessionEvent is published whenever a session changes.
+type SessionEvent struct {
+	Type    SessionEventType
+	Session entity.Session
+}
+
+// Subscription receives session events from the EventDomain.
+type Subscription struct {
+	events chan SessionEvent
+}
+
+// Events returns the event channel. The channel gets closed when the subscriber is removed
+// or couldn't keep up with the published events.
+func (s *Subscription) Events() <-chan SessionEvent {
+	return s.events
+}
+
+// EventDomain is an in-process publish/subscribe bus for session events.
+type EventDomain struct {
+	mutex       sync.Mutex
+	bufferSize  int
+	subscribers map[*Subscription]struct{}
+	fed         bool // Whether the events come from the database, see EventFeedDomain
+}
+
+// NewEventDomain creates a new event bus with the given per subscriber buffer size.
+func NewEventDomain(bufferSize int) *EventDomain {
+	return &EventDomain{bufferSize: bufferSize, subscribers: make(map[*Subscription]struct{})}
+}
+
+// Subscribe adds a new subscriber. The subscription needs to be removed with Unsubscribe.
+func (d *EventDomain) Subscribe() *Subscription {
+	s := &Subscription{make(chan SessionEvent, d.bufferSize)}
+
+	d.mutex.Lock()
+	d.subscribers[s] = struct{}{}
+	d.mutex.Unlock()
+
+	return s
+}
+
+// Unsubscribe removes a subscriber and closes its event channel.
+func (d *EventDomain) Unsubscribe(s *Subscription) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.remove(s)
+}
+
+// Publish sends the event to all subscribers without blocking. Subscribers with a full buffer
+// are removed, so they can resubscribe and start over with a fresh snapshot. Buses fed from the
+// database ignore the published events, the feed publishes them once it finds them persisted.
+func (d *EventDomain) Publish(event SessionEvent) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if !d.fed {
+		d.send(event)
+	}
+}
+
+// send needs to be called with the mutex held.
+func (d *EventDomain) send(event SessionEvent) {
+	for s := range d.subscribers {
+		select {
+		case s.events <- event:
+		default:
+			d.remove(s)
+		}
+	}
+}
+
+// remove needs to be called with the mutex held.
+func (d *EventDomain) remove(s *Subscription) {
+	if _, found := d.subscribers[s]; found {
+		delete(d.subscribers, s)
+		close(s.events)
+	}
+}
@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventDomainPublish(t *testing.T) {
+	eventDomain := NewEventDomain(2)
+	subscription1 := eventDomain.Subscribe()
+	subscription2 := eventDomain.Subscribe()
+
+	eventDomain.Publish(SessionEvent{SessionCreated, testSession})
+
+	event := <-subscription1.Events()
+	assert.Equal(t, SessionCreated, event.Type)
+	assert.Equal(t, testSession.Username, event.Session.Username)
+
+	event = <-subscription2.Events()
+	assert.Equal(t, SessionCreated, event.Type)
+}
+
+func TestEventDomainUnsubscribe(t *testing.T) {
+	eventDomain := NewEventDomain(2)
+	subscription := eventDomain.Subscribe()
+
+	eventDomain.Unsubscribe(subscription)
+	eventDomain.Publish(SessionEvent{SessionCreated, testSession})
+
+	_, ok := <-subscription.Events()
+	assert.False(t, ok, "Channel should be closed after unsubscribe")
+
+	// Unsubscribing twice should be safe
+	eventDomain.Unsubscribe(subscription)
+}
+
+func TestEventDomainDropsSlowSubscriber(t *testing.T) {
+	eventDomain := NewEventDomain(1)
+	slow := eventDomain.Subscribe()
+
+	eventDomain.Publish(SessionEvent{SessionCreated, testSession})
+	eventDomain.Publish(SessionEvent{SessionUpdated, testSession})
+
+	event, ok := <-slow.Events()
+	assert.True(t, ok)
+	assert.Equal(t, SessionCreated, event.Type)
+
+	_, ok = <-slow.Events()
+	assert.False(t, ok, "Slow subscriber should have been removed")
+}
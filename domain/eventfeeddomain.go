@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// EventFeedDomain feeds an EventDomain from the session table, so the event streams of every replica see the
+// changes made at the other replicas as well. It polls the active sessions and publishes the differences to the
+// previous poll, so events arrive up to one poll interval late and changes in between polls are merged.
+type EventFeedDomain struct {
+	sessionRepo SessionRepository
+	eventDomain *EventDomain
+	config      LobbyConfig
+	logger      Logger
+	known       map[string]entity.Session // Sessions of the previous poll by ID, nil before the first poll
+}
+
+// NewEventFeedDomain returns a new feed for the event bus. The bus ignores the events published in process from
+// now on. The polls need to be started with Run.
+func NewEventFeedDomain(sessionRepo SessionRepository, eventDomain *EventDomain, config LobbyConfig, logger Logger) *EventFeedDomain {
+	eventDomain.mutex.Lock()
+	eventDomain.fed = true
+	eventDomain.mutex.Unlock()
+
+	return &EventFeedDomain{
+		sessionRepo: sessionRepo,
+		eventDomain: eventDomain,
+		config:      config,
+		logger:      logger,
+	}
+}
+
+// Run polls the sessions in the event poll interval until the context gets canceled.
+func (d *EventFeedDomain) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.EventPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Poll(); err != nil {
+			d.logger.Errorf("Can't poll session events: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll publishes the session changes since the previous poll. The first poll only records the current sessions.
+// Sessions that are gone count as purged once they are past the deadline and as removed before.
+func (d *EventFeedDomain) Poll() error {
+	deadline := time.Now().Add(-d.config.SessionDeadline)
+	sessions, err := d.sessionRepo.GetAll(deadline)
+	if err != nil {
+		return fmt.Errorf("can't get sessions: %w", err)
+	}
+
+	current := make(map[string]entity.Session, len(sessions))
+	for _, s := range sessions {
+		current[s.ID] = s
+	}
+
+	if d.known != nil {
+		d.eventDomain.mutex.Lock()
+		for _, s := range sessions {
+			previous, found := d.known[s.ID]
+			if !found {
+				d.eventDomain.send(SessionEvent{SessionCreated, s})
+			} else if eventType, changed := sessionChange(&previous, &s); changed {
+				d.eventDomain.send(SessionEvent{eventType, s})
+			}
+		}
+		for id, s := range d.known {
+			if _, found := current[id]; found {
+				continue
+			}
+			if s.UpdatedAt.After(deadline) {
+				d.eventDomain.send(SessionEvent{SessionRemoved, s})
+			} else {
+				d.eventDomain.send(SessionEvent{SessionPurged, s})
+			}
+		}
+		d.eventDomain.mutex.Unlock()
+	}
+	d.known = current
+
+	return nil
+}
+
+// sessionChange returns the type of the change between two states of a session and whether it changed at all.
+func sessionChange(previous *entity.Session, s *entity.Session) (SessionEventType, bool) {
+	switch {
+	case previous.ContentHash != s.ContentHash,
+		previous.Connectable != s.Connectable,
+		previous.IsRetroArch != s.IsRetroArch,
+		previous.ProtocolVersion != s.ProtocolVersion,
+		previous.RequiresPassword != s.RequiresPassword,
+		previous.ProbeMismatch != s.ProbeMismatch:
+		return SessionUpdated, true
+	case !previous.UpdatedAt.Equal(s.UpdatedAt),
+		previous.PlayerCount != s.PlayerCount,
+		previous.SpectatorCount != s.SpectatorCount:
+		return SessionTouched, true
+	}
+
+	return "", false
+}
@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+func TestEventFeedDomainPoll(t *testing.T) {
+	repoMock := &SessionRepositoryMock{}
+	eventDomain := NewEventDomain(EventBufferSize)
+	feed := NewEventFeedDomain(repoMock, eventDomain, DefaultLobbyConfig(), &testLogger{})
+	subscription := eventDomain.Subscribe()
+
+	kept := testSession
+	kept.ID = "kept"
+	kept.UpdatedAt = time.Now().Add(-10 * time.Second)
+	removed := kept
+	removed.ID = "removed"
+	purged := testSession
+	purged.ID = "purged"
+	purged.UpdatedAt = time.Now().Add(-2 * SessionDeadline * time.Second)
+
+	// The first poll only records the sessions
+	repoMock.On("GetAll", mock.Anything).Return([]entity.Session{kept, removed, purged}, nil).Once()
+	require.NoError(t, feed.Poll())
+	assert.Empty(t, subscription.Events())
+
+	// In process events are left to the feed
+	eventDomain.Publish(SessionEvent{SessionCreated, testSession})
+	assert.Empty(t, subscription.Events())
+
+	created := kept
+	created.ID = "created"
+	updated := kept
+	updated.Connectable = false
+	repoMock.On("GetAll", mock.Anything).Return([]entity.Session{created, updated}, nil).Once()
+	require.NoError(t, feed.Poll())
+
+	events := map[string]SessionEventType{}
+	for len(subscription.Events()) > 0 {
+		event := <-subscription.Events()
+		events[event.Session.ID] = event.Type
+	}
+	assert.Equal(t, map[string]SessionEventType{
+		"created": SessionCreated,
+		"kept":    SessionUpdated,
+		"removed": SessionRemoved,
+		"purged":  SessionPurged,
+	}, events)
+
+	touched := updated
+	touched.UpdatedAt = time.Now()
+	repoMock.On("GetAll", mock.Anything).Return([]entity.Session{created, touched}, nil).Once()
+	require.NoError(t, feed.Poll())
+	event := <-subscription.Events()
+	assert.Equal(t, SessionTouched, event.Type)
+	assert.Equal(t, "kept", event.Session.ID)
+	assert.Empty(t, subscription.Events())
+}
+
+func TestEventFeedDomainPollError(t *testing.T) {
+	repoMock := &SessionRepositoryMock{}
+	feed := NewEventFeedDomain(repoMock, NewEventDomain(EventBufferSize), DefaultLobbyConfig(), &testLogger{})
+
+	repoMock.On("GetAll", mock.Anything).Return(nil, errors.New("test error"))
+	assert.Error(t, feed.Poll())
+}
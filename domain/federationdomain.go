@@ -0,0 +1,294 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// FederationPath is the path of the endpoint the local sessions are exported at, see FederationController.
+const FederationPath = "/federation/sessions"
+
+// federationMaxResponse is the maximal size of the session list of a peer.
+const federationMaxResponse = 16 << 20
+
+// PeerConfig configures a peer lobby whose sessions are mirrored.
+type PeerConfig struct {
+	Name  string // Origin of the mirrored sessions, shown to the clients
+	URL   string // Base URL of the peer lobby, like "https://eu.lobby.example.com"
+	Token string // Bearer token of the federation endpoint of the peer
+}
+
+// ValidatePeers checks the peer configuration for invalid values. With peers, the federation interval of the
+// lobby configuration needs to be shorter than the session deadline, so mirrored sessions don't expire between
+// two pulls.
+func ValidatePeers(peers []PeerConfig, config LobbyConfig) error {
+	if len(peers) > 0 && config.FederationInterval >= config.SessionDeadline {
+		return fmt.Errorf("federation interval needs to be shorter than the session deadline of %s", config.SessionDeadline)
+	}
+
+	names := make(map[string]struct{}, len(peers))
+	for _, p := range peers {
+		if p.Name == "" || len(p.Name) > 64 {
+			return fmt.Errorf("invalid peer name '%s'", p.Name)
+		}
+		if _, found := names[p.Name]; found {
+			return fmt.Errorf("duplicate peer name '%s'", p.Name)
+		}
+		names[p.Name] = struct{}{}
+
+		if u, err := url.Parse(p.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("peer %s has an invalid URL '%s'", p.Name, p.URL)
+		}
+		if p.Token == "" {
+			return fmt.Errorf("peer %s needs a token", p.Name)
+		}
+	}
+
+	return nil
+}
+
+// FederationDomain mirrors the sessions of peer lobbies, so the players of every lobby see all rooms. The local
+// sessions are exported to the peers and the sessions of the peers are pulled periodically. Mirrored sessions are
+// stored with their origin and get their own RoomID, they are removed as soon as the peer stops listing them.
+// Only the replica holding the federation lease pulls.
+type FederationDomain struct {
+	peers            []PeerConfig
+	sessionRepo      SessionRepository
+	validationDomain *ValidationDomain
+	eventDomain      *EventDomain
+	leaseDomain      *LeaseDomain
+	config           LobbyConfig
+	logger           Logger
+	client           *http.Client
+}
+
+// NewFederationDomain creates a new federation domain. The pulls need to be started with Run.
+func NewFederationDomain(
+	peers []PeerConfig,
+	sessionRepo SessionRepository,
+	validationDomain *ValidationDomain,
+	eventDomain *EventDomain,
+	leaseDomain *LeaseDomain,
+	config LobbyConfig,
+	logger Logger) *FederationDomain {
+	return &FederationDomain{
+		peers:            peers,
+		sessionRepo:      sessionRepo,
+		validationDomain: validationDomain,
+		eventDomain:      eventDomain,
+		leaseDomain:      leaseDomain,
+		config:           config,
+		logger:           logger,
+		client:           &http.Client{Timeout: config.FederationTimeout},
+	}
+}
+
+// Export returns the local sessions that are currently being hosted. Mirrored sessions aren't exported again,
+// so peers that mirror each other don't loop.
+func (d *FederationDomain) Export() ([]entity.Session, error) {
+	sessions, err := d.sessionRepo.GetAll(time.Now().Add(-d.config.SessionDeadline))
+	if err != nil {
+		return nil, err
+	}
+
+	local := make([]entity.Session, 0, len(sessions))
+	for _, s := range sessions {
+		if s.Origin == "" {
+			local = append(local, s)
+		}
+	}
+
+	return local, nil
+}
+
+// Run pulls the sessions of all peers periodically until the context gets canceled.
+func (d *FederationDomain) Run(ctx context.Context) {
+	if len(d.peers) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(d.config.FederationInterval)
+	defer ticker.Stop()
+
+	for {
+		d.pullAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pullAll pulls the sessions of all peers concurrently if this replica holds the federation lease.
+func (d *FederationDomain) pullAll(ctx context.Context) {
+	leader, err := d.leaseDomain.Acquire(FederationLease, d.config.FederationInterval)
+	if err != nil {
+		d.logger.Errorf("Can't acquire federation lease: %v", err)
+		return
+	}
+	if !leader {
+		return
+	}
+
+	var pulls sync.WaitGroup
+
+	for _, p := range d.peers {
+		pulls.Add(1)
+		go func(p PeerConfig) {
+			defer pulls.Done()
+			d.pull(ctx, p)
+		}(p)
+	}
+
+	pulls.Wait()
+}
+
+// pull mirrors the sessions of a peer. The sessions of an unreachable peer are kept until they reach the
+// session deadline.
+func (d *FederationDomain) pull(ctx context.Context, peer PeerConfig) {
+	sessions, err := d.fetch(ctx, peer)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.logger.Errorf("Can't pull sessions of peer %s: %v", peer.Name, err)
+		}
+		if err = d.expire(peer.Name); err != nil {
+			d.logger.Errorf("Can't expire sessions of peer %s: %v", peer.Name, err)
+		}
+		return
+	}
+
+	if err = d.mirror(peer.Name, sessions); err != nil {
+		d.logger.Errorf("Can't mirror sessions of peer %s: %v", peer.Name, err)
+	}
+}
+
+// fetch requests the local sessions of a peer.
+func (d *FederationDomain) fetch(ctx context.Context, peer PeerConfig) ([]entity.Session, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(peer.URL, "/")+FederationPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+peer.Token)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var sessions []entity.Session
+	if err = json.NewDecoder(io.LimitReader(resp.Body, federationMaxResponse)).Decode(&sessions); err != nil {
+		return nil, fmt.Errorf("can't decode session list: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// mirror replaces the stored sessions of the origin with the given ones. Sessions that the local blacklists
+// reject or that the peer itself mirrors are skipped.
+func (d *FederationDomain) mirror(origin string, sessions []entity.Session) error {
+	stored, err := d.sessionRepo.GetByOrigin(origin)
+	if err != nil {
+		return err
+	}
+
+	saved := make(map[string]*entity.Session, len(stored))
+	for i := range stored {
+		saved[stored[i].ID] = &stored[i]
+	}
+
+	now := time.Now()
+	seen := make(map[string]struct{}, len(sessions))
+	for _, s := range sessions {
+		if s.Origin != "" || s.IP == nil || s.Port == 0 ||
+			!d.validationDomain.ValdateIP(s.IP) ||
+			!isValidSession(&s, &d.config.MaxLength, d.validationDomain) {
+			continue
+		}
+
+		s.Origin = origin
+		s.CalculateOriginID(s.RoomID)
+		if _, found := seen[s.ID]; found {
+			continue
+		}
+		seen[s.ID] = struct{}{}
+
+		// Only the origin knows the relay handle, the room token and the peaks
+		s.MitmHandle = ""
+		s.TokenHash = ""
+		s.TokenRequired = false
+		s.JoinTicket = ""
+		s.PeakPlayerCount = s.PlayerCount
+		s.PeakSpectatorCount = s.SpectatorCount
+		s.CalculateContentHash()
+		s.UpdatedAt = now
+
+		var eventType SessionEventType
+		if savedSession, found := saved[s.ID]; found {
+			delete(saved, s.ID)
+			s.RoomID = savedSession.RoomID
+			if err = d.sessionRepo.Update(&s); err != nil {
+				return err
+			}
+			eventType = SessionTouched
+			if savedSession.ContentHash != s.ContentHash {
+				eventType = SessionUpdated
+			}
+		} else {
+			s.RoomID = 0
+			if err = d.sessionRepo.Create(&s); err != nil {
+				return err
+			}
+			eventType = SessionCreated
+		}
+		d.eventDomain.Publish(SessionEvent{eventType, s})
+	}
+
+	for _, s := range stored {
+		if _, found := saved[s.ID]; !found {
+			continue
+		}
+		if err = d.sessionRepo.DeleteByRoomID(s.RoomID); err != nil {
+			return err
+		}
+		d.eventDomain.Publish(SessionEvent{SessionRemoved, s})
+	}
+
+	return nil
+}
+
+// expire removes the stored sessions of the origin that reached the session deadline.
+func (d *FederationDomain) expire(origin string) error {
+	stored, err := d.sessionRepo.GetByOrigin(origin)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(-d.config.SessionDeadline)
+	for _, s := range stored {
+		if s.UpdatedAt.After(deadline) {
+			continue
+		}
+		if err = d.sessionRepo.DeleteByRoomID(s.RoomID); err != nil {
+			return err
+		}
+		d.eventDomain.Publish(SessionEvent{SessionPurged, s})
+	}
+
+	return nil
+}
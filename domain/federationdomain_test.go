@@ -0,0 +1,156 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+const testPeerToken = "peersecret"
+
+func setupFederationDomain(t *testing.T, sessions []entity.Session) (*FederationDomain, *SessionRepositoryMock, PeerConfig) {
+	federationDomain, repoMock, _, peerConfig := setupFederationDomainWithLease(t, sessions)
+	return federationDomain, repoMock, peerConfig
+}
+
+func setupFederationDomainWithLease(t *testing.T, sessions []entity.Session) (*FederationDomain, *SessionRepositoryMock, *LeaseRepositoryMock, PeerConfig) {
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != FederationPath || r.Header.Get("Authorization") != "Bearer "+testPeerToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(sessions)
+	}))
+	t.Cleanup(peer.Close)
+
+	validationDomain, err := NewValidationDomain(testStringBlacklist, testIPBlacklist)
+	require.NoError(t, err)
+
+	repoMock := &SessionRepositoryMock{}
+	leaseDomain, leaseRepoMock := setupLeaseDomain(t)
+	peerConfig := PeerConfig{"eu", peer.URL + "/", testPeerToken}
+	federationDomain := NewFederationDomain([]PeerConfig{peerConfig}, repoMock, validationDomain, NewEventDomain(EventBufferSize), leaseDomain, DefaultLobbyConfig(), &testLogger{})
+
+	return federationDomain, repoMock, leaseRepoMock, peerConfig
+}
+
+func TestFederationDomainExport(t *testing.T) {
+	federationDomain, repoMock, _ := setupFederationDomain(t, nil)
+
+	mirrored := testSession
+	mirrored.Origin = "us"
+	repoMock.On("GetAll", mock.AnythingOfType("time.Time")).Return([]entity.Session{testSession, mirrored}, nil)
+
+	sessions, err := federationDomain.Export()
+	require.NoError(t, err)
+	assert.Equal(t, []entity.Session{testSession}, sessions)
+}
+
+func TestFederationDomainPull(t *testing.T) {
+	known := testSession
+	known.RoomID = 1
+	known.IP = net.ParseIP("1.1.1.1")
+	known.CreatedAt = time.Now().Add(-time.Hour).Round(0)
+	known.UpdatedAt = time.Now().Round(0)
+	added := known
+	added.RoomID = 2
+	added.Username = "link"
+	mirrored := known
+	mirrored.RoomID = 3
+	mirrored.Origin = "us"
+	blacklisted := known
+	blacklisted.RoomID = 4
+	blacklisted.IP = net.ParseIP("127.0.0.1")
+
+	federationDomain, repoMock, peer := setupFederationDomain(t, []entity.Session{known, added, mirrored, blacklisted})
+	subscription := federationDomain.eventDomain.Subscribe()
+
+	stored := known
+	stored.Origin = "eu"
+	stored.CalculateOriginID(1)
+	stored.CalculateContentHash()
+	stored.RoomID = 100
+	gone := stored
+	gone.CalculateOriginID(5)
+	gone.RoomID = 101
+	repoMock.On("GetByOrigin", "eu").Return([]entity.Session{stored, gone}, nil)
+	repoMock.On("Update", mock.MatchedBy(func(s *entity.Session) bool {
+		return s.ID == stored.ID && s.RoomID == 100 && s.Origin == "eu" && s.CreatedAt.Equal(known.CreatedAt)
+	})).Return(nil)
+	repoMock.On("Create", mock.MatchedBy(func(s *entity.Session) bool {
+		return s.Username == "link" && s.RoomID == 0 && s.Origin == "eu" && s.ID != stored.ID
+	})).Return(nil)
+	repoMock.On("DeleteByRoomID", int32(101)).Return(nil)
+
+	federationDomain.pull(context.Background(), peer)
+	repoMock.AssertExpectations(t)
+	repoMock.AssertNumberOfCalls(t, "Create", 1)
+
+	events := []SessionEventType{}
+	for len(subscription.Events()) > 0 {
+		events = append(events, (<-subscription.Events()).Type)
+	}
+	assert.Equal(t, []SessionEventType{SessionTouched, SessionCreated, SessionRemoved}, events)
+}
+
+func TestFederationDomainPullError(t *testing.T) {
+	federationDomain, repoMock, peer := setupFederationDomain(t, nil)
+	peer.Token = "wrong"
+
+	fresh := testSession
+	fresh.Origin = "eu"
+	fresh.RoomID = 100
+	fresh.UpdatedAt = time.Now()
+	old := fresh
+	old.RoomID = 101
+	old.UpdatedAt = time.Now().Add(-2 * time.Minute)
+	repoMock.On("GetByOrigin", "eu").Return([]entity.Session{fresh, old}, nil)
+	repoMock.On("DeleteByRoomID", int32(101)).Return(nil)
+
+	federationDomain.pull(context.Background(), peer)
+	repoMock.AssertExpectations(t)
+	repoMock.AssertNotCalled(t, "DeleteByRoomID", int32(100))
+	assert.Equal(t, 1, federationDomain.logger.(*testLogger).errors)
+}
+
+func TestFederationDomainPullAllFollower(t *testing.T) {
+	federationDomain, repoMock, leaseRepoMock, _ := setupFederationDomainWithLease(t, []entity.Session{testSession})
+
+	// Only the replica holding the lease pulls
+	leaseRepoMock.On("Acquire", FederationLease, federationDomain.leaseDomain.holder, 3*federationDomain.config.FederationInterval).Return(false, nil)
+	federationDomain.pullAll(context.Background())
+	repoMock.AssertNotCalled(t, "GetByOrigin", "eu")
+	leaseRepoMock.AssertExpectations(t)
+}
+
+func TestValidatePeers(t *testing.T) {
+	valid := PeerConfig{"eu", "https://eu.lobby.example.com", "secret"}
+	config := DefaultLobbyConfig()
+	require.NoError(t, ValidatePeers([]PeerConfig{valid}, config))
+
+	invalid := [][]PeerConfig{
+		{{"", "https://eu.lobby.example.com", "secret"}},
+		{valid, valid},
+		{{"eu", "ftp://eu.lobby.example.com", "secret"}},
+		{{"eu", "https://", "secret"}},
+		{{"eu", "https://eu.lobby.example.com", ""}},
+	}
+	for _, peers := range invalid {
+		assert.Error(t, ValidatePeers(peers, config), "Peers %v weren't rejected", peers)
+	}
+
+	// The federation interval only matters with peers
+	config.FederationInterval = config.SessionDeadline
+	assert.NoError(t, ValidatePeers(nil, config))
+	assert.Error(t, ValidatePeers([]PeerConfig{valid}, config))
+}
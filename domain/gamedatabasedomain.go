@@ -0,0 +1,288 @@
+package domain
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The results of a game identification.
+const (
+	GameUnverified = ""         // No game database loaded or no CRC sent
+	GameVerified   = "verified" // The CRC is known and belongs to a system of the core
+	GameUnknown    = "unknown"  // The CRC isn't in the game database
+	GameMismatch   = "mismatch" // The CRC belongs to a system the core doesn't emulate
+)
+
+// GameEntry is a game of the game database.
+type GameEntry struct {
+	Title  string
+	System string
+	Region string
+}
+
+// GameMatch is the result of a game identification.
+type GameMatch struct {
+	GameEntry
+	Status string
+}
+
+// GameDatabaseDomain identifies the games of the sessions by their CRC using libretro-database ClrMamePro
+// DAT files.
+type GameDatabaseDomain struct {
+	games       map[string][]GameEntry // Upper case CRC to the games in the order of the DAT files
+	coreSystems map[string][]string    // Lower case core name to the systems the core emulates
+}
+
+// NewGameDatabaseDomain loads all .dat files in the given directory. The core systems map core names to the
+// names of the systems they emulate as used by the DAT headers, like "Nintendo - Nintendo Entertainment System".
+// Without a path the game database stays empty and no game is identified.
+func NewGameDatabaseDomain(path string, coreSystems map[string][]string) (*GameDatabaseDomain, error) {
+	d := &GameDatabaseDomain{
+		games:       make(map[string][]GameEntry),
+		coreSystems: make(map[string][]string),
+	}
+	for core, systems := range coreSystems {
+		d.addCoreSystems(core, systems)
+	}
+
+	if path == "" {
+		return d, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "*.dat"))
+	if err != nil {
+		return nil, fmt.Errorf("Can't list DAT files in %s: %w", path, err)
+	}
+	for _, file := range files {
+		if err = d.loadFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// addCoreSystems adds systems a core emulates.
+func (d *GameDatabaseDomain) addCoreSystems(core string, systems []string) {
+	core = strings.ToLower(core)
+	d.coreSystems[core] = append(d.coreSystems[core], systems...)
+}
+
+// Identify looks up the game with the given CRC and checks whether the core emulates its system. Cores with
+// unknown systems aren't checked. If the CRC belongs to several systems, the one of the core is preferred.
+func (d *GameDatabaseDomain) Identify(crc string, coreName string) GameMatch {
+	crc = strings.ToUpper(crc)
+	if len(d.games) == 0 || crc == "" || crc == "00000000" {
+		return GameMatch{}
+	}
+
+	entries := d.games[crc]
+	if len(entries) == 0 {
+		return GameMatch{Status: GameUnknown}
+	}
+
+	systems := d.coreSystems[strings.ToLower(coreName)]
+	if len(systems) == 0 {
+		return GameMatch{entries[0], GameVerified}
+	}
+
+	for _, entry := range entries {
+		for _, system := range systems {
+			if strings.EqualFold(entry.System, system) {
+				return GameMatch{entry, GameVerified}
+			}
+		}
+	}
+
+	return GameMatch{entries[0], GameMismatch}
+}
+
+// loadFile adds the games of a DAT file. The system is taken from the header or the file name.
+func (d *GameDatabaseDomain) loadFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("Can't open DAT file %s: %w", file, err)
+	}
+	defer f.Close()
+
+	system := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if err = d.load(f, system); err != nil {
+		return fmt.Errorf("Can't parse DAT file %s: %w", file, err)
+	}
+
+	return nil
+}
+
+// load adds the games of a DAT file. The system defaults to the given one if the header doesn't name it.
+func (d *GameDatabaseDomain) load(r io.Reader, system string) error {
+	nodes, err := parseDat(r)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		if node.key == "clrmamepro" {
+			if name := node.get("name"); name != "" {
+				system = name
+			}
+		}
+	}
+
+	for _, node := range nodes {
+		if node.key != "game" {
+			continue
+		}
+
+		title := node.get("name")
+		if title == "" {
+			title = node.get("description")
+		}
+		region := node.get("region")
+		if region == "" {
+			region = regionFromTitle(title)
+		}
+		entry := GameEntry{title, system, region}
+
+		for _, rom := range node.children {
+			if crc := strings.ToUpper(rom.get("crc")); rom.key == "rom" && crc != "" {
+				d.games[crc] = append(d.games[crc], entry)
+			}
+		}
+	}
+
+	return nil
+}
+
+// regionFromTitle returns the first parenthesized part of a No-Intro style title like "Game (Europe) (Rev 1)".
+func regionFromTitle(title string) string {
+	start := strings.Index(title, "(")
+	end := strings.Index(title, ")")
+	if start < 0 || end < start {
+		return ""
+	}
+	return title[start+1 : end]
+}
+
+// datNode is a "key value" or "key ( children )" entry of a ClrMamePro DAT file.
+type datNode struct {
+	key      string
+	value    string
+	children []datNode
+}
+
+// get returns the value of the first child with the given key.
+func (n *datNode) get(key string) string {
+	for _, child := range n.children {
+		if child.key == key {
+			return child.value
+		}
+	}
+	return ""
+}
+
+// errDatSyntax is thrown for malformed DAT files.
+var errDatSyntax = errors.New("invalid DAT syntax")
+
+// parseDat parses a ClrMamePro DAT file into its top level nodes.
+func parseDat(r io.Reader) ([]datNode, error) {
+	tokens, err := tokenizeDat(r)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, rest, err := parseDatNodes(tokens)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: unexpected ')'", errDatSyntax)
+	}
+
+	return nodes, nil
+}
+
+// datToken is a word, a quoted string or a parenthesis.
+type datToken struct {
+	text   string
+	quoted bool
+}
+
+func (t datToken) is(s string) bool {
+	return !t.quoted && t.text == s
+}
+
+// parseDatNodes parses nodes until the end of the tokens or a closing parenthesis, which is left in the rest.
+func parseDatNodes(tokens []datToken) ([]datNode, []datToken, error) {
+	var nodes []datNode
+	for len(tokens) > 0 && !tokens[0].is(")") {
+		if len(tokens) < 2 || tokens[0].is("(") {
+			return nil, nil, fmt.Errorf("%w: expected a key and a value near '%s'", errDatSyntax, tokens[0].text)
+		}
+
+		node := datNode{key: tokens[0].text}
+		if !tokens[1].is("(") {
+			node.value = tokens[1].text
+			nodes = append(nodes, node)
+			tokens = tokens[2:]
+			continue
+		}
+
+		var err error
+		if node.children, tokens, err = parseDatNodes(tokens[2:]); err != nil {
+			return nil, nil, err
+		}
+		if len(tokens) == 0 {
+			return nil, nil, fmt.Errorf("%w: unclosed block '%s'", errDatSyntax, node.key)
+		}
+		nodes = append(nodes, node)
+		tokens = tokens[1:]
+	}
+
+	return nodes, tokens, nil
+}
+
+// tokenizeDat splits a DAT file into its tokens.
+func tokenizeDat(r io.Reader) ([]datToken, error) {
+	var tokens []datToken
+	reader := bufio.NewReader(r)
+	var word strings.Builder
+
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, datToken{word.String(), false})
+			word.Reset()
+		}
+	}
+
+	for {
+		c, _, err := reader.ReadRune()
+		if err == io.EOF {
+			flush()
+			return tokens, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case c == '"':
+			flush()
+			quoted, err := reader.ReadString('"')
+			if err != nil {
+				return nil, fmt.Errorf("%w: unterminated string", errDatSyntax)
+			}
+			tokens = append(tokens, datToken{strings.TrimSuffix(quoted, `"`), true})
+		case c == '(' || c == ')':
+			flush()
+			tokens = append(tokens, datToken{string(c), false})
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			flush()
+		default:
+			word.WriteRune(c)
+		}
+	}
+}
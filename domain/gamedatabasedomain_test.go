@@ -0,0 +1,130 @@
+package domain
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testNESDat = `clrmamepro (
+	name "Nintendo - Nintendo Entertainment System"
+	description "Nintendo - Nintendo Entertainment System"
+	version 20240101-000000
+)
+
+game (
+	name "Super Mario Bros. (World)"
+	description "Super Mario Bros. (World)"
+	rom ( name "Super Mario Bros. (World).nes" size 40976 crc 3337ec46 md5 811B027EAF99C2DEF7B933C5208636DE )
+)
+
+game (
+	name "Zelda no Densetsu (Japan)"
+	region "Japan"
+	rom ( name "Zelda no Densetsu (Japan).fds" size 131000 crc 3FBD5D6E )
+)
+
+game (
+	name "Shared CRC"
+	rom ( name "shared.nes" size 16 crc 12345678 )
+)
+`
+
+const testSNESDat = `clrmamepro (
+	name "Nintendo - Super Nintendo Entertainment System"
+)
+
+game (
+	name "Super Mario World (USA)"
+	rom ( name "Super Mario World (USA).sfc" size 524288 crc B19ED489 )
+)
+
+game (
+	name "Shared CRC"
+	rom ( name "shared.sfc" size 16 crc 12345678 )
+)
+`
+
+func setupGameDatabaseDomain(t *testing.T) *GameDatabaseDomain {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nes.dat"), []byte(testNESDat), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "snes.dat"), []byte(testSNESDat), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("not a DAT file ("), 0644))
+
+	gameDatabaseDomain, err := NewGameDatabaseDomain(dir, map[string][]string{
+		"Nestopia": {"Nintendo - Nintendo Entertainment System"},
+		"Snes9x":   {"Nintendo - Super Nintendo Entertainment System"},
+	})
+	require.NoError(t, err)
+
+	return gameDatabaseDomain
+}
+
+func TestGameDatabaseDomainIdentify(t *testing.T) {
+	gameDatabaseDomain := setupGameDatabaseDomain(t)
+
+	match := gameDatabaseDomain.Identify("3337EC46", "Nestopia")
+	assert.Equal(t, GameMatch{GameEntry{"Super Mario Bros. (World)", "Nintendo - Nintendo Entertainment System", "World"}, GameVerified}, match)
+
+	match = gameDatabaseDomain.Identify("3fbd5d6e", "nestopia")
+	assert.Equal(t, GameVerified, match.Status)
+	assert.Equal(t, "Japan", match.Region)
+
+	// The CRC belongs to another system than the one of the core
+	match = gameDatabaseDomain.Identify("B19ED489", "Nestopia")
+	assert.Equal(t, GameMismatch, match.Status)
+	assert.Equal(t, "Super Mario World (USA)", match.Title)
+
+	// Cores without known systems aren't checked
+	match = gameDatabaseDomain.Identify("B19ED489", "Unknown Core")
+	assert.Equal(t, GameVerified, match.Status)
+
+	// Shared CRCs prefer the system of the core
+	match = gameDatabaseDomain.Identify("12345678", "Snes9x")
+	assert.Equal(t, "Nintendo - Super Nintendo Entertainment System", match.System)
+
+	assert.Equal(t, GameMatch{Status: GameUnknown}, gameDatabaseDomain.Identify("DEADBEEF", "Nestopia"))
+	assert.Equal(t, GameMatch{}, gameDatabaseDomain.Identify("00000000", "Nestopia"), "Content without CRC was identified")
+}
+
+func TestGameDatabaseDomainEmpty(t *testing.T) {
+	gameDatabaseDomain, err := NewGameDatabaseDomain("", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, GameMatch{}, gameDatabaseDomain.Identify("3337EC46", "Nestopia"))
+}
+
+func TestGameDatabaseDomainSystemFromFileName(t *testing.T) {
+	gameDatabaseDomain, err := NewGameDatabaseDomain("", nil)
+	require.NoError(t, err)
+
+	dat := `game ( name "Sonic the Hedgehog (USA, Europe)" rom ( name "sonic.md" crc F9394E97 ) )`
+	require.NoError(t, gameDatabaseDomain.load(strings.NewReader(dat), "Sega - Mega Drive - Genesis"))
+
+	match := gameDatabaseDomain.Identify("F9394E97", "Genesis Plus GX")
+	assert.Equal(t, "Sega - Mega Drive - Genesis", match.System)
+	assert.Equal(t, "USA, Europe", match.Region)
+}
+
+func TestGameDatabaseDomainMalformed(t *testing.T) {
+	for _, dat := range []string{
+		`game ( name "Unclosed"`,
+		`game ( name "Unterminated )`,
+		`game ( name "Too many" ) )`,
+		`( name "No key" )`,
+		`game`,
+	} {
+		_, err := parseDat(strings.NewReader(dat))
+		assert.True(t, errors.Is(err, errDatSyntax), "DAT '%s' wasn't rejected", dat)
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.dat"), []byte(`game ( name "Unclosed"`), 0644))
+	_, err := NewGameDatabaseDomain(dir, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,255 @@
+package domain
+
+// countryCenters are the rough centers of the countries (ISO 3166-1) as latitude and longitude.
+var countryCenters = map[string][2]float64{
+	"ad": {42.5, 1.6},     // Andorra
+	"ae": {23.4, 53.8},    // United Arab Emirates
+	"af": {33.9, 67.7},    // Afghanistan
+	"ag": {17.1, -61.8},   // Antigua and Barbuda
+	"ai": {18.2, -63.1},   // Anguilla
+	"al": {41.2, 20.2},    // Albania
+	"am": {40.1, 45.0},    // Armenia
+	"ao": {-11.2, 17.9},   // Angola
+	"aq": {-75.3, -0.1},   // Antarctica
+	"ar": {-38.4, -63.6},  // Argentina
+	"as": {-14.3, -170.1}, // American Samoa
+	"at": {47.5, 14.6},    // Austria
+	"au": {-25.3, 133.8},  // Australia
+	"aw": {12.5, -70.0},   // Aruba
+	"ax": {60.2, 20.0},    // Åland Islands
+	"az": {40.1, 47.6},    // Azerbaijan
+	"ba": {43.9, 17.7},    // Bosnia and Herzegovina
+	"bb": {13.2, -59.5},   // Barbados
+	"bd": {23.7, 90.4},    // Bangladesh
+	"be": {50.5, 4.5},     // Belgium
+	"bf": {12.2, -1.6},    // Burkina Faso
+	"bg": {42.7, 25.5},    // Bulgaria
+	"bh": {25.9, 50.6},    // Bahrain
+	"bi": {-3.4, 29.9},    // Burundi
+	"bj": {9.3, 2.3},      // Benin
+	"bl": {17.9, -62.8},   // Saint Barthélemy
+	"bm": {32.3, -64.8},   // Bermuda
+	"bn": {4.5, 114.7},    // Brunei
+	"bo": {-16.3, -63.6},  // Bolivia
+	"bq": {12.2, -68.3},   // Caribbean Netherlands
+	"br": {-14.2, -51.9},  // Brazil
+	"bs": {25.0, -77.4},   // Bahamas
+	"bt": {27.5, 90.4},    // Bhutan
+	"bv": {-54.4, 3.4},    // Bouvet Island
+	"bw": {-22.3, 24.7},   // Botswana
+	"by": {53.7, 28.0},    // Belarus
+	"bz": {17.2, -88.5},   // Belize
+	"ca": {56.1, -106.3},  // Canada
+	"cc": {-12.2, 96.9},   // Cocos (Keeling) Islands
+	"cd": {-4.0, 21.8},    // Democratic Republic of the Congo
+	"cf": {6.6, 20.9},     // Central African Republic
+	"cg": {-0.2, 15.8},    // Republic of the Congo
+	"ch": {46.8, 8.2},     // Switzerland
+	"ci": {7.5, -5.5},     // Côte d'Ivoire
+	"ck": {-21.2, -159.8}, // Cook Islands
+	"cl": {-35.7, -71.5},  // Chile
+	"cm": {7.4, 12.4},     // Cameroon
+	"cn": {35.9, 104.2},   // China
+	"co": {4.6, -74.3},    // Colombia
+	"cr": {9.7, -83.8},    // Costa Rica
+	"cu": {21.5, -77.8},   // Cuba
+	"cv": {16.0, -24.0},   // Cape Verde
+	"cw": {12.2, -69.0},   // Curaçao
+	"cx": {-10.4, 105.7},  // Christmas Island
+	"cy": {35.1, 33.4},    // Cyprus
+	"cz": {49.8, 15.5},    // Czechia
+	"de": {51.2, 10.5},    // Germany
+	"dj": {11.8, 42.6},    // Djibouti
+	"dk": {56.3, 9.5},     // Denmark
+	"dm": {15.4, -61.4},   // Dominica
+	"do": {18.7, -70.2},   // Dominican Republic
+	"dz": {28.0, 1.7},     // Algeria
+	"ec": {-1.8, -78.2},   // Ecuador
+	"ee": {58.6, 25.0},    // Estonia
+	"eg": {26.8, 30.8},    // Egypt
+	"eh": {24.2, -12.9},   // Western Sahara
+	"er": {15.2, 39.8},    // Eritrea
+	"es": {40.5, -3.7},    // Spain
+	"et": {9.1, 40.5},     // Ethiopia
+	"fi": {61.9, 25.7},    // Finland
+	"fj": {-16.6, 179.4},  // Fiji
+	"fk": {-51.8, -59.5},  // Falkland Islands
+	"fm": {7.4, 150.6},    // Micronesia
+	"fo": {61.9, -6.9},    // Faroe Islands
+	"fr": {46.2, 2.2},     // France
+	"ga": {-0.8, 11.6},    // Gabon
+	"gb": {55.4, -3.4},    // United Kingdom
+	"gd": {12.3, -61.6},   // Grenada
+	"ge": {42.3, 43.4},    // Georgia
+	"gf": {3.9, -53.1},    // French Guiana
+	"gg": {49.5, -2.6},    // Guernsey
+	"gh": {7.9, -1.0},     // Ghana
+	"gi": {36.1, -5.3},    // Gibraltar
+	"gl": {71.7, -42.6},   // Greenland
+	"gm": {13.4, -15.3},   // Gambia
+	"gn": {9.9, -9.7},     // Guinea
+	"gp": {16.3, -61.6},   // Guadeloupe
+	"gq": {1.7, 10.3},     // Equatorial Guinea
+	"gr": {39.1, 21.8},    // Greece
+	"gs": {-54.4, -36.6},  // South Georgia and the South Sandwich Islands
+	"gt": {15.8, -90.2},   // Guatemala
+	"gu": {13.4, 144.8},   // Guam
+	"gw": {11.8, -15.2},   // Guinea-Bissau
+	"gy": {4.9, -58.9},    // Guyana
+	"hk": {22.4, 114.1},   // Hong Kong
+	"hm": {-53.1, 73.5},   // Heard Island and McDonald Islands
+	"hn": {15.2, -86.2},   // Honduras
+	"hr": {45.1, 15.2},    // Croatia
+	"ht": {19.0, -72.3},   // Haiti
+	"hu": {47.2, 19.5},    // Hungary
+	"id": {-0.8, 113.9},   // Indonesia
+	"ie": {53.4, -8.2},    // Ireland
+	"il": {31.0, 34.9},    // Israel
+	"im": {54.2, -4.5},    // Isle of Man
+	"in": {20.6, 79.0},    // India
+	"io": {-6.3, 71.9},    // British Indian Ocean Territory
+	"iq": {33.2, 43.7},    // Iraq
+	"ir": {32.4, 53.7},    // Iran
+	"is": {65.0, -19.0},   // Iceland
+	"it": {41.9, 12.6},    // Italy
+	"je": {49.2, -2.1},    // Jersey
+	"jm": {18.1, -77.3},   // Jamaica
+	"jo": {30.6, 36.2},    // Jordan
+	"jp": {36.2, 138.3},   // Japan
+	"ke": {0.0, 37.9},     // Kenya
+	"kg": {41.2, 74.8},    // Kyrgyzstan
+	"kh": {12.6, 105.0},   // Cambodia
+	"ki": {-3.4, -168.7},  // Kiribati
+	"km": {-11.9, 43.9},   // Comoros
+	"kn": {17.4, -62.8},   // Saint Kitts and Nevis
+	"kp": {40.3, 127.5},   // North Korea
+	"kr": {35.9, 127.8},   // South Korea
+	"kw": {29.3, 47.5},    // Kuwait
+	"ky": {19.5, -80.6},   // Cayman Islands
+	"kz": {48.0, 66.9},    // Kazakhstan
+	"la": {19.9, 102.5},   // Laos
+	"lb": {33.9, 35.9},    // Lebanon
+	"lc": {13.9, -61.0},   // Saint Lucia
+	"li": {47.2, 9.6},     // Liechtenstein
+	"lk": {7.9, 80.8},     // Sri Lanka
+	"lr": {6.4, -9.4},     // Liberia
+	"ls": {-29.6, 28.2},   // Lesotho
+	"lt": {55.2, 23.9},    // Lithuania
+	"lu": {49.8, 6.1},     // Luxembourg
+	"lv": {56.9, 24.6},    // Latvia
+	"ly": {26.3, 17.2},    // Libya
+	"ma": {31.8, -7.1},    // Morocco
+	"mc": {43.7, 7.4},     // Monaco
+	"md": {47.4, 28.4},    // Moldova
+	"me": {42.7, 19.4},    // Montenegro
+	"mf": {18.1, -63.1},   // Saint Martin
+	"mg": {-18.8, 46.9},   // Madagascar
+	"mh": {7.1, 171.2},    // Marshall Islands
+	"mk": {41.6, 21.7},    // North Macedonia
+	"ml": {17.6, -4.0},    // Mali
+	"mm": {21.9, 95.96},   // Myanmar
+	"mn": {46.9, 103.8},   // Mongolia
+	"mo": {22.2, 113.5},   // Macao
+	"mp": {17.3, 145.4},   // Northern Mariana Islands
+	"mq": {14.6, -61.0},   // Martinique
+	"mr": {21.0, -10.9},   // Mauritania
+	"ms": {16.7, -62.2},   // Montserrat
+	"mt": {35.9, 14.4},    // Malta
+	"mu": {-20.3, 57.6},   // Mauritius
+	"mv": {3.2, 73.2},     // Maldives
+	"mw": {-13.3, 34.3},   // Malawi
+	"mx": {23.6, -102.6},  // Mexico
+	"my": {4.2, 102.0},    // Malaysia
+	"mz": {-18.7, 35.5},   // Mozambique
+	"na": {-22.96, 18.5},  // Namibia
+	"nc": {-20.9, 165.6},  // New Caledonia
+	"ne": {17.6, 8.1},     // Niger
+	"nf": {-29.0, 168.0},  // Norfolk Island
+	"ng": {9.1, 8.7},      // Nigeria
+	"ni": {12.9, -85.2},   // Nicaragua
+	"nl": {52.1, 5.3},     // Netherlands
+	"no": {60.5, 8.5},     // Norway
+	"np": {28.4, 84.1},    // Nepal
+	"nr": {-0.5, 166.9},   // Nauru
+	"nu": {-19.1, -169.9}, // Niue
+	"nz": {-40.9, 174.9},  // New Zealand
+	"om": {21.5, 55.9},    // Oman
+	"pa": {8.5, -80.8},    // Panama
+	"pe": {-9.2, -75.0},   // Peru
+	"pf": {-17.7, -149.4}, // French Polynesia
+	"pg": {-6.3, 143.96},  // Papua New Guinea
+	"ph": {12.9, 121.8},   // Philippines
+	"pk": {30.4, 69.3},    // Pakistan
+	"pl": {51.9, 19.1},    // Poland
+	"pm": {46.9, -56.3},   // Saint Pierre and Miquelon
+	"pn": {-24.7, -127.4}, // Pitcairn Islands
+	"pr": {18.2, -66.6},   // Puerto Rico
+	"ps": {31.95, 35.2},   // Palestine
+	"pt": {39.4, -8.2},    // Portugal
+	"pw": {7.5, 134.6},    // Palau
+	"py": {-23.4, -58.4},  // Paraguay
+	"qa": {25.4, 51.2},    // Qatar
+	"re": {-21.1, 55.5},   // Réunion
+	"ro": {45.9, 25.0},    // Romania
+	"rs": {44.0, 21.0},    // Serbia
+	"ru": {61.5, 105.3},   // Russia
+	"rw": {-1.9, 29.9},    // Rwanda
+	"sa": {23.9, 45.1},    // Saudi Arabia
+	"sb": {-9.6, 160.2},   // Solomon Islands
+	"sc": {-4.7, 55.5},    // Seychelles
+	"sd": {12.9, 30.2},    // Sudan
+	"se": {60.1, 18.6},    // Sweden
+	"sg": {1.4, 103.8},    // Singapore
+	"sh": {-24.1, -10.0},  // Saint Helena
+	"si": {46.2, 15.0},    // Slovenia
+	"sj": {77.6, 23.7},    // Svalbard and Jan Mayen
+	"sk": {48.7, 19.7},    // Slovakia
+	"sl": {8.5, -11.8},    // Sierra Leone
+	"sm": {43.9, 12.5},    // San Marino
+	"sn": {14.5, -14.5},   // Senegal
+	"so": {5.2, 46.2},     // Somalia
+	"sr": {3.9, -56.0},    // Suriname
+	"ss": {6.9, 31.3},     // South Sudan
+	"st": {0.2, 6.6},      // São Tomé and Príncipe
+	"sv": {13.8, -88.9},   // El Salvador
+	"sx": {18.0, -63.1},   // Sint Maarten
+	"sy": {34.8, 39.0},    // Syria
+	"sz": {-26.5, 31.5},   // Eswatini
+	"tc": {21.7, -71.8},   // Turks and Caicos Islands
+	"td": {15.5, 18.7},    // Chad
+	"tf": {-49.3, 69.3},   // French Southern Territories
+	"tg": {8.6, 0.8},      // Togo
+	"th": {15.9, 101.0},   // Thailand
+	"tj": {38.9, 71.3},    // Tajikistan
+	"tk": {-8.97, -171.9}, // Tokelau
+	"tl": {-8.9, 125.7},   // Timor-Leste
+	"tm": {38.97, 59.6},   // Turkmenistan
+	"tn": {33.9, 9.5},     // Tunisia
+	"to": {-21.2, -175.2}, // Tonga
+	"tr": {38.96, 35.2},   // Turkey
+	"tt": {10.7, -61.2},   // Trinidad and Tobago
+	"tv": {-7.1, 177.6},   // Tuvalu
+	"tw": {23.7, 121.0},   // Taiwan
+	"tz": {-6.4, 34.9},    // Tanzania
+	"ua": {48.4, 31.2},    // Ukraine
+	"ug": {1.4, 32.3},     // Uganda
+	"um": {19.3, 166.6},   // United States Minor Outlying Islands
+	"us": {37.1, -95.7},   // United States
+	"uy": {-32.5, -55.8},  // Uruguay
+	"uz": {41.4, 64.6},    // Uzbekistan
+	"va": {41.9, 12.5},    // Vatican City
+	"vc": {12.98, -61.3},  // Saint Vincent and the Grenadines
+	"ve": {6.4, -66.6},    // Venezuela
+	"vg": {18.4, -64.6},   // British Virgin Islands
+	"vi": {18.3, -64.9},   // United States Virgin Islands
+	"vn": {14.1, 108.3},   // Vietnam
+	"vu": {-15.4, 166.96}, // Vanuatu
+	"wf": {-13.8, -177.2}, // Wallis and Futuna
+	"ws": {-13.8, -172.1}, // Samoa
+	"xk": {42.6, 20.9},    // Kosovo
+	"ye": {15.6, 48.5},    // Yemen
+	"yt": {-12.8, 45.2},   // Mayotte
+	"za": {-30.6, 22.9},   // South Africa
+	"zm": {-13.1, 27.8},   // Zambia
+	"zw": {-19.0, 29.2},   // Zimbabwe
+}
@@ -18,6 +18,26 @@ type countryRecord struct {
 	} `maxminddb:"country"`
 }
 
+type locationRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Continent struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"continent"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"` // Only part of city databases
+}
+
+// GeoLocation is the approximate location of an IP.
+type GeoLocation struct {
+	Continent string // Lower case continent code like "eu" or "sa"
+	Latitude  float64
+	Longitude float64
+}
+
 // NewGeoIP2Domain creates a new domain object for the GeoIP2 country database. Need the path to a maxminddb file.
 func NewGeoIP2Domain(path string) (*GeoIP2Domain, error) {
 	db, err := maxminddb.Open(path)
@@ -40,6 +60,47 @@ func (d *GeoIP2Domain) GetCountryCodeForIP(ip net.IP) (string, error) {
 	return strings.ToLower(record.Country.ISOCode), nil
 }
 
+// GetLocationForIP returns the location of the given IP. Country databases don't know the coordinates, so the
+// center of the country or of the continent is used. Returns nil if the IP can't be located.
+func (d *GeoIP2Domain) GetLocationForIP(ip net.IP) (*GeoLocation, error) {
+	record := &locationRecord{}
+
+	err := d.db.Lookup(ip, record)
+	if err != nil {
+		return nil, fmt.Errorf("can't lookup location for IP %s: %w", ip, err)
+	}
+
+	location := &GeoLocation{Continent: strings.ToLower(record.Continent.Code)}
+	if record.Location.Latitude != nil && record.Location.Longitude != nil {
+		location.Latitude = *record.Location.Latitude
+		location.Longitude = *record.Location.Longitude
+		return location, nil
+	}
+
+	center, found := countryCenters[strings.ToLower(record.Country.ISOCode)]
+	if !found {
+		center, found = continentCenters[location.Continent]
+	}
+	if !found {
+		return nil, nil
+	}
+	location.Latitude = center[0]
+	location.Longitude = center[1]
+
+	return location, nil
+}
+
+// continentCenters are the rough centers of the continents as latitude and longitude.
+var continentCenters = map[string][2]float64{
+	"af": {2, 21},
+	"an": {-80, 0},
+	"as": {34, 100},
+	"eu": {50, 15},
+	"na": {40, -100},
+	"oc": {-25, 140},
+	"sa": {-15, -60},
+}
+
 // Close needs to be called to properly close the internal maxminddb database.
 func (d *GeoIP2Domain) Close() {
 	d.db.Close()
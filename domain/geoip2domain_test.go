@@ -41,3 +41,23 @@ func TestGeoIP2GetCountryCodeForIP(t *testing.T) {
 		assert.Equal(t, "", localCode)
 	}
 }
+
+func TestGeoIP2GetLocationForIP(t *testing.T) {
+	geoip2Domain := setupGeoip2Domain(t)
+
+	location, err := geoip2Domain.GetLocationForIP(net.ParseIP("46.243.122.48"))
+	require.NoError(t, err)
+	require.NotNil(t, location)
+	assert.Equal(t, "eu", location.Continent)
+	assert.Equal(t, 51.2, location.Latitude, "The center of the country wasn't used")
+	assert.Equal(t, 10.5, location.Longitude)
+
+	location, err = geoip2Domain.GetLocationForIP(net.ParseIP("54.208.114.32"))
+	require.NoError(t, err)
+	require.NotNil(t, location)
+	assert.Equal(t, "na", location.Continent)
+
+	location, err = geoip2Domain.GetLocationForIP(net.ParseIP("192.168.178.2"))
+	require.NoError(t, err)
+	assert.Nil(t, location)
+}
@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ipTrie is a binary prefix tree for IPv4 and IPv6 networks.
+type ipTrie struct {
+	v4 *ipTrieNode
+	v6 *ipTrieNode
+}
+
+type ipTrieNode struct {
+	children [2]*ipTrieNode
+	terminal bool
+}
+
+func newIPTrie() *ipTrie {
+	return &ipTrie{&ipTrieNode{}, &ipTrieNode{}}
+}
+
+// parseIPNetwork parses a single IP or a CIDR range. A single IP is treated as a /32 or /128 network.
+func parseIPNetwork(entry string) (*net.IPNet, error) {
+	if strings.Contains(entry, "/") {
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		return network, nil
+	}
+
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address '%s'", entry)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// Insert adds a network to the trie.
+func (t *ipTrie) Insert(network *net.IPNet) {
+	ones, bits := network.Mask.Size()
+	node, ip := t.root(network.IP)
+	if ip == nil {
+		return
+	}
+
+	// IPv4-mapped IPv6 ranges like ::ffff:10.0.0.0/104 are stored as the IPv4 range without the 96 bit prefix
+	if bits == 8*net.IPv6len && len(ip) == net.IPv4len {
+		ones -= 96
+	}
+	if ones < 0 || ones > len(ip)*8 {
+		return
+	}
+
+	for i := 0; i < ones; i++ {
+		bit := ipBit(ip, i)
+		if node.children[bit] == nil {
+			node.children[bit] = &ipTrieNode{}
+		}
+		node = node.children[bit]
+	}
+	node.terminal = true
+}
+
+// Contains returns true if the given IP is part of any network in the trie.
+func (t *ipTrie) Contains(ip net.IP) bool {
+	node, ip := t.root(ip)
+	if ip == nil {
+		return false
+	}
+
+	for i := 0; i < len(ip)*8; i++ {
+		if node.terminal {
+			return true
+		}
+		node = node.children[ipBit(ip, i)]
+		if node == nil {
+			return false
+		}
+	}
+
+	return node.terminal
+}
+
+// root returns the root node for the address family of the IP and the normalized IP.
+func (t *ipTrie) root(ip net.IP) (*ipTrieNode, net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return t.v4, ip4
+	}
+	if ip6 := ip.To16(); ip6 != nil {
+		return t.v6, ip6
+	}
+	return nil, nil
+}
+
+func ipBit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The names of the leases of the jobs only one replica may run.
+const (
+	PurgeLease      = "purge"
+	FederationLease = "federation"
+	WebhookLease    = "webhook"
+)
+
+// leaseIntervals is the amount of job intervals a lease outlives its last renewal, so a slow run doesn't lose it.
+const leaseIntervals = 3
+
+// LeaseRepository interface to decouple the domain logic from the repository code.
+type LeaseRepository interface {
+	Acquire(name string, holder string, ttl time.Duration) (bool, error)
+	Release(name string, holder string) error
+}
+
+// LeaseDomain elects a single replica for the jobs that must not run concurrently, like the purge of old sessions.
+// The leader holds a lease in the shared database that it renews on every run of the job. Another replica takes
+// over once the lease expired or got released.
+type LeaseDomain struct {
+	mutex     sync.Mutex
+	leaseRepo LeaseRepository
+	holder    string
+	held      map[string]struct{}
+}
+
+// NewLeaseDomain returns a new lease domain with a random holder ID for this replica.
+func NewLeaseDomain(leaseRepo LeaseRepository) (*LeaseDomain, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("Can't generate lease holder: %w", err)
+	}
+
+	return &LeaseDomain{leaseRepo: leaseRepo, holder: hex.EncodeToString(raw), held: make(map[string]struct{})}, nil
+}
+
+// Acquire renews or takes over the lease of a job that runs in the given interval.
+// Returns false if another replica holds the lease.
+func (d *LeaseDomain) Acquire(name string, interval time.Duration) (bool, error) {
+	acquired, err := d.leaseRepo.Acquire(name, d.holder, leaseIntervals*interval)
+	if err != nil {
+		return false, err
+	}
+
+	d.mutex.Lock()
+	if acquired {
+		d.held[name] = struct{}{}
+	} else {
+		delete(d.held, name)
+	}
+	d.mutex.Unlock()
+
+	return acquired, nil
+}
+
+// ReleaseAll gives up all held leases, so other replicas take over right away.
+func (d *LeaseDomain) ReleaseAll() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for name := range d.held {
+		if err := d.leaseRepo.Release(name, d.holder); err != nil {
+			return err
+		}
+		delete(d.held, name)
+	}
+
+	return nil
+}
+
+// Purger returns a Purger that only purges while this replica holds the purge lease.
+func (d *LeaseDomain) Purger(purger Purger, interval time.Duration) Purger {
+	return &leaderPurger{d, purger, interval}
+}
+
+// leaderPurger purges on the replica holding the purge lease and does nothing on the others.
+type leaderPurger struct {
+	leaseDomain *LeaseDomain
+	purger      Purger
+	interval    time.Duration
+}
+
+// PurgeOld purges old sessions if this replica holds the purge lease.
+func (p *leaderPurger) PurgeOld() error {
+	leader, err := p.leaseDomain.Acquire(PurgeLease, p.interval)
+	if err != nil {
+		return fmt.Errorf("Can't acquire purge lease: %w", err)
+	}
+	if !leader {
+		return nil
+	}
+
+	return p.purger.PurgeOld()
+}
@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type LeaseRepositoryMock struct {
+	mock.Mock
+}
+
+func (m *LeaseRepositoryMock) Acquire(name string, holder string, ttl time.Duration) (bool, error) {
+	args := m.Called(name, holder, ttl)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *LeaseRepositoryMock) Release(name string, holder string) error {
+	args := m.Called(name, holder)
+	return args.Error(0)
+}
+
+type PurgerMock struct {
+	mock.Mock
+}
+
+func (m *PurgerMock) PurgeOld() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func setupLeaseDomain(t *testing.T) (*LeaseDomain, *LeaseRepositoryMock) {
+	leaseRepoMock := &LeaseRepositoryMock{}
+	leaseDomain, err := NewLeaseDomain(leaseRepoMock)
+	require.NoError(t, err)
+	return leaseDomain, leaseRepoMock
+}
+
+func TestLeaseDomainPurger(t *testing.T) {
+	leaseDomain, leaseRepoMock := setupLeaseDomain(t)
+	purgerMock := &PurgerMock{}
+	purger := leaseDomain.Purger(purgerMock, time.Minute)
+
+	leaseRepoMock.On("Acquire", PurgeLease, leaseDomain.holder, 3*time.Minute).Return(true, nil).Once()
+	purgerMock.On("PurgeOld").Return(nil).Once()
+	require.NoError(t, purger.PurgeOld())
+
+	// Another replica holds the lease
+	leaseRepoMock.On("Acquire", PurgeLease, leaseDomain.holder, 3*time.Minute).Return(false, nil).Once()
+	require.NoError(t, purger.PurgeOld())
+
+	leaseRepoMock.On("Acquire", PurgeLease, leaseDomain.holder, 3*time.Minute).Return(false, errors.New("test error")).Once()
+	assert.Error(t, purger.PurgeOld())
+
+	purgerMock.AssertNumberOfCalls(t, "PurgeOld", 1)
+}
+
+func TestLeaseDomainReleaseAll(t *testing.T) {
+	leaseDomain, leaseRepoMock := setupLeaseDomain(t)
+
+	leaseRepoMock.On("Acquire", PurgeLease, leaseDomain.holder, 3*time.Minute).Return(true, nil)
+	leaseRepoMock.On("Acquire", FederationLease, leaseDomain.holder, 3*time.Second).Return(false, nil)
+	leaseRepoMock.On("Release", PurgeLease, leaseDomain.holder).Return(nil).Once()
+
+	acquired, err := leaseDomain.Acquire(PurgeLease, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	acquired, err = leaseDomain.Acquire(FederationLease, time.Second)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	require.NoError(t, leaseDomain.ReleaseAll())
+	require.NoError(t, leaseDomain.ReleaseAll())
+	leaseRepoMock.AssertExpectations(t)
+	leaseRepoMock.AssertNotCalled(t, "Release", FederationLease, leaseDomain.holder)
+}
+
+func TestLeaseDomainHolder(t *testing.T) {
+	leaseDomain, _ := setupLeaseDomain(t)
+	otherDomain, _ := setupLeaseDomain(t)
+
+	assert.Len(t, leaseDomain.holder, 32)
+	assert.NotEqual(t, leaseDomain.holder, otherDomain.holder)
+}
@@ -0,0 +1,197 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LobbyConfig holds the tunables of the session handling.
+type LobbyConfig struct {
+	SessionDeadline     time.Duration // Lifespan of a session that hasn't recieved any update
+	PurgeInterval       time.Duration // Interval between two purges of old sessions
+	RateLimit           time.Duration // Minimal duration between two updates of a session
+	CreateInterval      time.Duration // Interval in which an IP or IPv6 /64 earns a new room creation, zero disables the limit
+	CreateBurst         int           // Amount of rooms an IP or IPv6 /64 can create at once, per replica
+	MaxRoomsPerIP       int           // Maximal amount of concurrent rooms per IP, zero disables the quota
+	DefaultUsername     string        // Username for sessions without one
+	ProbeConnectTimeout time.Duration // Dial timeout of the connectivity probe
+	ProbeReadTimeout    time.Duration // Write and read timeout of the connectivity probe
+	ProbeWorkers        int           // Amount of concurrent connectivity probes
+	ProbeQueueSize      int           // Amount of sessions waiting for a probe, further sessions are dropped
+	ProbeRetryInterval  time.Duration // Interval to re-probe unconnectable sessions, zero disables re-probing
+	Privacy             PrivacyMode   // Which host IPs are hidden from the public listings
+	JoinTicketLifetime  time.Duration // Lifespan of a join ticket that resolves a hidden host IP
+	JoinTicketSecret    string        // Key to sign the join tickets, a random one is used if empty
+	JoinInterval        time.Duration // Interval in which an IP or IPv6 /64 earns a new join ticket resolution, zero disables the limit
+	JoinBurst           int           // Amount of join tickets an IP or IPv6 /64 can resolve at once, per replica
+	RelayCheckInterval  time.Duration // Interval between two health checks of the relays, zero disables the checks
+	RelayCheckTimeout   time.Duration // Dial timeout of the relay health check
+	CustomRelayDomains  []string      // Domains custom relays need to be in, any public address is allowed if empty
+	CustomRelayProbe    bool          // Whether custom relays need to accept connections on their port
+	CustomRelayTimeout  time.Duration // Timeout of the resolution and the probe of a custom relay
+	RejectNonNetplay    bool          // Whether rooms of cores known not to support netplay are rejected instead of warned
+	FederationInterval  time.Duration // Interval between two pulls of the sessions of the peer lobbies
+	FederationTimeout   time.Duration // Timeout of a pull of the sessions of a peer lobby
+	BanReloadInterval   time.Duration // Interval to reload the bans other replicas issued, zero disables the reloads
+	Replicated          bool          // Whether several replicas share the database, see EventFeedDomain
+	EventPollInterval   time.Duration // Interval in which replicated lobbies poll the database for the event streams
+	WebhookInterval     time.Duration // Interval between two deliveries of the webhook queue and the first retry delay
+	WebhookTimeout      time.Duration // Timeout of a single webhook request
+	WebhookMaxAttempts  int           // Amount of delivery attempts before a webhook notification is dropped
+	WebhookMaxBackoff   time.Duration // Maximal delay between two delivery attempts of a webhook notification
+	MaxLength           FieldLimits
+}
+
+// FieldLimits holds the maximal lengths of the session fields.
+type FieldLimits struct {
+	Username         int
+	CoreName         int
+	CoreVersion      int
+	GameName         int
+	RetroArchVersion int
+	SubsystemName    int
+	Frontend         int
+	MitmSession      int
+}
+
+// DefaultLobbyConfig returns the configuration of the public lobby.
+func DefaultLobbyConfig() LobbyConfig {
+	return LobbyConfig{
+		SessionDeadline:     SessionDeadline * time.Second,
+		PurgeInterval:       PurgeInterval,
+		RateLimit:           RateLimit * time.Second,
+		CreateInterval:      10 * time.Second,
+		CreateBurst:         5,
+		MaxRoomsPerIP:       10,
+		DefaultUsername:     "Anonymous",
+		ProbeConnectTimeout: 3 * time.Second,
+		ProbeReadTimeout:    3 * time.Second,
+		ProbeWorkers:        16,
+		ProbeQueueSize:      1024,
+		ProbeRetryInterval:  30 * time.Second,
+		Privacy:             PrivacyOff,
+		JoinTicketLifetime:  2 * time.Minute,
+		JoinInterval:        5 * time.Second,
+		JoinBurst:           10,
+		RelayCheckInterval:  30 * time.Second,
+		RelayCheckTimeout:   3 * time.Second,
+		CustomRelayTimeout:  3 * time.Second,
+		FederationInterval:  15 * time.Second,
+		FederationTimeout:   5 * time.Second,
+		BanReloadInterval:   30 * time.Second,
+		EventPollInterval:   2 * time.Second,
+		WebhookInterval:     2 * time.Second,
+		WebhookTimeout:      5 * time.Second,
+		WebhookMaxAttempts:  10,
+		WebhookMaxBackoff:   10 * time.Minute,
+		MaxLength: FieldLimits{
+			Username:         32,
+			CoreName:         255,
+			CoreVersion:      255,
+			GameName:         255,
+			RetroArchVersion: 32,
+			SubsystemName:    255,
+			Frontend:         255,
+			MitmSession:      32,
+		},
+	}
+}
+
+// Validate checks the configuration for invalid values.
+func (c *LobbyConfig) Validate() error {
+	if c.SessionDeadline <= 0 {
+		return errors.New("session deadline needs to be positive")
+	}
+	if c.PurgeInterval <= 0 {
+		return errors.New("purge interval needs to be positive")
+	}
+	if c.RateLimit < 0 || c.RateLimit >= c.SessionDeadline {
+		return fmt.Errorf("rate limit needs to be between 0 and the session deadline of %s", c.SessionDeadline)
+	}
+	if c.CreateInterval < 0 || (c.CreateInterval > 0 && c.CreateBurst < 1) {
+		return errors.New("create interval can't be negative and needs a burst of at least one")
+	}
+	if c.MaxRoomsPerIP < 0 {
+		return errors.New("max rooms per IP can't be negative")
+	}
+	if c.ProbeConnectTimeout <= 0 || c.ProbeReadTimeout <= 0 {
+		return errors.New("probe timeouts need to be positive")
+	}
+	if c.ProbeWorkers < 1 || c.ProbeQueueSize < 1 {
+		return errors.New("probe workers and probe queue size need to be positive")
+	}
+	if c.ProbeRetryInterval < 0 {
+		return errors.New("probe retry interval can't be negative")
+	}
+	if c.Privacy != PrivacyOff && c.Privacy != PrivacyMITM && c.Privacy != PrivacyAll {
+		return fmt.Errorf("unknown privacy mode '%s'", c.Privacy)
+	}
+	if c.JoinTicketLifetime <= 0 {
+		return errors.New("join ticket lifetime needs to be positive")
+	}
+	if c.JoinInterval < 0 || (c.JoinInterval > 0 && c.JoinBurst < 1) {
+		return errors.New("join interval can't be negative and needs a burst of at least one")
+	}
+	if c.RelayCheckInterval < 0 {
+		return errors.New("relay check interval can't be negative")
+	}
+	if c.RelayCheckTimeout <= 0 {
+		return errors.New("relay check timeout needs to be positive")
+	}
+	for _, domain := range c.CustomRelayDomains {
+		if strings.Trim(domain, ".") == "" || strings.ContainsAny(domain, " /:*") {
+			return fmt.Errorf("invalid custom relay domain '%s'", domain)
+		}
+	}
+	if c.CustomRelayTimeout <= 0 {
+		return errors.New("custom relay timeout needs to be positive")
+	}
+	if c.FederationInterval <= 0 {
+		return errors.New("federation interval needs to be positive")
+	}
+	if c.FederationTimeout <= 0 {
+		return errors.New("federation timeout needs to be positive")
+	}
+	if c.BanReloadInterval < 0 {
+		return errors.New("ban reload interval can't be negative")
+	}
+	if c.Replicated && c.JoinTicketSecret == "" {
+		return errors.New("replicated lobbies need a join ticket secret shared by all replicas")
+	}
+	if c.EventPollInterval <= 0 {
+		return errors.New("event poll interval needs to be positive")
+	}
+	if c.WebhookInterval <= 0 || c.WebhookTimeout <= 0 {
+		return errors.New("webhook interval and webhook timeout need to be positive")
+	}
+	if c.WebhookMaxAttempts < 1 {
+		return errors.New("webhook max attempts need to be positive")
+	}
+	if c.WebhookMaxBackoff < c.WebhookInterval {
+		return fmt.Errorf("webhook max backoff needs to be at least the webhook interval of %s", c.WebhookInterval)
+	}
+
+	limits := map[string]int{
+		"username":         c.MaxLength.Username,
+		"corename":         c.MaxLength.CoreName,
+		"coreversion":      c.MaxLength.CoreVersion,
+		"gamename":         c.MaxLength.GameName,
+		"retroarchversion": c.MaxLength.RetroArchVersion,
+		"subsystemname":    c.MaxLength.SubsystemName,
+		"frontend":         c.MaxLength.Frontend,
+		"mitmsession":      c.MaxLength.MitmSession,
+	}
+	for field, limit := range limits {
+		if limit <= 0 {
+			return fmt.Errorf("max length of %s needs to be positive", field)
+		}
+	}
+
+	if c.DefaultUsername == "" || len(c.DefaultUsername) > c.MaxLength.Username {
+		return fmt.Errorf("default username needs to have between 1 and %d characters", c.MaxLength.Username)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLobbyConfigDefaultIsValid(t *testing.T) {
+	config := DefaultLobbyConfig()
+	assert.NoError(t, config.Validate())
+}
+
+func TestLobbyConfigValidate(t *testing.T) {
+	invalidConfigs := []func(c *LobbyConfig){
+		func(c *LobbyConfig) { c.SessionDeadline = 0 },
+		func(c *LobbyConfig) { c.PurgeInterval = -time.Second },
+		func(c *LobbyConfig) { c.RateLimit = -time.Second },
+		func(c *LobbyConfig) { c.RateLimit = c.SessionDeadline },
+		func(c *LobbyConfig) { c.CreateInterval = -time.Second },
+		func(c *LobbyConfig) { c.CreateBurst = 0 },
+		func(c *LobbyConfig) { c.MaxRoomsPerIP = -1 },
+		func(c *LobbyConfig) { c.ProbeConnectTimeout = 0 },
+		func(c *LobbyConfig) { c.ProbeWorkers = 0 },
+		func(c *LobbyConfig) { c.ProbeQueueSize = 0 },
+		func(c *LobbyConfig) { c.ProbeRetryInterval = -time.Second },
+		func(c *LobbyConfig) { c.ProbeReadTimeout = 0 },
+		func(c *LobbyConfig) { c.Privacy = "everything" },
+		func(c *LobbyConfig) { c.JoinTicketLifetime = 0 },
+		func(c *LobbyConfig) { c.JoinInterval = -time.Second },
+		func(c *LobbyConfig) { c.JoinBurst = 0 },
+		func(c *LobbyConfig) { c.RelayCheckInterval = -time.Second },
+		func(c *LobbyConfig) { c.RelayCheckTimeout = 0 },
+		func(c *LobbyConfig) { c.CustomRelayDomains = []string{""} },
+		func(c *LobbyConfig) { c.CustomRelayDomains = []string{"*.example.com"} },
+		func(c *LobbyConfig) { c.CustomRelayTimeout = 0 },
+		func(c *LobbyConfig) { c.FederationInterval = 0 },
+		func(c *LobbyConfig) { c.FederationTimeout = 0 },
+		func(c *LobbyConfig) { c.BanReloadInterval = -time.Second },
+		func(c *LobbyConfig) { c.Replicated = true },
+		func(c *LobbyConfig) { c.EventPollInterval = 0 },
+		func(c *LobbyConfig) { c.WebhookInterval = 0 },
+		func(c *LobbyConfig) { c.WebhookTimeout = 0 },
+		func(c *LobbyConfig) { c.WebhookMaxAttempts = 0 },
+		func(c *LobbyConfig) { c.WebhookMaxBackoff = time.Second },
+		func(c *LobbyConfig) { c.MaxLength.GameName = 0 },
+		func(c *LobbyConfig) { c.DefaultUsername = "" },
+		func(c *LobbyConfig) { c.DefaultUsername = "ThisDefaultUsernameIsWayTooLongForTheLobby" },
+	}
+
+	for i, modify := range invalidConfigs {
+		config := DefaultLobbyConfig()
+		modify(&config)
+		assert.Error(t, config.Validate(), "Config %d should be invalid", i)
+	}
+}
+
+func TestLobbyConfigReplicated(t *testing.T) {
+	config := DefaultLobbyConfig()
+	config.Replicated = true
+	config.JoinTicketSecret = "secret"
+	assert.NoError(t, config.Validate())
+}
@@ -0,0 +1,201 @@
+package domain
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// durationBuckets are the histogram buckets in seconds for probe and query durations.
+var durationBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// The outcomes of a connectivity probe.
+const (
+	ProbeConnectable  = "connectable"
+	ProbeUnreachable  = "unreachable"
+	ProbeNotRetroArch = "not_retroarch"
+	ProbeSkipped      = "skipped"
+)
+
+// MetricsDomain collects the lobby metrics and renders them in the Prometheus text exposition format.
+type MetricsDomain struct {
+	mutex         sync.Mutex
+	addResults    map[string]uint64
+	probeResults  map[string]uint64
+	probeDuration *histogram
+	queryDuration map[string]*histogram
+}
+
+// histogram is a cumulative Prometheus histogram.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewMetricsDomain creates a new metrics domain.
+func NewMetricsDomain() *MetricsDomain {
+	return &MetricsDomain{
+		addResults:    make(map[string]uint64),
+		probeResults:  make(map[string]uint64),
+		probeDuration: newHistogram(),
+		queryDuration: make(map[string]*histogram),
+	}
+}
+
+// ObserveAdd counts the result of a session add request.
+func (d *MetricsDomain) ObserveAdd(result string) {
+	d.mutex.Lock()
+	d.addResults[result]++
+	d.mutex.Unlock()
+}
+
+// ObserveProbe records the outcome and duration of a connectivity probe.
+func (d *MetricsDomain) ObserveProbe(result string, duration time.Duration) {
+	d.mutex.Lock()
+	d.probeResults[result]++
+	d.probeDuration.observe(duration.Seconds())
+	d.mutex.Unlock()
+}
+
+// ObserveQuery records the duration of a repository query.
+func (d *MetricsDomain) ObserveQuery(query string, duration time.Duration) {
+	d.mutex.Lock()
+	h, found := d.queryDuration[query]
+	if !found {
+		h = newHistogram()
+		d.queryDuration[query] = h
+	}
+	h.observe(duration.Seconds())
+	d.mutex.Unlock()
+}
+
+// Write renders all metrics in the Prometheus text exposition format.
+// The room gauges are calculated from the given list of active sessions, the relay gauges from the relay status.
+func (d *MetricsDomain) Write(w io.Writer, sessions []entity.Session, relays []RelayStatus) error {
+	buf := bufio.NewWriter(w)
+
+	byCore := make(map[string]uint64)
+	byHostMethod := make(map[string]uint64)
+	byCountry := make(map[string]uint64)
+	byConnectable := map[string]uint64{"true": 0, "false": 0}
+	for _, s := range sessions {
+		byCore[s.CoreName]++
+		byHostMethod[s.HostMethod.String()]++
+		byCountry[s.Country]++
+		byConnectable[strconv.FormatBool(s.Connectable)]++
+	}
+
+	writeHeader(buf, "lobby_sessions", "gauge", "Number of active netplay sessions.")
+	fmt.Fprintf(buf, "lobby_sessions %d\n", len(sessions))
+	writeHeader(buf, "lobby_sessions_by_core", "gauge", "Number of active netplay sessions by core.")
+	writeValues(buf, "lobby_sessions_by_core", "core", byCore)
+	writeHeader(buf, "lobby_sessions_by_host_method", "gauge", "Number of active netplay sessions by host method.")
+	writeValues(buf, "lobby_sessions_by_host_method", "host_method", byHostMethod)
+	writeHeader(buf, "lobby_sessions_by_country", "gauge", "Number of active netplay sessions by country.")
+	writeValues(buf, "lobby_sessions_by_country", "country", byCountry)
+	writeHeader(buf, "lobby_sessions_by_connectable", "gauge", "Number of active netplay sessions by connectable state.")
+	writeValues(buf, "lobby_sessions_by_connectable", "connectable", byConnectable)
+
+	relayUp := make(map[string]uint64)
+	relaySessions := make(map[string]uint64)
+	relayMaxSessions := make(map[string]uint64)
+	for _, r := range relays {
+		relayUp[r.Handle] = 0
+		if r.Up {
+			relayUp[r.Handle] = 1
+		}
+		relaySessions[r.Handle] = uint64(r.Sessions)
+		if r.MaxSessions > 0 {
+			relayMaxSessions[r.Handle] = uint64(r.MaxSessions)
+		}
+	}
+
+	writeHeader(buf, "lobby_relay_up", "gauge", "Whether the relay passes its health checks.")
+	writeValues(buf, "lobby_relay_up", "relay", relayUp)
+	writeHeader(buf, "lobby_relay_sessions", "gauge", "Number of active netplay sessions by relay.")
+	writeValues(buf, "lobby_relay_sessions", "relay", relaySessions)
+	writeHeader(buf, "lobby_relay_max_sessions", "gauge", "Capacity of the relays that have one.")
+	writeValues(buf, "lobby_relay_max_sessions", "relay", relayMaxSessions)
+
+	d.mutex.Lock()
+	writeHeader(buf, "lobby_add_requests_total", "counter", "Number of /add requests by result.")
+	writeValues(buf, "lobby_add_requests_total", "result", d.addResults)
+	writeHeader(buf, "lobby_probes_total", "counter", "Number of connectivity probes by result.")
+	writeValues(buf, "lobby_probes_total", "result", d.probeResults)
+	writeHeader(buf, "lobby_probe_duration_seconds", "histogram", "Duration of connectivity probes.")
+	d.probeDuration.write(buf, "lobby_probe_duration_seconds", "")
+	writeHeader(buf, "lobby_db_query_duration_seconds", "histogram", "Duration of repository queries.")
+	for _, query := range sortedKeys(d.queryDuration) {
+		d.queryDuration[query].write(buf, "lobby_db_query_duration_seconds", label("query", query)+",")
+	}
+	d.mutex.Unlock()
+
+	return buf.Flush()
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(durationBuckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range durationBuckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// write renders the histogram. labels is a list of labels with a trailing comma.
+func (h *histogram) write(w io.Writer, name string, labels string) {
+	for i, bound := range durationBuckets {
+		fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", name, labels, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, h.count)
+
+	labels = strings.TrimSuffix(labels, ",")
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+func writeHeader(w io.Writer, name string, metricType string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func writeValues(w io.Writer, name string, labelName string, values map[string]uint64) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s} %d\n", name, label(labelName, key), values[key])
+	}
+}
+
+func label(name string, value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return fmt.Sprintf("%s=\"%s\"", name, value)
+}
+
+func sortedKeys(m map[string]*histogram) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
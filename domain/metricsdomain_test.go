@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+func TestMetricsDomainWriteEscapesLabels(t *testing.T) {
+	metricsDomain := NewMetricsDomain()
+
+	session := testSession
+	session.CoreName = "bad \"core\"\\\n"
+
+	var buf bytes.Buffer
+	err := metricsDomain.Write(&buf, []entity.Session{session}, nil)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), `lobby_sessions_by_core{core="bad \"core\"\\\n"} 1`)
+}
+
+func TestMetricsDomainWriteRelays(t *testing.T) {
+	metricsDomain := NewMetricsDomain()
+
+	relays := []RelayStatus{
+		{Handle: "madrid", Up: false, Sessions: 0},
+		{Handle: "nyc", Up: true, Sessions: 7, MaxSessions: 10},
+	}
+
+	var buf bytes.Buffer
+	err := metricsDomain.Write(&buf, nil, relays)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "lobby_relay_up{relay=\"madrid\"} 0\n")
+	assert.Contains(t, buf.String(), "lobby_relay_up{relay=\"nyc\"} 1\n")
+	assert.Contains(t, buf.String(), "lobby_relay_sessions{relay=\"nyc\"} 7\n")
+	assert.Contains(t, buf.String(), "lobby_relay_max_sessions{relay=\"nyc\"} 10\n")
+	assert.NotContains(t, buf.String(), "lobby_relay_max_sessions{relay=\"madrid\"}")
+}
+
+func TestSessionDomainAddObservesResult(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+
+	request := testRequest
+	comp := testSession
+	comp.UpdatedAt = time.Now().Add(-4 * time.Second)
+	comp.CalculateID()
+	comp.CalculateContentHash()
+
+	repoMock.On("GetByID", comp.ID).Return(&comp, nil)
+
+	_, err := sessionDomain.Add(&request, testIP)
+	require.Error(t, err)
+
+	var buf bytes.Buffer
+	err = sessionDomain.GetMetrics().Write(&buf, nil, nil)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), `lobby_add_requests_total{result="rate_limited"} 1`)
+}
@@ -1,57 +1,524 @@
 package domain
 
 import (
+	"context"
 	"fmt"
-	"strings"
+	"math"
+	"net"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+// RelayDownThreshold is the amount of failed health checks in a row after which a relay counts as down.
+const RelayDownThreshold = 2
+
+// MitmAuto is the relay handle that lets the lobby pick the closest healthy relay.
+const MitmAuto = "auto"
+
+// MitmCustom is the relay handle of hosts that bring their own relay.
+const MitmCustom = "custom"
+
+// TunnelTTL is how long the relay /tunnel handed out to a host is remembered for the room it announces next.
+const TunnelTTL = time.Minute
+
+// maxTunnelCacheSize is the amount of remembered tunnels above which the expired ones are dropped.
+const maxTunnelCacheSize = 4096
+
+// RelayConfig configures a relay server.
+type RelayConfig struct {
+	Handle      string // Name RetroArch sends as mitm_server
+	Name        string // Display name, defaults to the handle
+	Host        string // Hostname or IP address
+	Port        uint16
+	IPv6        string  // Optional IPv6 address for clients that prefer it
+	Region      string  // Continent code like "eu" or "sa"
+	Country     string  // Country code (ISO 3166-1) like "de", places relays without coordinates in its center
+	Latitude    float64 // Coordinates for the automatic relay selection, default to the center of the country or region
+	Longitude   float64
+	MaxSessions int   // Maximal amount of rooms on the relay, zero means unlimited
+	Enabled     *bool // Disabled relays are ignored, defaults to true
+}
+
+// IsEnabled returns whether the relay is enabled.
+func (c *RelayConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// ParseLegacyRelays converts the legacy relay configuration that maps handles to "host:port" pairs. IPv6
+// literals need to be bracketed like "[2001:db8::1]:55435". Invalid entries are ignored.
+func ParseLegacyRelays(servers map[string]string) []RelayConfig {
+	relays := make([]RelayConfig, 0, len(servers))
+	for handle, address := range servers {
+		host, portString, err := net.SplitHostPort(address)
+		if err != nil || host == "" {
+			continue
+		}
+		port, err := strconv.ParseUint(portString, 10, 16)
+		if err != nil || port == 0 {
+			continue
+		}
+
+		relays = append(relays, RelayConfig{Handle: handle, Host: host, Port: uint16(port)})
+	}
+	sort.Slice(relays, func(i, j int) bool { return relays[i].Handle < relays[j].Handle })
+
+	return relays
+}
+
+// ValidateRelays checks the relay configuration for invalid values.
+func ValidateRelays(relays []RelayConfig) error {
+	handles := make(map[string]struct{}, len(relays))
+	for _, r := range relays {
+		if r.Handle == "" || r.Handle == MitmAuto || r.Handle == MitmCustom {
+			return fmt.Errorf("invalid relay handle '%s'", r.Handle)
+		}
+		if _, found := handles[r.Handle]; found {
+			return fmt.Errorf("duplicate relay handle '%s'", r.Handle)
+		}
+		handles[r.Handle] = struct{}{}
+
+		if r.Host == "" || r.Port == 0 {
+			return fmt.Errorf("relay %s needs a host and a port", r.Handle)
+		}
+		if r.IPv6 != "" {
+			if ip := net.ParseIP(r.IPv6); ip == nil || ip.To4() != nil {
+				return fmt.Errorf("relay %s has an invalid IPv6 address '%s'", r.Handle, r.IPv6)
+			}
+		}
+		if r.MaxSessions < 0 {
+			return fmt.Errorf("max sessions of relay %s can't be negative", r.Handle)
+		}
+	}
+
+	return nil
+}
+
 // MitmInfo represents a relay server info.
 type MitmInfo struct {
-	Address string
-	Port uint16
+	Handle    string
+	Address   string
+	AddressV6 string
+	Port      uint16
+}
+
+// RelayEntry is a relay choice for the clients.
+type RelayEntry struct {
+	Handle string `json:"handle"`
+	Name   string `json:"name"`
+	Region string `json:"region,omitempty"`
+	Up     bool   `json:"up"`
+}
+
+// RelayStatus is the health and load of a relay server.
+type RelayStatus struct {
+	Handle      string    `json:"handle"`
+	Name        string    `json:"name"`
+	Address     string    `json:"address"`
+	Port        uint16    `json:"port"`
+	Region      string    `json:"region,omitempty"`
+	Up          bool      `json:"up"`
+	Latency     float64   `json:"latency_ms"` // Connect time of the last successful check
+	CheckedAt   time.Time `json:"checked_at"` // Zero before the first check
+	Sessions    int       `json:"sessions"`
+	MaxSessions int       `json:"max_sessions"` // Zero means unlimited
+}
+
+// tunnelKey identifies the /tunnel requests of an IP for a relay handle.
+type tunnelKey struct {
+	ip     string
+	handle string
+}
+
+// tunnel is a remembered /tunnel answer.
+type tunnel struct {
+	info    MitmInfo
+	expires time.Time
+}
+
+// relay is a configured relay server together with its health. Relays count as up until they fail
+// their first health checks.
+type relay struct {
+	info        MitmInfo
+	name        string
+	region      string // Relays without a region form a region of their own
+	position    *GeoLocation
+	maxSessions int
+	up          bool
+	failures    int
+	latency     time.Duration
+	checked     time.Time
 }
 
-// MitmDomain abstracts the mitm logic for handling netplay relays.
+// available returns whether the relay is up and has room for another session.
+func (r *relay) available(loads map[string]int) bool {
+	return r.up && (r.maxSessions == 0 || loads[r.info.Handle] < r.maxSessions)
+}
+
+// MitmDomain abstracts the mitm logic for handling netplay relays. It checks the health of the relays in the
+// background and hands out the least loaded healthy relay of the same region if the requested one is down or full.
 type MitmDomain struct {
-	server map[string]string
+	mutex        sync.RWMutex
+	relays       []*relay // Ordered by handle
+	limited      bool     // Whether any relay has a capacity
+	sessionRepo  SessionRepository
+	geoIP2Domain *GeoIP2Domain
+	config       LobbyConfig
+	logger       Logger
+	tunnelMutex  sync.Mutex
+	tunnels      map[tunnelKey]tunnel // The /tunnel answers of the last TunnelTTL
+}
+
+// NewMitmDomain creates a new MITM domain logic from a validated relay configuration. Disabled relays are
+// ignored. The session repository is used to count the sessions on the relays, without one the capacities
+// aren't enforced. The health checks need to be started with Run.
+func NewMitmDomain(
+	relayConfigs []RelayConfig,
+	sessionRepo SessionRepository,
+	geoIP2Domain *GeoIP2Domain,
+	config LobbyConfig,
+	logger Logger,
+) *MitmDomain {
+	limited := false
+	relays := make([]*relay, 0, len(relayConfigs))
+	for _, c := range relayConfigs {
+		if !c.IsEnabled() {
+			continue
+		}
+
+		r := &relay{
+			info:        MitmInfo{c.Handle, c.Host, c.IPv6, c.Port},
+			name:        c.Name,
+			region:      strings.ToLower(c.Region),
+			maxSessions: c.MaxSessions,
+			up:          true,
+		}
+		if r.name == "" {
+			r.name = c.Handle
+		}
+		r.position = relayPosition(r.region, strings.ToLower(c.Country), c.Latitude, c.Longitude)
+		relays = append(relays, r)
+		limited = limited || r.maxSessions > 0
+	}
+	sort.Slice(relays, func(i, j int) bool { return relays[i].info.Handle < relays[j].info.Handle })
+
+	return &MitmDomain{
+		relays:       relays,
+		limited:      limited,
+		sessionRepo:  sessionRepo,
+		geoIP2Domain: geoIP2Domain,
+		config:       config,
+		logger:       logger,
+		tunnels:      make(map[tunnelKey]tunnel),
+	}
+}
+
+// relayPosition returns the configured coordinates of a relay or the center of its country or region.
+func relayPosition(region string, country string, latitude float64, longitude float64) *GeoLocation {
+	if latitude != 0 || longitude != 0 {
+		return &GeoLocation{region, latitude, longitude}
+	}
+	if center, found := countryCenters[country]; found {
+		return &GeoLocation{region, center[0], center[1]}
+	}
+	if center, found := continentCenters[region]; found {
+		return &GeoLocation{region, center[0], center[1]}
+	}
+	return nil
 }
 
-// NewMitmDomain creates a new MITM domain logic.
-func NewMitmDomain(servers map[string]string) *MitmDomain {
-	return &MitmDomain{servers}
+// GetInfo translates a MITM server handle into an address/port pair. If the relay is down or full, the
+// available relay with the fewest sessions in the same region is returned instead, ties are broken by handle.
+// The handle MitmAuto returns the available relay closest to the given IP.
+// Returns nil if the handle is unknown or no available relay is left in the region.
+func (d *MitmDomain) GetInfo(handle string, ip net.IP) *MitmInfo {
+	return d.resolve(handle, ip, d.loads())
+}
+
+// Tunnel answers a /tunnel request like GetInfo and remembers the answer for the IP and handle, see Assign.
+func (d *MitmDomain) Tunnel(handle string, ip net.IP) *MitmInfo {
+	info := d.GetInfo(handle, ip)
+	if info != nil {
+		d.rememberTunnel(tunnelKey{ip.String(), handle}, *info)
+	}
+
+	return info
 }
 
-// GetInfo translates a MITM server handle into an address/port pair.
-func (d *MitmDomain) GetInfo(handle string) *MitmInfo {
-	var server MitmInfo
+// Assign returns the relay a new tunnel of the IP to the requested handle goes through. That's the relay /tunnel
+// handed out to the IP within the TunnelTTL, even if it went down or filled up since, and GetInfo otherwise.
+// The answers are remembered per process, so hosts that reach another replica with /tunnel fall back to GetInfo.
+func (d *MitmDomain) Assign(handle string, ip net.IP) *MitmInfo {
+	d.tunnelMutex.Lock()
+	t, found := d.tunnels[tunnelKey{ip.String(), handle}]
+	d.tunnelMutex.Unlock()
 
-	address, found := d.server[handle]
-	if !found || address == "" {
+	if found && time.Now().Before(t.expires) {
+		return &t.info
+	}
+
+	return d.GetInfo(handle, ip)
+}
+
+// rememberTunnel stores a /tunnel answer for TunnelTTL and drops the expired ones once too many are remembered.
+func (d *MitmDomain) rememberTunnel(key tunnelKey, info MitmInfo) {
+	d.tunnelMutex.Lock()
+	defer d.tunnelMutex.Unlock()
+
+	now := time.Now()
+	if len(d.tunnels) >= maxTunnelCacheSize {
+		for k, t := range d.tunnels {
+			if !now.Before(t.expires) {
+				delete(d.tunnels, k)
+			}
+		}
+	}
+	if len(d.tunnels) >= maxTunnelCacheSize {
+		d.tunnels = make(map[tunnelKey]tunnel)
+	}
+
+	d.tunnels[key] = tunnel{info, now.Add(TunnelTTL)}
+}
+
+// resolve implements GetInfo for the given session counts per relay. Without counts the capacities are ignored.
+func (d *MitmDomain) resolve(handle string, ip net.IP, loads map[string]int) *MitmInfo {
+	if handle == MitmAuto {
+		return d.closest(d.locate(ip), loads)
+	}
+
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	var requested *relay
+	for _, r := range d.relays {
+		if r.info.Handle == handle {
+			requested = r
+			break
+		}
+	}
+	if requested == nil {
 		return nil
 	}
+	if requested.available(loads) {
+		info := requested.info
+		return &info
+	}
 
-	info := strings.Split(address, ":")
-	if len(info) != 2 {
+	var alternative *relay
+	for _, r := range d.relays {
+		if !r.available(loads) || r.region != requested.region {
+			continue
+		}
+
+		// The relays are ordered by handle, so the first of the least loaded relays wins
+		if alternative == nil || loads[r.info.Handle] < loads[alternative.info.Handle] {
+			alternative = r
+		}
+	}
+	if alternative == nil {
+		return nil
+	}
+
+	info := alternative.info
+	return &info
+}
+
+// locate returns the location of the IP or nil if it's unknown.
+func (d *MitmDomain) locate(ip net.IP) *GeoLocation {
+	if d.geoIP2Domain == nil || ip == nil {
+		return nil
+	}
+
+	location, err := d.geoIP2Domain.GetLocationForIP(ip)
+	if err != nil {
+		d.logger.Errorf("Can't locate IP %s for relay selection: %v", ip, err)
 		return nil
 	}
 
-	addr := info[0]
-	if addr == "" {
+	return location
+}
+
+// loads returns the session counts per relay if any relay has a capacity. Returns nil otherwise or if the sessions
+// can't be counted, the capacities aren't enforced then.
+func (d *MitmDomain) loads() map[string]int {
+	if !d.limited {
 		return nil
 	}
-	port, err := strconv.ParseInt(info[1], 10, 32)
-	if err != nil || port < 1 || port > 65535 {
+	return d.countSessions()
+}
+
+// countSessions returns the amount of active sessions per relay or nil if they can't be counted.
+func (d *MitmDomain) countSessions() map[string]int {
+	if d.sessionRepo == nil {
 		return nil
 	}
 
-	server.Address = addr
-	server.Port = uint16(port)
+	counts, err := d.sessionRepo.CountByMitmHandle(time.Now().Add(-d.config.SessionDeadline))
+	if err != nil {
+		d.logger.Errorf("Can't count the sessions of the relays: %v", err)
+		return nil
+	}
+
+	return counts
+}
+
+// closest returns the available relay closest to the location. Relays without a position are only picked if no
+// positioned relay is available, ties are broken by handle. Without a location the first available relay is picked.
+func (d *MitmDomain) closest(location *GeoLocation, loads map[string]int) *MitmInfo {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	var best *relay
+	bestDistance := math.Inf(1)
+	for _, r := range d.relays {
+		if !r.available(loads) {
+			continue
+		}
+
+		distance := math.Inf(1)
+		if location != nil && r.position != nil {
+			distance = greatCircleDistance(location, r.position)
+		}
+
+		// The relays are ordered by handle, so the first of equally close relays wins
+		if best == nil || distance < bestDistance {
+			best = r
+			bestDistance = distance
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	info := best.info
+	return &info
+}
+
+// greatCircleDistance returns the distance between two locations in kilometers.
+func greatCircleDistance(a *GeoLocation, b *GeoLocation) float64 {
+	const earthRadius = 6371
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+
+	lat1, lat2 := toRadians(a.Latitude), toRadians(b.Latitude)
+	dLat := lat2 - lat1
+	dLon := toRadians(b.Longitude - a.Longitude)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Status returns the health and load of all relays ordered by handle.
+func (d *MitmDomain) Status() []RelayStatus {
+	counts := d.countSessions()
+
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	status := make([]RelayStatus, len(d.relays))
+	for i, r := range d.relays {
+		status[i] = RelayStatus{
+			Handle:      r.info.Handle,
+			Name:        r.name,
+			Address:     r.info.Address,
+			Port:        r.info.Port,
+			Region:      r.region,
+			Up:          r.up,
+			Latency:     float64(r.latency) / float64(time.Millisecond),
+			CheckedAt:   r.checked,
+			Sessions:    counts[r.info.Handle],
+			MaxSessions: r.maxSessions,
+		}
+	}
+
+	return status
+}
+
+// List returns the relay choices for the clients ordered by handle.
+func (d *MitmDomain) List() []RelayEntry {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	entries := make([]RelayEntry, len(d.relays))
+	for i, r := range d.relays {
+		entries[i] = RelayEntry{r.info.Handle, r.name, r.region, r.up}
+	}
+
+	return entries
+}
+
+// Run checks the health of all relays periodically and blocks until the context gets canceled.
+func (d *MitmDomain) Run(ctx context.Context) {
+	if d.config.RelayCheckInterval <= 0 || len(d.relays) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(d.config.RelayCheckInterval)
+	defer ticker.Stop()
 
-	return &server
+	for {
+		d.checkAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkAll checks all relays concurrently.
+func (d *MitmDomain) checkAll(ctx context.Context) {
+	var checks sync.WaitGroup
+
+	for _, r := range d.relays {
+		checks.Add(1)
+		go func(r *relay) {
+			defer checks.Done()
+			d.check(ctx, r)
+		}(r)
+	}
+
+	checks.Wait()
+}
+
+// check connects to the relay and updates its health.
+func (d *MitmDomain) check(ctx context.Context, r *relay) {
+	dialer := net.Dialer{Timeout: d.config.RelayCheckTimeout}
+	address := net.JoinHostPort(r.info.Address, strconv.FormatUint(uint64(r.info.Port), 10))
+
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	latency := time.Since(start)
+	if ctx.Err() != nil {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	r.checked = time.Now()
+	if err != nil {
+		r.failures++
+		if r.up && r.failures >= RelayDownThreshold {
+			r.up = false
+			d.logger.Errorf("Relay %s is down: %v", r.info.Handle, err)
+		}
+		return
+	}
+	conn.Close()
+
+	r.up = true
+	r.failures = 0
+	r.latency = latency
 }
 
 // PrintForRetroarch prints out the MITM information in a format that retroarch is expecting.
 func (i *MitmInfo) PrintForRetroarch() string {
-	return fmt.Sprintf("tunnel_addr=%s\ntunnel_port=%d\n", i.Address, i.Port)
-}
\ No newline at end of file
+	str := fmt.Sprintf("tunnel_addr=%s\ntunnel_port=%d\n", i.Address, i.Port)
+	if i.AddressV6 != "" {
+		str += fmt.Sprintf("tunnel_addr6=%s\n", i.AddressV6)
+	}
+	return str
+}
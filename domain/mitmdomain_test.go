@@ -0,0 +1,312 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func setupMitmDomain(t *testing.T, servers map[string]string) *MitmDomain {
+	config := DefaultLobbyConfig()
+	config.RelayCheckTimeout = time.Second
+
+	return NewMitmDomain(ParseLegacyRelays(servers), nil, nil, config, &testLogger{})
+}
+
+// closedPort returns a local port nothing is listening on.
+func closedPort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener.Close()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
+
+func TestMitmDomainGetInfo(t *testing.T) {
+	mitmDomain := setupMitmDomain(t, map[string]string{
+		"nyc":     "nyc.example.com:55435",
+		"madrid":  "madrid.example.com:55436",
+		"broken":  "broken.example.com",
+		"noport":  "noport.example.com:0",
+		"noaddr":  ":55435",
+		"badport": "badport.example.com:port",
+	})
+
+	info := mitmDomain.GetInfo("nyc", nil)
+	require.NotNil(t, info)
+	assert.Equal(t, MitmInfo{"nyc", "nyc.example.com", "", 55435}, *info)
+
+	for _, handle := range []string{"broken", "noport", "noaddr", "badport", "unknown"} {
+		assert.Nil(t, mitmDomain.GetInfo(handle, nil), "Handle %s", handle)
+	}
+
+	assert.Len(t, mitmDomain.Status(), 2)
+	assert.Equal(t, "madrid", mitmDomain.Status()[0].Handle)
+}
+
+func TestMitmDomainFailover(t *testing.T) {
+	mitmDomain := setupMitmDomain(t, map[string]string{
+		"nyc":    "nyc.example.com:55435",
+		"madrid": "madrid.example.com:55436",
+		"tokyo":  "tokyo.example.com:55437",
+	})
+	relays := mitmDomain.relays
+	relays[0].latency = 20 * time.Millisecond // madrid
+	relays[2].latency = 10 * time.Millisecond // tokyo
+
+	relays[1].up = false
+	info := mitmDomain.GetInfo("nyc", nil)
+	require.NotNil(t, info)
+	assert.Equal(t, "madrid", info.Handle, "Ties weren't broken by handle")
+
+	// Only relays of the same region are an alternative
+	relays[1].region = "us"
+	assert.Nil(t, mitmDomain.GetInfo("nyc", nil))
+
+	relays[0].region = "us"
+	info = mitmDomain.GetInfo("nyc", nil)
+	require.NotNil(t, info)
+	assert.Equal(t, "madrid", info.Handle)
+}
+
+func TestMitmDomainTunnel(t *testing.T) {
+	mitmDomain := setupMitmDomain(t, map[string]string{
+		"nyc":    "nyc.example.com:55435",
+		"madrid": "madrid.example.com:55436",
+	})
+	host := net.ParseIP("192.168.178.2")
+	other := net.ParseIP("192.168.178.3")
+
+	info := mitmDomain.Tunnel("nyc", host)
+	require.NotNil(t, info)
+	assert.Equal(t, "nyc", info.Handle)
+
+	// The host keeps the relay of its tunnel, everybody else fails over
+	mitmDomain.relays[1].up = false // nyc
+	info = mitmDomain.Assign("nyc", host)
+	require.NotNil(t, info)
+	assert.Equal(t, "nyc", info.Handle)
+	info = mitmDomain.Assign("nyc", other)
+	require.NotNil(t, info)
+	assert.Equal(t, "madrid", info.Handle)
+
+	// Expired answers are resolved again
+	key := tunnelKey{host.String(), "nyc"}
+	remembered := mitmDomain.tunnels[key]
+	remembered.expires = time.Now()
+	mitmDomain.tunnels[key] = remembered
+	info = mitmDomain.Assign("nyc", host)
+	require.NotNil(t, info)
+	assert.Equal(t, "madrid", info.Handle)
+
+	// Unknown relays aren't remembered
+	assert.Nil(t, mitmDomain.Tunnel("unknown", host))
+	assert.Nil(t, mitmDomain.Assign("unknown", host))
+}
+
+func TestMitmDomainHealthCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	mitmDomain := setupMitmDomain(t, map[string]string{
+		"alive": listener.Addr().String(),
+		"dead":  "127.0.0.1:" + closedPort(t),
+	})
+
+	// A single failure doesn't take a relay down
+	mitmDomain.checkAll(context.Background())
+	status := mitmDomain.Status()
+	require.Len(t, status, 2)
+	assert.True(t, status[0].Up)
+	assert.False(t, status[0].CheckedAt.IsZero())
+	assert.True(t, status[1].Up)
+
+	mitmDomain.checkAll(context.Background())
+	status = mitmDomain.Status()
+	assert.True(t, status[0].Up)
+	assert.False(t, status[1].Up)
+
+	info := mitmDomain.GetInfo("dead", nil)
+	require.NotNil(t, info)
+	assert.Equal(t, "alive", info.Handle)
+}
+
+func TestMitmDomainAuto(t *testing.T) {
+	relays := []RelayConfig{
+		{Handle: "nyc", Host: "nyc.example.com", Port: 55435, Region: "NA", Latitude: 40.7, Longitude: -74},
+		{Handle: "saopaulo", Host: "saopaulo.example.com", Port: 55435, Region: "sa"},
+		{Handle: "frankfurt", Host: "frankfurt.example.com", Port: 55435, Region: "eu", Latitude: 50.1, Longitude: 8.7},
+		{Handle: "unplaced", Host: "unplaced.example.com", Port: 55435},
+	}
+	mitmDomain := NewMitmDomain(relays, nil, setupGeoip2Domain(t), DefaultLobbyConfig(), &testLogger{})
+
+	info := mitmDomain.GetInfo(MitmAuto, net.ParseIP("54.208.114.32"))
+	require.NotNil(t, info)
+	assert.Equal(t, "nyc", info.Handle)
+
+	info = mitmDomain.GetInfo(MitmAuto, net.ParseIP("46.243.122.48"))
+	require.NotNil(t, info)
+	assert.Equal(t, "frankfurt", info.Handle)
+
+	info = mitmDomain.closest(&GeoLocation{"sa", -23.5, -46.6}, nil)
+	require.NotNil(t, info)
+	assert.Equal(t, "saopaulo", info.Handle, "The relay wasn't placed in the center of its region")
+
+	// The next healthy relay is picked
+	for _, r := range mitmDomain.relays {
+		if r.info.Handle == "saopaulo" {
+			r.up = false
+		}
+	}
+	info = mitmDomain.closest(&GeoLocation{"sa", -23.5, -46.6}, nil)
+	require.NotNil(t, info)
+	assert.Equal(t, "nyc", info.Handle)
+
+	// Unlocated IPs get the first relay by handle, the latency changes with every health check
+	for _, r := range mitmDomain.relays {
+		r.latency = time.Second
+	}
+	mitmDomain.relays[3].latency = time.Millisecond
+	info = mitmDomain.GetInfo(MitmAuto, net.ParseIP("192.168.178.2"))
+	require.NotNil(t, info)
+	assert.Equal(t, "frankfurt", info.Handle)
+}
+
+func TestMitmDomainAutoCountry(t *testing.T) {
+	relays := []RelayConfig{
+		{Handle: "madrid", Host: "madrid.example.com", Port: 55435, Region: "eu", Country: "ES"},
+		{Handle: "paris", Host: "paris.example.com", Port: 55435, Region: "eu", Country: "fr"},
+		{Handle: "warsaw", Host: "warsaw.example.com", Port: 55435, Region: "eu", Country: "pl"},
+	}
+	mitmDomain := NewMitmDomain(relays, nil, setupGeoip2Domain(t), DefaultLobbyConfig(), &testLogger{})
+
+	// German hosts are closer to the center of Poland than to the centers of Spain and France
+	info := mitmDomain.GetInfo(MitmAuto, net.ParseIP("46.243.122.48"))
+	require.NotNil(t, info)
+	assert.Equal(t, "warsaw", info.Handle)
+
+	// The pick doesn't depend on the latency
+	mitmDomain.relays[0].latency = time.Millisecond
+	mitmDomain.relays[2].latency = time.Second
+	info = mitmDomain.GetInfo(MitmAuto, net.ParseIP("46.243.122.48"))
+	require.NotNil(t, info)
+	assert.Equal(t, "warsaw", info.Handle)
+
+	// Relays without a known country sit in the center of their region
+	assert.Equal(t, &GeoLocation{"eu", 50, 15}, relayPosition("eu", "", 0, 0))
+	assert.Equal(t, &GeoLocation{"eu", 50, 15}, relayPosition("eu", "zz", 0, 0))
+}
+
+func TestMitmDomainParseLegacyRelays(t *testing.T) {
+	relays := ParseLegacyRelays(map[string]string{
+		"nyc":  "nyc.example.com:55435",
+		"ipv6": "[2001:db8::1]:55436",
+		"bad":  "2001:db8::1:55436",
+	})
+
+	require.Len(t, relays, 2)
+	assert.Equal(t, RelayConfig{Handle: "ipv6", Host: "2001:db8::1", Port: 55436}, relays[0])
+	assert.Equal(t, RelayConfig{Handle: "nyc", Host: "nyc.example.com", Port: 55435}, relays[1])
+}
+
+func TestMitmDomainValidateRelays(t *testing.T) {
+	valid := RelayConfig{Handle: "nyc", Host: "nyc.example.com", Port: 55435, IPv6: "2001:db8::1"}
+	require.NoError(t, ValidateRelays([]RelayConfig{valid}))
+
+	invalidRelays := []func(c *RelayConfig){
+		func(c *RelayConfig) { c.Handle = "" },
+		func(c *RelayConfig) { c.Handle = MitmAuto },
+		func(c *RelayConfig) { c.Handle = MitmCustom },
+		func(c *RelayConfig) { c.Host = "" },
+		func(c *RelayConfig) { c.Port = 0 },
+		func(c *RelayConfig) { c.IPv6 = "1.1.1.1" },
+		func(c *RelayConfig) { c.IPv6 = "nyc.example.com" },
+		func(c *RelayConfig) { c.MaxSessions = -1 },
+	}
+	for i, modify := range invalidRelays {
+		relay := valid
+		modify(&relay)
+		assert.Error(t, ValidateRelays([]RelayConfig{relay}), "Relay %d should be invalid", i)
+	}
+
+	assert.Error(t, ValidateRelays([]RelayConfig{valid, valid}), "Duplicate handles should be invalid")
+}
+
+func TestMitmDomainList(t *testing.T) {
+	disabled := false
+	relays := []RelayConfig{
+		{Handle: "nyc", Name: "New York", Host: "nyc.example.com", Port: 55435, Region: "na"},
+		{Handle: "madrid", Host: "madrid.example.com", Port: 55435, IPv6: "2001:db8::1"},
+		{Handle: "old", Host: "old.example.com", Port: 55435, Enabled: &disabled},
+	}
+	mitmDomain := NewMitmDomain(relays, nil, nil, DefaultLobbyConfig(), &testLogger{})
+
+	assert.Equal(t, []RelayEntry{
+		{"madrid", "madrid", "", true},
+		{"nyc", "New York", "na", true},
+	}, mitmDomain.List())
+	assert.Nil(t, mitmDomain.GetInfo("old", nil), "Disabled relay was handed out")
+
+	info := mitmDomain.GetInfo("madrid", nil)
+	require.NotNil(t, info)
+	assert.Equal(t, "tunnel_addr=madrid.example.com\ntunnel_port=55435\ntunnel_addr6=2001:db8::1\n", info.PrintForRetroarch())
+}
+
+func TestMitmDomainCapacity(t *testing.T) {
+	repoMock := &SessionRepositoryMock{}
+	relays := []RelayConfig{
+		{Handle: "madrid", Host: "madrid.example.com", Port: 55435, Region: "eu", MaxSessions: 10},
+		{Handle: "frankfurt", Host: "frankfurt.example.com", Port: 55435, Region: "eu", MaxSessions: 20},
+		{Handle: "paris", Host: "paris.example.com", Port: 55435, Region: "eu"},
+		{Handle: "nyc", Host: "nyc.example.com", Port: 55435, Region: "na"},
+	}
+	mitmDomain := NewMitmDomain(relays, repoMock, nil, DefaultLobbyConfig(), &testLogger{})
+
+	loads := map[string]int{"madrid": 10, "frankfurt": 4, "paris": 7}
+	repoMock.On("CountByMitmHandle", mock.Anything).Return(loads, nil)
+
+	// Relays with room are handed out
+	info := mitmDomain.GetInfo("frankfurt", nil)
+	require.NotNil(t, info)
+	assert.Equal(t, "frankfurt", info.Handle)
+
+	// Full relays are replaced by the least loaded relay of the region
+	info = mitmDomain.GetInfo("madrid", nil)
+	require.NotNil(t, info)
+	assert.Equal(t, "frankfurt", info.Handle)
+
+	loads["frankfurt"] = 20
+	info = mitmDomain.GetInfo("madrid", nil)
+	require.NotNil(t, info)
+	assert.Equal(t, "paris", info.Handle, "Relays without a capacity are never full")
+
+	// Automatic selection skips full relays
+	info = mitmDomain.closest(&GeoLocation{"eu", 40.4, -3.7}, loads)
+	require.NotNil(t, info)
+	assert.Equal(t, "paris", info.Handle)
+
+	status := mitmDomain.Status()
+	assert.Equal(t, 20, status[0].Sessions)
+	assert.Equal(t, 20, status[0].MaxSessions)
+	assert.Equal(t, 0, status[2].MaxSessions)
+}
+
+func TestMitmDomainCapacityCountError(t *testing.T) {
+	repoMock := &SessionRepositoryMock{}
+	relays := []RelayConfig{{Handle: "madrid", Host: "madrid.example.com", Port: 55435, MaxSessions: 10}}
+	mitmDomain := NewMitmDomain(relays, repoMock, nil, DefaultLobbyConfig(), &testLogger{})
+
+	repoMock.On("CountByMitmHandle", mock.Anything).Return(nil, errors.New("test error"))
+
+	info := mitmDomain.GetInfo("madrid", nil)
+	require.NotNil(t, info, "Relays weren't handed out while the sessions couldn't be counted")
+	assert.Equal(t, "madrid", info.Handle)
+}
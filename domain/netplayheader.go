@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// The netplay protocol version RetroArch speaks since 1.10.0.
+const (
+	netplayProtocolCurrent      = 6
+	netplayProtocolCurrentMajor = 1
+	netplayProtocolCurrentMinor = 10
+)
+
+// netplayHeaderSize is the size of the connection header in bytes.
+const netplayHeaderSize = 24
+
+// The claims of a session that can mismatch its netplay handshake.
+const (
+	MismatchPassword = "password"
+	MismatchProtocol = "protocol"
+)
+
+var (
+	netplayMagic = []byte{0x52, 0x41, 0x4E, 0x50} // RANP
+	netplayFull  = []byte{0x46, 0x55, 0x4C, 0x4C} // FULL
+	netplayPoke  = []byte{0x50, 0x4F, 0x4B, 0x45} // POKE
+)
+
+// errNotNetplay is returned for a handshake that doesn't start with the netplay magic.
+var errNotNetplay = errors.New("not a netplay handshake")
+
+// netplayHeader is the connection header a RetroArch netplay host sends to new connections.
+// All values are big-endian 32 bit words.
+type netplayHeader struct {
+	Magic         uint32
+	PlatformMagic uint32
+	Compression   uint32
+	Salt          uint32 // Non-zero if the host requires a password
+	ProtocolLow   uint32
+	ProtocolHigh  uint32
+}
+
+// parseNetplayHeader parses the beginning of a netplay handshake. Returns nil without an error if the host
+// is full or sent an incomplete header.
+func parseNetplayHeader(buf []byte) (*netplayHeader, error) {
+	if len(buf) < len(netplayMagic) {
+		return nil, errNotNetplay
+	}
+	if bytes.Equal(buf[:len(netplayFull)], netplayFull) {
+		return nil, nil
+	}
+	if !bytes.Equal(buf[:len(netplayMagic)], netplayMagic) {
+		return nil, errNotNetplay
+	}
+	if len(buf) < netplayHeaderSize {
+		return nil, nil
+	}
+
+	header := &netplayHeader{}
+	if err := binary.Read(bytes.NewReader(buf[:netplayHeaderSize]), binary.BigEndian, header); err != nil {
+		return nil, err
+	}
+
+	return header, nil
+}
@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNetplayHeader encodes the connection header of a fake netplay host.
+func fakeNetplayHeader(salt uint32, protocolHigh uint32) []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, netplayHeader{
+		Magic:         binary.BigEndian.Uint32(netplayMagic),
+		PlatformMagic: 0x00000004,
+		Compression:   1,
+		Salt:          salt,
+		ProtocolLow:   5,
+		ProtocolHigh:  protocolHigh,
+	})
+	return buf.Bytes()
+}
+
+func TestParseNetplayHeader(t *testing.T) {
+	header, err := parseNetplayHeader(fakeNetplayHeader(0x1234, 6))
+	require.NoError(t, err)
+	require.NotNil(t, header)
+
+	assert.Equal(t, uint32(4), header.PlatformMagic)
+	assert.Equal(t, uint32(1), header.Compression)
+	assert.Equal(t, uint32(0x1234), header.Salt)
+	assert.Equal(t, uint32(5), header.ProtocolLow)
+	assert.Equal(t, uint32(6), header.ProtocolHigh)
+}
+
+func TestParseNetplayHeaderFullOrIncomplete(t *testing.T) {
+	header, err := parseNetplayHeader(netplayFull)
+	require.NoError(t, err)
+	assert.Nil(t, header)
+
+	header, err = parseNetplayHeader(fakeNetplayHeader(0, 6)[:10])
+	require.NoError(t, err)
+	assert.Nil(t, header)
+}
+
+func TestParseNetplayHeaderInvalid(t *testing.T) {
+	_, err := parseNetplayHeader([]byte("HTTP/1.1 400 Bad Request"))
+	assert.Equal(t, errNotNetplay, err)
+
+	_, err = parseNetplayHeader([]byte("RA"))
+	assert.Equal(t, errNotNetplay, err)
+}
@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// PrivacyMode enum
+type PrivacyMode string
+
+// PrivacyMode enum values
+const (
+	PrivacyOff  PrivacyMode = "off"  // Public listings show every host IP
+	PrivacyMITM PrivacyMode = "mitm" // Host IPs of relayed rooms are hidden
+	PrivacyAll  PrivacyMode = "all"  // Every host IP is hidden, direct rooms get a join ticket instead
+)
+
+// ErrInvalidTicket is thrown when a join ticket is malformed, expired or its room is gone.
+var ErrInvalidTicket = errors.New("Invalid join ticket")
+
+const (
+	ticketMACSize = 16
+	ticketSize    = 4 + 8 + ticketMACSize // RoomID, expiry and MAC
+)
+
+// PrivacyDomain hides the host IPs from the public listings. Clients resolve the address of a hidden direct
+// room with a short-lived join ticket. Tickets are signed instead of stored, so they cost nothing until used.
+type PrivacyDomain struct {
+	mode     PrivacyMode
+	lifetime time.Duration
+	secret   []byte
+	limiter  *RateLimiter
+}
+
+// NewPrivacyDomain returns an initalized PrivacyDomain struct. Without a configured secret a random one is
+// generated, so tickets don't survive a restart. Replicated lobbies need to share a configured secret.
+func NewPrivacyDomain(config LobbyConfig) (*PrivacyDomain, error) {
+	secret := []byte(config.JoinTicketSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("Can't generate join ticket secret: %w", err)
+		}
+	}
+
+	return &PrivacyDomain{
+		mode:     config.Privacy,
+		lifetime: config.JoinTicketLifetime,
+		secret:   secret,
+		limiter:  NewRateLimiter(config.JoinInterval, config.JoinBurst),
+	}, nil
+}
+
+// Mask removes the host IP of the session if the privacy mode requires it and adds a join ticket for
+// direct rooms. A nil PrivacyDomain doesn't mask anything.
+func (d *PrivacyDomain) Mask(s *entity.Session) {
+	if d == nil || d.mode == PrivacyOff {
+		return
+	}
+
+	if s.HostMethod == entity.HostMethodMITM {
+		s.IP = nil
+		return
+	}
+
+	if d.mode == PrivacyAll {
+		s.JoinTicket = d.issueTicket(s, time.Now())
+		s.IP = nil
+	}
+}
+
+// issueTicket creates a ticket for the session that expires after the ticket lifetime.
+func (d *PrivacyDomain) issueTicket(s *entity.Session, now time.Time) string {
+	ticket := make([]byte, ticketSize)
+	binary.BigEndian.PutUint32(ticket[0:4], uint32(s.RoomID))
+	binary.BigEndian.PutUint64(ticket[4:12], uint64(now.Add(d.lifetime).Unix()))
+	copy(ticket[12:], d.sign(ticket[:12], s.ID))
+
+	return base64.RawURLEncoding.EncodeToString(ticket)
+}
+
+// parseTicket returns the RoomID of a ticket that is not expired yet. The signature can only be checked
+// with the session, see verifyTicket.
+func (d *PrivacyDomain) parseTicket(ticket string, now time.Time) (int32, []byte, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(ticket)
+	if err != nil || len(raw) != ticketSize {
+		return 0, nil, fmt.Errorf("%w: malformed", ErrInvalidTicket)
+	}
+
+	expiry := time.Unix(int64(binary.BigEndian.Uint64(raw[4:12])), 0)
+	if now.After(expiry) {
+		return 0, nil, fmt.Errorf("%w: expired", ErrInvalidTicket)
+	}
+
+	return int32(binary.BigEndian.Uint32(raw[0:4])), raw, nil
+}
+
+// verifyTicket checks that the parsed ticket was issued for the session. Tickets are bound to the session ID,
+// so they don't resolve to a new room that reuses the RoomID.
+func (d *PrivacyDomain) verifyTicket(raw []byte, s *entity.Session) bool {
+	return hmac.Equal(raw[12:], d.sign(raw[:12], s.ID))
+}
+
+func (d *PrivacyDomain) sign(payload []byte, sessionID string) []byte {
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write(payload)
+	mac.Write([]byte(sessionID))
+	return mac.Sum(nil)[:ticketMACSize]
+}
+
+// allowJoin rate limits the ticket resolution per client network.
+func (d *PrivacyDomain) allowJoin(ip net.IP) (bool, time.Duration) {
+	return d.limiter.Allow(ip)
+}
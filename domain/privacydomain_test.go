@@ -0,0 +1,116 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+func setupPrivacyDomain(t *testing.T, mode PrivacyMode) *PrivacyDomain {
+	config := DefaultLobbyConfig()
+	config.Privacy = mode
+
+	privacyDomain, err := NewPrivacyDomain(config)
+	require.NoError(t, err)
+
+	return privacyDomain
+}
+
+func TestPrivacyDomainMask(t *testing.T) {
+	direct := testSession
+	direct.CalculateID()
+	relayed := testSession
+	relayed.HostMethod = entity.HostMethodMITM
+	relayed.CalculateID()
+
+	tests := []struct {
+		mode          PrivacyMode
+		directMasked  bool
+		relayedMasked bool
+	}{
+		{PrivacyOff, false, false},
+		{PrivacyMITM, false, true},
+		{PrivacyAll, true, true},
+	}
+
+	for _, test := range tests {
+		privacyDomain := setupPrivacyDomain(t, test.mode)
+
+		s := direct
+		privacyDomain.Mask(&s)
+		assert.Equal(t, test.directMasked, s.IP == nil, "Direct session in mode %s", test.mode)
+		assert.Equal(t, test.directMasked, s.JoinTicket != "", "Join ticket of direct session in mode %s", test.mode)
+
+		s = relayed
+		privacyDomain.Mask(&s)
+		assert.Equal(t, test.relayedMasked, s.IP == nil, "Relayed session in mode %s", test.mode)
+		assert.Equal(t, "", s.JoinTicket, "Relayed sessions are joined through the relay")
+	}
+
+	// A nil domain doesn't mask anything
+	var privacyDomain *PrivacyDomain
+	s := direct
+	privacyDomain.Mask(&s)
+	assert.NotNil(t, s.IP)
+}
+
+func TestPrivacyDomainTicket(t *testing.T) {
+	privacyDomain := setupPrivacyDomain(t, PrivacyAll)
+
+	session := testSession
+	session.CalculateID()
+	now := time.Now()
+
+	ticket := privacyDomain.issueTicket(&session, now)
+
+	roomID, raw, err := privacyDomain.parseTicket(ticket, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, session.RoomID, roomID)
+	assert.True(t, privacyDomain.verifyTicket(raw, &session))
+
+	// Tickets expire
+	_, _, err = privacyDomain.parseTicket(ticket, now.Add(privacyDomain.lifetime+time.Second))
+	assert.True(t, errors.Is(err, ErrInvalidTicket))
+
+	// Tickets are bound to the session they were issued for
+	other := session
+	other.Port = 55356
+	other.CalculateID()
+	assert.False(t, privacyDomain.verifyTicket(raw, &other))
+
+	// Tickets of another lobby secret don't verify
+	otherDomain := setupPrivacyDomain(t, PrivacyAll)
+	assert.False(t, otherDomain.verifyTicket(raw, &session))
+}
+
+func TestPrivacyDomainTicketMalformed(t *testing.T) {
+	privacyDomain := setupPrivacyDomain(t, PrivacyAll)
+
+	for _, ticket := range []string{"", "not a ticket", "AAAA"} {
+		_, _, err := privacyDomain.parseTicket(ticket, time.Now())
+		assert.True(t, errors.Is(err, ErrInvalidTicket), "Ticket '%s' wasn't rejected", ticket)
+	}
+}
+
+func TestPrivacyDomainConfiguredSecret(t *testing.T) {
+	config := DefaultLobbyConfig()
+	config.Privacy = PrivacyAll
+	config.JoinTicketSecret = "secret"
+
+	first, err := NewPrivacyDomain(config)
+	require.NoError(t, err)
+	second, err := NewPrivacyDomain(config)
+	require.NoError(t, err)
+
+	session := testSession
+	session.CalculateID()
+
+	_, raw, err := second.parseTicket(first.issueTicket(&session, time.Now()), time.Now())
+	require.NoError(t, err)
+	assert.True(t, second.verifyTicket(raw, &session), "Lobbies with the same secret don't share tickets")
+}
@@ -0,0 +1,266 @@
+package domain
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// ProbeRepository is the part of the session repository the probe workers need.
+type ProbeRepository interface {
+	GetByID(id string) (*entity.Session, error)
+	Find(deadline time.Time, filter *entity.SessionFilter) ([]entity.Session, int, error)
+	UpdateConnectivity(s *entity.Session) error
+}
+
+// ProbeDomain tests in the background whether sessions are connectable and whether they are RetroArch.
+// Every session has at most one probe in flight and unconnectable sessions get re-probed periodically.
+type ProbeDomain struct {
+	mutex         sync.Mutex
+	sessionRepo   ProbeRepository
+	eventDomain   *EventDomain
+	metricsDomain *MetricsDomain
+	config        LobbyConfig
+	logger        Logger
+	queue         chan entity.Session
+	inFlight      map[string]struct{}
+}
+
+// NewProbeDomain creates a new probe domain. The workers need to be started with Run.
+func NewProbeDomain(
+	sessionRepo ProbeRepository,
+	eventDomain *EventDomain,
+	metricsDomain *MetricsDomain,
+	config LobbyConfig,
+	logger Logger) *ProbeDomain {
+	return &ProbeDomain{
+		sessionRepo:   sessionRepo,
+		eventDomain:   eventDomain,
+		metricsDomain: metricsDomain,
+		config:        config,
+		logger:        logger,
+		queue:         make(chan entity.Session, config.ProbeQueueSize),
+		inFlight:      make(map[string]struct{}),
+	}
+}
+
+// Enqueue schedules a probe of the session without blocking. Returns false if the session is already
+// queued or the queue is full. MITM sessions are never probed, mirrored sessions get probed by their origin.
+func (d *ProbeDomain) Enqueue(s entity.Session) bool {
+	if d == nil {
+		return false
+	}
+
+	if s.HostMethod == entity.HostMethodMITM || s.Origin != "" {
+		d.metricsDomain.ObserveProbe(ProbeSkipped, 0)
+		return false
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, found := d.inFlight[s.ID]; found {
+		return false
+	}
+
+	select {
+	case d.queue <- s:
+		d.inFlight[s.ID] = struct{}{}
+		return true
+	default:
+		return false
+	}
+}
+
+// Run starts the probe workers and the re-probe scheduler and blocks until the context gets canceled.
+func (d *ProbeDomain) Run(ctx context.Context) {
+	var workers sync.WaitGroup
+
+	for i := 0; i < d.config.ProbeWorkers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			d.work(ctx)
+		}()
+	}
+
+	if d.config.ProbeRetryInterval > 0 {
+		ticker := time.NewTicker(d.config.ProbeRetryInterval)
+		defer ticker.Stop()
+
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				break loop
+			case <-ticker.C:
+				d.reprobe()
+			}
+		}
+	}
+
+	workers.Wait()
+}
+
+// work processes the probe queue until the context gets canceled.
+func (d *ProbeDomain) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-d.queue:
+			d.process(ctx, s)
+		}
+	}
+}
+
+// process probes a single session and stores the result if it changed.
+func (d *ProbeDomain) process(ctx context.Context, s entity.Session) {
+	defer func() {
+		d.mutex.Lock()
+		delete(d.inFlight, s.ID)
+		d.mutex.Unlock()
+	}()
+
+	result := s
+	d.probe(ctx, &result)
+	if ctx.Err() != nil ||
+		(result.Connectable == s.Connectable &&
+			result.IsRetroArch == s.IsRetroArch &&
+			result.ProtocolVersion == s.ProtocolVersion &&
+			result.RequiresPassword == s.RequiresPassword &&
+			result.ProbeMismatch == s.ProbeMismatch) {
+		return
+	}
+
+	if err := d.sessionRepo.UpdateConnectivity(&result); err != nil {
+		d.logger.Errorf("Can't store probe result of session %s: %v", s.ID, err)
+		return
+	}
+
+	// Publish the current state, the session might have changed while it was probed
+	session, err := d.sessionRepo.GetByID(s.ID)
+	if err != nil {
+		d.logger.Errorf("Can't get probed session %s: %v", s.ID, err)
+		return
+	}
+	if session != nil {
+		d.eventDomain.Publish(SessionEvent{SessionUpdated, *session})
+	}
+}
+
+// reprobe schedules a probe for every unconnectable session.
+func (d *ProbeDomain) reprobe() {
+	connectable := false
+	deadline := time.Now().Add(-d.config.SessionDeadline)
+	sessions, _, err := d.sessionRepo.Find(deadline, &entity.SessionFilter{Connectable: &connectable})
+	if err != nil {
+		d.logger.Errorf("Can't get unconnectable sessions: %v", err)
+		return
+	}
+
+	for _, s := range sessions {
+		d.Enqueue(s)
+	}
+}
+
+// probe connects to the session host and parses its netplay handshake header to see whether it's connectable
+// and whether it's RetroArch
+func (d *ProbeDomain) probe(ctx context.Context, s *entity.Session) {
+	s.Connectable = true
+	s.IsRetroArch = true
+	s.ProtocolVersion = 0
+	s.RequiresPassword = false
+	s.ProbeMismatch = ""
+
+	start := time.Now()
+	defer func() {
+		result := ProbeConnectable
+		if !s.Connectable {
+			result = ProbeUnreachable
+		} else if !s.IsRetroArch {
+			result = ProbeNotRetroArch
+		}
+		d.metricsDomain.ObserveProbe(result, time.Since(start))
+	}()
+
+	dialer := net.Dialer{Timeout: d.config.ProbeConnectTimeout}
+	address := net.JoinHostPort(s.IP.String(), strconv.FormatUint(uint64(s.Port), 10))
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		s.Connectable = false
+		return
+	}
+	defer conn.Close()
+
+	// Ignore write errors
+	conn.SetWriteDeadline(time.Now().Add(d.config.ProbeReadTimeout))
+	conn.Write(netplayPoke)
+
+	conn.SetReadDeadline(time.Now().Add(d.config.ProbeReadTimeout))
+	buf := make([]byte, netplayHeaderSize)
+	read, _ := io.ReadFull(conn, buf)
+
+	// Assume it's RetroArch on recv error
+	if read == 0 {
+		return
+	}
+
+	header, err := parseNetplayHeader(buf[:read])
+	if err != nil {
+		s.IsRetroArch = false
+		return
+	}
+
+	// A full host only sends its magic
+	if header == nil {
+		return
+	}
+
+	s.ProtocolVersion = header.ProtocolHigh
+	s.RequiresPassword = header.Salt != 0
+	s.ProbeMismatch = probeMismatch(s)
+}
+
+// probeMismatch lists the claims of the session that don't match its handshake header.
+func probeMismatch(s *entity.Session) string {
+	var mismatches []string
+
+	if (s.HasPassword || s.HasSpectatePassword) != s.RequiresPassword {
+		mismatches = append(mismatches, MismatchPassword)
+	}
+
+	if major, minor, ok := parseRetroArchVersion(s.RetroArchVersion); ok {
+		current := major > netplayProtocolCurrentMajor || (major == netplayProtocolCurrentMajor && minor >= netplayProtocolCurrentMinor)
+		if current != (s.ProtocolVersion >= netplayProtocolCurrent) {
+			mismatches = append(mismatches, MismatchProtocol)
+		}
+	}
+
+	return strings.Join(mismatches, ",")
+}
+
+// parseRetroArchVersion parses the major and minor version of a RetroArch version like "1.10.3" or "1.9.0-git".
+func parseRetroArchVersion(version string) (int, int, bool) {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err := strconv.Atoi(strings.TrimRightFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' }))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return major, minor, true
+}
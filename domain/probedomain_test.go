@@ -0,0 +1,234 @@
+package domain
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+func setupProbeDomain(t *testing.T) (*ProbeDomain, *SessionRepositoryMock) {
+	repoMock := SessionRepositoryMock{}
+
+	config := DefaultLobbyConfig()
+	config.ProbeWorkers = 2
+	config.ProbeQueueSize = 4
+	config.ProbeRetryInterval = 0
+	config.ProbeConnectTimeout = time.Second
+	config.ProbeReadTimeout = time.Second
+
+	probeDomain := NewProbeDomain(&repoMock, NewEventDomain(EventBufferSize), NewMetricsDomain(), config, &testLogger{})
+
+	return probeDomain, &repoMock
+}
+
+// listenFakeHost starts a local host that answers every connection with the given reply.
+func listenFakeHost(t *testing.T, reply []byte) uint16 {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write(reply)
+			conn.Close()
+		}
+	}()
+
+	return uint16(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestProbeDomainEnqueueDedupe(t *testing.T) {
+	probeDomain, _ := setupProbeDomain(t)
+
+	session := testSession
+	session.CalculateID()
+
+	assert.True(t, probeDomain.Enqueue(session))
+	assert.False(t, probeDomain.Enqueue(session), "Session was queued twice")
+
+	session.HostMethod = entity.HostMethodMITM
+	session.Port = 55356
+	session.CalculateID()
+	assert.False(t, probeDomain.Enqueue(session), "MITM session was queued")
+}
+
+func TestProbeDomainEnqueueFullQueue(t *testing.T) {
+	probeDomain, _ := setupProbeDomain(t)
+
+	session := testSession
+	for port := uint16(1); port <= 4; port++ {
+		session.Port = port
+		session.CalculateID()
+		require.True(t, probeDomain.Enqueue(session))
+	}
+
+	session.Port = 5
+	session.CalculateID()
+	assert.False(t, probeDomain.Enqueue(session), "Full queue didn't drop the session")
+}
+
+func TestProbeDomainConnectable(t *testing.T) {
+	probeDomain, repoMock := setupProbeDomain(t)
+	subscription := probeDomain.eventDomain.Subscribe()
+
+	session := testSession
+	session.IP = net.ParseIP("127.0.0.1")
+	session.Port = listenFakeHost(t, fakeNetplayHeader(0, 6))
+	session.Connectable = false
+	session.IsRetroArch = false
+	session.CalculateID()
+
+	probed := session
+	probed.Connectable = true
+	probed.IsRetroArch = true
+
+	repoMock.On("UpdateConnectivity", mock.MatchedBy(
+		func(s *entity.Session) bool {
+			return s.ID == session.ID && s.Connectable && s.IsRetroArch
+		})).Return(nil)
+	repoMock.On("GetByID", session.ID).Return(&probed, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go probeDomain.Run(ctx)
+
+	require.True(t, probeDomain.Enqueue(session))
+
+	select {
+	case event := <-subscription.Events():
+		assert.Equal(t, SessionUpdated, event.Type)
+		assert.True(t, event.Session.Connectable)
+		assert.True(t, event.Session.IsRetroArch)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Probe result wasn't published")
+	}
+}
+
+func TestProbeDomainUnreachable(t *testing.T) {
+	probeDomain, repoMock := setupProbeDomain(t)
+	subscription := probeDomain.eventDomain.Subscribe()
+
+	// Reserve a port and close it again, so nothing is listening on it
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+
+	session := testSession
+	session.IP = net.ParseIP("127.0.0.1")
+	session.Port = port
+	session.Connectable = true
+	session.IsRetroArch = true
+	session.CalculateID()
+
+	probed := session
+	probed.Connectable = false
+
+	repoMock.On("UpdateConnectivity", mock.MatchedBy(
+		func(s *entity.Session) bool {
+			return s.ID == session.ID && !s.Connectable
+		})).Return(nil)
+	repoMock.On("GetByID", session.ID).Return(&probed, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go probeDomain.Run(ctx)
+
+	require.True(t, probeDomain.Enqueue(session))
+
+	select {
+	case event := <-subscription.Events():
+		assert.False(t, event.Session.Connectable)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Probe result wasn't published")
+	}
+
+	// The session can be queued again once the probe finished
+	assert.Eventually(t, func() bool { return probeDomain.Enqueue(session) }, time.Second, 10*time.Millisecond)
+}
+
+func TestProbeDomainHandshake(t *testing.T) {
+	probeDomain, _ := setupProbeDomain(t)
+
+	session := testSession
+	session.IP = net.ParseIP("127.0.0.1")
+	session.RetroArchVersion = "1.10.3"
+	session.HasPassword = true
+	session.Port = listenFakeHost(t, fakeNetplayHeader(0x1234, 6))
+
+	probeDomain.probe(context.Background(), &session)
+	assert.True(t, session.Connectable)
+	assert.True(t, session.IsRetroArch)
+	assert.Equal(t, uint32(6), session.ProtocolVersion)
+	assert.True(t, session.RequiresPassword)
+	assert.Equal(t, "", session.ProbeMismatch)
+}
+
+func TestProbeDomainHandshakeMismatch(t *testing.T) {
+	probeDomain, _ := setupProbeDomain(t)
+
+	session := testSession
+	session.IP = net.ParseIP("127.0.0.1")
+	session.RetroArchVersion = "1.9.0-git"
+	session.HasPassword = false
+	session.Port = listenFakeHost(t, fakeNetplayHeader(0x1234, 6))
+
+	probeDomain.probe(context.Background(), &session)
+	assert.True(t, session.IsRetroArch)
+	assert.True(t, session.RequiresPassword)
+	assert.Equal(t, MismatchPassword+","+MismatchProtocol, session.ProbeMismatch)
+}
+
+func TestProbeDomainHandshakeFull(t *testing.T) {
+	probeDomain, _ := setupProbeDomain(t)
+
+	session := testSession
+	session.IP = net.ParseIP("127.0.0.1")
+	session.Port = listenFakeHost(t, netplayFull)
+
+	probeDomain.probe(context.Background(), &session)
+	assert.True(t, session.Connectable)
+	assert.True(t, session.IsRetroArch)
+	assert.Equal(t, uint32(0), session.ProtocolVersion)
+	assert.Equal(t, "", session.ProbeMismatch)
+}
+
+func TestProbeDomainNotRetroArch(t *testing.T) {
+	probeDomain, _ := setupProbeDomain(t)
+
+	session := testSession
+	session.IP = net.ParseIP("127.0.0.1")
+	session.Port = listenFakeHost(t, []byte("SSH-2.0-OpenSSH_8.9\r\n"))
+
+	probeDomain.probe(context.Background(), &session)
+	assert.True(t, session.Connectable)
+	assert.False(t, session.IsRetroArch)
+}
+
+func TestProbeDomainReprobe(t *testing.T) {
+	probeDomain, repoMock := setupProbeDomain(t)
+
+	session := testSession
+	session.Connectable = false
+	session.CalculateID()
+
+	repoMock.On("Find", mock.Anything, mock.MatchedBy(
+		func(f *entity.SessionFilter) bool {
+			return f.Connectable != nil && !*f.Connectable
+		})).Return([]entity.Session{session}, 1, nil)
+
+	probeDomain.reprobe()
+
+	assert.False(t, probeDomain.Enqueue(session), "Unconnectable session wasn't queued")
+}
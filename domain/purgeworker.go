@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// PurgeInterval is the default interval between two purges of old sessions.
+const PurgeInterval = 2 * time.Minute
+
+// purgeMinBackoff is the delay before the first retry of a failed purge.
+const purgeMinBackoff = time.Second
+
+// Logger is the logging interface used by the background workers.
+type Logger interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Purger is anything that can purge old sessions.
+type Purger interface {
+	PurgeOld() error
+}
+
+// PurgeWorker periodically purges old sessions. Failed purges are retried with an exponential backoff
+// that is capped at the purge interval.
+type PurgeWorker struct {
+	purger   Purger
+	interval time.Duration
+	logger   Logger
+}
+
+// NewPurgeWorker creates a new purge worker.
+func NewPurgeWorker(purger Purger, interval time.Duration, logger Logger) *PurgeWorker {
+	return &PurgeWorker{purger, interval, logger}
+}
+
+// Run purges old sessions until the context gets canceled.
+func (w *PurgeWorker) Run(ctx context.Context) {
+	backoff := purgeMinBackoff
+	delay := time.Duration(0)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		if err := w.purger.PurgeOld(); err != nil {
+			w.logger.Errorf("Can't purge old sessions, retrying in %s: %v", backoff, err)
+			delay = backoff
+			backoff *= 2
+			if backoff > w.interval {
+				backoff = w.interval
+			}
+			continue
+		}
+
+		backoff = purgeMinBackoff
+		delay = w.interval
+	}
+}
@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testLogger struct {
+	mutex  sync.Mutex
+	errors int
+}
+
+func (l *testLogger) Errorf(format string, args ...interface{}) {
+	l.mutex.Lock()
+	l.errors++
+	l.mutex.Unlock()
+}
+
+type flakyPurger struct {
+	mutex    sync.Mutex
+	failures int
+	calls    int
+	done     chan struct{}
+}
+
+func (p *flakyPurger) PurgeOld() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.calls++
+	if p.calls <= p.failures {
+		return errors.New("database is locked")
+	}
+	if p.calls == p.failures+1 {
+		close(p.done)
+	}
+	return nil
+}
+
+func TestPurgeWorkerRetriesFailedPurges(t *testing.T) {
+	purger := &flakyPurger{failures: 1, done: make(chan struct{})}
+	logger := &testLogger{}
+	worker := NewPurgeWorker(purger, time.Hour, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		worker.Run(ctx)
+		close(stopped)
+	}()
+
+	select {
+	case <-purger.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Purge worker did not retry the failed purge")
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Purge worker did not stop after the context got canceled")
+	}
+
+	assert.Equal(t, 2, purger.calls)
+	assert.Equal(t, 1, logger.errors)
+}
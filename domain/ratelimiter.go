@@ -0,0 +1,89 @@
+package domain
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket rate limiter keyed by the client network. IPv4 clients are limited
+// by their address, IPv6 clients by their /64 prefix.
+type RateLimiter struct {
+	mutex       sync.Mutex
+	interval    time.Duration // Time to refill a single token
+	burst       float64
+	buckets     map[string]*tokenBucket
+	lastCleanup time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a rate limiter that allows burst requests at once and refills one token per interval.
+// An interval of zero disables the limiter.
+func NewRateLimiter(interval time.Duration, burst int) *RateLimiter {
+	return &RateLimiter{
+		interval:    interval,
+		burst:       float64(burst),
+		buckets:     make(map[string]*tokenBucket),
+		lastCleanup: time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of the given IP. If the bucket is empty, false is returned together
+// with the duration until the next token is available.
+func (l *RateLimiter) Allow(ip net.IP) (bool, time.Duration) {
+	if l.interval <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	key := rateLimitKey(ip)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.cleanup(now)
+
+	bucket, found := l.buckets[key]
+	if !found {
+		bucket = &tokenBucket{l.burst, now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(l.burst, bucket.tokens+float64(now.Sub(bucket.last))/float64(l.interval))
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) * float64(l.interval))
+	}
+
+	bucket.tokens--
+	return true, 0
+}
+
+// cleanup drops all buckets that are full again. Needs to be called with the mutex held.
+func (l *RateLimiter) cleanup(now time.Time) {
+	refill := time.Duration(l.burst * float64(l.interval))
+	if now.Sub(l.lastCleanup) < refill {
+		return
+	}
+
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastCleanup = now
+}
+
+// rateLimitKey returns the IPv4 address or the /64 prefix of an IPv6 address.
+func rateLimitKey(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String()
+	}
+	return ip.Mask(net.CIDRMask(64, 128)).String()
+}
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	limiter := NewRateLimiter(time.Minute, 2)
+	ip := net.ParseIP("88.12.123.77")
+
+	allowed, _ := limiter.Allow(ip)
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow(ip)
+	assert.True(t, allowed)
+
+	allowed, retryAfter := limiter.Allow(ip)
+	assert.False(t, allowed)
+	assert.True(t, retryAfter > 59*time.Second && retryAfter <= time.Minute, "Unexpected retry after %s", retryAfter)
+
+	allowed, _ = limiter.Allow(net.ParseIP("88.12.123.78"))
+	assert.True(t, allowed, "Other IPs should have their own bucket")
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	limiter := NewRateLimiter(10*time.Millisecond, 1)
+	ip := net.ParseIP("88.12.123.77")
+
+	allowed, _ := limiter.Allow(ip)
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow(ip)
+	assert.False(t, allowed)
+
+	time.Sleep(15 * time.Millisecond)
+	allowed, _ = limiter.Allow(ip)
+	assert.True(t, allowed)
+}
+
+func TestRateLimiterIPv6Prefix(t *testing.T) {
+	limiter := NewRateLimiter(time.Minute, 1)
+
+	allowed, _ := limiter.Allow(net.ParseIP("2001:db8:1:2::1"))
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow(net.ParseIP("2001:db8:1:2:ffff::2"))
+	assert.False(t, allowed, "Addresses of the same /64 should share a bucket")
+	allowed, _ = limiter.Allow(net.ParseIP("2001:db8:1:3::1"))
+	assert.True(t, allowed)
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	limiter := NewRateLimiter(0, 0)
+
+	for i := 0; i < 10; i++ {
+		allowed, _ := limiter.Allow(testIP)
+		assert.True(t, allowed)
+	}
+}
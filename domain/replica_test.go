@@ -0,0 +1,190 @@
+package domain
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/libretro/netplay-lobby-server-go/model"
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+	"github.com/libretro/netplay-lobby-server-go/model/repository"
+)
+
+// replica is a lobby process with its own database connection and in-process state.
+type replica struct {
+	sessionDomain *SessionDomain
+	adminDomain   *AdminDomain
+	leaseDomain   *LeaseDomain
+	sessionRepo   *repository.SessionRepository
+}
+
+// racingSessionRepository misses the first lookup of a session, like a replica that looked it up right before
+// another replica created it.
+type racingSessionRepository struct {
+	SessionRepository
+	missed bool
+}
+
+func (r *racingSessionRepository) GetByID(id string) (*entity.Session, error) {
+	if !r.missed {
+		r.missed = true
+		return nil, nil
+	}
+	return r.SessionRepository.GetByID(id)
+}
+
+// setupReplicas starts two replicas that share one sqlite file.
+func setupReplicas(t *testing.T) (*replica, *replica) {
+	path := filepath.Join(t.TempDir(), "lobby.db")
+	return setupReplica(t, path, false), setupReplica(t, path, true)
+}
+
+func setupReplica(t *testing.T, path string, racing bool) *replica {
+	db, err := model.GetSqliteDB(path)
+	require.NoError(t, err, "Can't open sqlite3 db")
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, db.AutoMigrate(&entity.Session{}, &entity.Ban{}, &entity.SessionHistory{}, &entity.Lease{}, &entity.WebhookDelivery{}).Error)
+
+	sessionRepo := repository.NewSessionRepository(db)
+	var domainRepo SessionRepository = sessionRepo
+	if racing {
+		domainRepo = &racingSessionRepository{SessionRepository: sessionRepo}
+	}
+
+	validationDomain, err := NewValidationDomain(testStringBlacklist, testIPBlacklist)
+	require.NoError(t, err)
+
+	config := DefaultLobbyConfig()
+	eventDomain := NewEventDomain(EventBufferSize)
+	metricsDomain := NewMetricsDomain()
+	probeDomain := NewProbeDomain(domainRepo, eventDomain, metricsDomain, config, &testLogger{})
+	statsDomain := NewStatsDomain(repository.NewHistoryRepository(db))
+	privacyDomain, err := NewPrivacyDomain(config)
+	require.NoError(t, err)
+	sessionDomain := NewSessionDomain(domainRepo, setupGeoip2Domain(t), validationDomain, metricsDomain, config, SessionDomainOptions{
+		Events:  eventDomain,
+		Probe:   probeDomain,
+		Stats:   statsDomain,
+		Privacy: privacyDomain,
+	})
+
+	leaseDomain, err := NewLeaseDomain(repository.NewLeaseRepository(db))
+	require.NoError(t, err)
+
+	adminDomain, err := NewAdminDomain(sessionRepo, sessionDomain, repository.NewBanRepository(db), validationDomain)
+	require.NoError(t, err)
+
+	return &replica{sessionDomain, adminDomain, leaseDomain, sessionRepo}
+}
+
+func TestReplicasCreateRace(t *testing.T) {
+	a, b := setupReplicas(t)
+
+	request := testRequest
+	created, err := a.sessionDomain.Add(&request, testIP)
+	require.NoError(t, err)
+	require.NotEmpty(t, created.Token)
+
+	// The second replica didn't see the session yet and tries to create it as well
+	subscription := b.sessionDomain.GetEvents().Subscribe()
+	playerCount := int16(3)
+	request = testRequest
+	request.PlayerCount = &playerCount
+	raced, err := b.sessionDomain.Add(&request, testIP)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, raced.ID)
+	assert.Equal(t, created.RoomID, raced.RoomID)
+	assert.Empty(t, raced.Token, "The room token got replaced")
+
+	// It touched the session instead
+	saved, err := b.sessionRepo.GetByID(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int16(3), saved.PlayerCount)
+	assert.Equal(t, int16(3), saved.PeakPlayerCount)
+	assert.True(t, saved.UpdatedAt.After(created.UpdatedAt), "The session wasn't touched")
+	event := <-subscription.Events()
+	assert.Equal(t, SessionTouched, event.Type)
+	assert.Equal(t, created.ID, event.Session.ID)
+
+	sessions, err := b.sessionDomain.List()
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(sessions))
+}
+
+func TestReplicasPurgeLeader(t *testing.T) {
+	a, b := setupReplicas(t)
+	purgerA := a.leaseDomain.Purger(a.sessionDomain, time.Minute)
+	purgerB := b.leaseDomain.Purger(b.sessionDomain, time.Minute)
+
+	createOld := func(port uint16) {
+		session := testSession
+		session.Port = port
+		session.UpdatedAt = time.Now().Add(-2 * time.Minute)
+		session.CalculateID()
+		session.CalculateContentHash()
+		require.NoError(t, a.sessionRepo.Create(&session))
+	}
+	countAll := func() int {
+		sessions, err := a.sessionRepo.GetAll(time.Time{})
+		require.NoError(t, err)
+		return len(sessions)
+	}
+
+	createOld(55355)
+	require.NoError(t, purgerA.PurgeOld())
+	assert.Equal(t, 0, countAll())
+
+	// Only the leader purges
+	createOld(55356)
+	require.NoError(t, purgerB.PurgeOld())
+	assert.Equal(t, 1, countAll())
+
+	// The other replica takes over as soon as the leader released its lease
+	require.NoError(t, a.leaseDomain.ReleaseAll())
+	require.NoError(t, purgerB.PurgeOld())
+	assert.Equal(t, 0, countAll())
+
+	createOld(55357)
+	require.NoError(t, purgerA.PurgeOld())
+	assert.Equal(t, 1, countAll())
+}
+
+func TestReplicasBanReload(t *testing.T) {
+	a, b := setupReplicas(t)
+
+	_, err := a.adminDomain.Ban(entity.BanTypeIP, testIP.String(), "griefing")
+	require.NoError(t, err)
+
+	require.NoError(t, b.adminDomain.Reload())
+	assert.Equal(t, 1, len(b.adminDomain.ListBans()))
+
+	request := testRequest
+	_, err = b.sessionDomain.Add(&request, testIP)
+	assert.True(t, errors.Is(err, ErrSessionRejected), "Banned IP wasn't rejected")
+}
+
+func TestReplicasEventFeed(t *testing.T) {
+	a, b := setupReplicas(t)
+	feed := NewEventFeedDomain(b.sessionRepo, b.sessionDomain.GetEvents(), DefaultLobbyConfig(), &testLogger{})
+	require.NoError(t, feed.Poll())
+	subscription := b.sessionDomain.GetEvents().Subscribe()
+
+	request := testRequest
+	created, err := a.sessionDomain.Add(&request, testIP)
+	require.NoError(t, err)
+
+	require.NoError(t, feed.Poll())
+	event := <-subscription.Events()
+	assert.Equal(t, SessionCreated, event.Type)
+	assert.Equal(t, created.RoomID, event.Session.RoomID)
+
+	require.NoError(t, a.sessionDomain.Remove(&RemoveSessionRequest{created.RoomID, created.Token}))
+	require.NoError(t, feed.Poll())
+	event = <-subscription.Events()
+	assert.Equal(t, SessionRemoved, event.Type)
+	assert.Equal(t, created.RoomID, event.Session.RoomID)
+}
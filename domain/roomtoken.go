@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidRoomToken is thrown when a request carries a room token that doesn't belong to the room, or none
+// although the room requires it.
+var ErrInvalidRoomToken = errors.New("Invalid room token")
+
+// roomTokenSize is the amount of random bytes of a room token.
+const roomTokenSize = 16
+
+// newRoomToken creates a random room token and returns it together with its hash. Only the hash gets stored.
+func newRoomToken() (string, string, error) {
+	raw := make([]byte, roomTokenSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("Can't generate room token: %w", err)
+	}
+
+	token := hex.EncodeToString(raw)
+	return token, hashRoomToken(token), nil
+}
+
+// hashRoomToken returns the hex encoded SHA-256 hash of a room token.
+func hashRoomToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// checkRoomToken compares a room token with the stored hash in constant time.
+func checkRoomToken(token string, hash string) bool {
+	if token == "" || hash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashRoomToken(token)), []byte(hash)) == 1
+}
@@ -1,20 +1,20 @@
 package domain
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/libretro/netplay-lobby-server-go/model/entity"
 )
 
-// SessionDeadline is lifespan of a session that hasn't recieved any updated in seconds.
+// SessionDeadline is the default lifespan of a session that hasn't recieved any updated in seconds.
 const SessionDeadline = 60
 
-// RateLimit is the maximal rate a client can send an update (every five seconds)
+// RateLimit is the default maximal rate a client can send an update (every five seconds)
 const RateLimit = 5
 
 // requestType enum
@@ -27,6 +27,16 @@ const (
 	SessionTouch
 )
 
+func (t requestType) String() string {
+	switch t {
+	case SessionCreate:
+		return "create"
+	case SessionUpdate:
+		return "update"
+	}
+	return "touch"
+}
+
 // AddSessionRequest defines the request for the SessionDomain.Add() request.
 type AddSessionRequest struct {
 	Username            string `form:"username"`
@@ -47,23 +57,75 @@ type AddSessionRequest struct {
 	MITMCustomPort      uint16 `form:"mitm_custom_port"`
 	PlayerCount         *int16 `form:"player_count"`
 	SpectatorCount      *int16 `form:"spectator_count"`
+	RoomToken           string `form:"room_token"` // Returned on creation, optional for legacy clients
+}
+
+// RemoveSessionRequest defines the request for the SessionDomain.Remove() request.
+type RemoveSessionRequest struct {
+	RoomID    int32  `form:"room_id"`
+	RoomToken string `form:"room_token"`
 }
 
+// ListSessionsRequest defines the request for the SessionDomain.Search() request.
+type ListSessionsRequest struct {
+	CoreName         string `query:"core_name"`
+	GameCRC          string `query:"game_crc"`
+	Country          string `query:"country"`
+	HostMethod       string `query:"host_method"`
+	HasPassword      string `query:"has_password"`      // 1/0 or true/false
+	Connectable      string `query:"connectable"`       // 1/0 or true/false
+	RetroArchVersion string `query:"retroarch_version"` // Version prefix
+	Search           string `query:"search"`            // Substring of the username or game name
+	Sort             string `query:"sort"`              // Comma separated sort fields, prefixed with '-' for descending order
+	Limit            int    `query:"limit"`
+	Offset           int    `query:"offset"`
+}
+
+// MaxListLimit is the maximal page size of a filtered session list.
+const MaxListLimit = 1000
+
 // ErrSessionRejected is thrown when a session got rejected by the domain logic.
 var ErrSessionRejected = errors.New("Session rejected")
 
+// ErrSessionNotFound is thrown when a session doesn't exist (anymore).
+var ErrSessionNotFound = errors.New("Session not found")
+
 // ErrRateLimited is thrown when the rate limit is reached for a particular session.
 var ErrRateLimited = errors.New("Rate limit reached")
 
+// RateLimitError is thrown when a client got rate limited. It wraps ErrRateLimited.
+type RateLimitError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%v: %s, retry after %s", ErrRateLimited, e.Reason, e.RetryAfter)
+}
+
+// Unwrap returns ErrRateLimited.
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// ErrInvalidFilter is thrown when a session list request contains invalid filter values.
+var ErrInvalidFilter = errors.New("Invalid filter")
+
 // SessionRepository interface to decouple the domain logic from the repository code.
 type SessionRepository interface {
 	Create(s *entity.Session) error
 	GetByID(id string) (*entity.Session, error)
 	GetByRoomID(roomID int32) (*entity.Session, error)
 	GetAll(deadline time.Time) ([]entity.Session, error)
+	Find(deadline time.Time, filter *entity.SessionFilter) ([]entity.Session, int, error)
+	CountByIP(ip net.IP, deadline time.Time) (int, error)
+	CountByMitmHandle(deadline time.Time) (map[string]int, error)
+	GetByOrigin(origin string) ([]entity.Session, error)
 	Update(s *entity.Session) error
 	Touch(s *entity.Session) error
-	PurgeOld(deadline time.Time) error
+	UpdateConnectivity(s *entity.Session) error
+	DeleteByRoomID(roomID int32) error
+	PurgeOld(deadline time.Time, archive bool) ([]entity.Session, error)
 }
 
 // SessionDomain abstracts the domain logic for netplay session handling.
@@ -72,6 +134,31 @@ type SessionDomain struct {
 	geopip2Domain    *GeoIP2Domain
 	validationDomain *ValidationDomain
 	mitmDomain       *MitmDomain
+	eventDomain      *EventDomain
+	metricsDomain    *MetricsDomain
+	probeDomain      *ProbeDomain
+	statsDomain      *StatsDomain
+	privacyDomain    *PrivacyDomain
+	customRelay      *CustomRelayDomain
+	gameDatabase     *GameDatabaseDomain
+	coreInfo         *CoreInfoDomain
+	webhooks         *WebhookDomain
+	config           LobbyConfig
+	createLimiter    *RateLimiter // Per process, so every replica grants the full burst
+}
+
+// SessionDomainOptions holds the optional collaborators of the SessionDomain. Unset ones are disabled or replaced
+// by a default, see NewSessionDomain.
+type SessionDomainOptions struct {
+	Mitm         *MitmDomain         // Relays and their capacities, no relays if unset
+	Events       *EventDomain        // Bus the session changes are published to, a private one if unset
+	Probe        *ProbeDomain        // Connectivity probe of new and changed sessions, no probes if unset
+	Stats        *StatsDomain        // Archive of ended sessions, nothing is archived if unset
+	Privacy      *PrivacyDomain      // Masking of host IPs, no join tickets if unset
+	CustomRelay  *CustomRelayDomain  // Validation of custom relays, the default validation if unset
+	GameDatabase *GameDatabaseDomain // Identification of the games, nothing is identified if unset
+	CoreInfo     *CoreInfoDomain     // Core metadata, none is attached if unset
+	Webhooks     *WebhookDomain      // Webhook notifications, nothing is notified if unset
 }
 
 // NewSessionDomain returns an initalized SessionDomain struct.
@@ -79,14 +166,71 @@ func NewSessionDomain(
 	sessionRepo SessionRepository,
 	geoIP2Domain *GeoIP2Domain,
 	validationDomain *ValidationDomain,
-	mitmDomain *MitmDomain) *SessionDomain {
-	return &SessionDomain{sessionRepo, geoIP2Domain, validationDomain, mitmDomain}
+	metricsDomain *MetricsDomain,
+	config LobbyConfig,
+	options SessionDomainOptions) *SessionDomain {
+	if options.Mitm == nil {
+		options.Mitm = &MitmDomain{}
+	}
+	if options.Events == nil {
+		options.Events = NewEventDomain(EventBufferSize)
+	}
+	if options.CustomRelay == nil {
+		options.CustomRelay = NewCustomRelayDomain(validationDomain, config)
+	}
+	if options.GameDatabase == nil {
+		options.GameDatabase = &GameDatabaseDomain{}
+	}
+	if options.CoreInfo == nil {
+		options.CoreInfo = &CoreInfoDomain{}
+	}
+
+	return &SessionDomain{
+		sessionRepo:      sessionRepo,
+		geopip2Domain:    geoIP2Domain,
+		validationDomain: validationDomain,
+		mitmDomain:       options.Mitm,
+		eventDomain:      options.Events,
+		metricsDomain:    metricsDomain,
+		probeDomain:      options.Probe,
+		statsDomain:      options.Stats,
+		privacyDomain:    options.Privacy,
+		customRelay:      options.CustomRelay,
+		gameDatabase:     options.GameDatabase,
+		coreInfo:         options.CoreInfo,
+		webhooks:         options.Webhooks,
+		config:           config,
+		createLimiter:    NewRateLimiter(config.CreateInterval, config.CreateBurst),
+	}
 }
 
 // Add adds or updates a session, based on the incoming request from the given IP.
-// Returns ErrSessionRejected if session got rejected.
-// Returns ErrRateLimited if rate limit for a session got reached.
+// Returns ErrSessionRejected if session got rejected or the IP is blacklisted.
+// Returns ErrInvalidRoomToken if the room token is wrong, or missing although the host used it before.
+// Returns an error wrapping ErrInvalidCustomRelay if the custom relay of the session isn't allowed.
+// Returns ErrCoreNotNetplay if the core doesn't support netplay and such rooms are rejected.
+// Returns a RateLimitError wrapping ErrRateLimited if rate limit for a session or the room quota of the IP got reached.
+// Concurrent creations of the same session, like retries that reach different replicas, result in a single session.
 func (d *SessionDomain) Add(request *AddSessionRequest, ip net.IP) (*entity.Session, error) {
+	session, requestType, err := d.add(request, ip)
+
+	switch {
+	case err == nil:
+		d.metricsDomain.ObserveAdd(requestType.String())
+	case errors.Is(err, ErrSessionRejected), errors.Is(err, ErrInvalidRoomToken), errors.Is(err, ErrInvalidCustomRelay),
+		errors.Is(err, ErrCoreNotNetplay):
+		d.metricsDomain.ObserveAdd("rejected")
+	case errors.Is(err, ErrRateLimited):
+		d.metricsDomain.ObserveAdd("rate_limited")
+	default:
+		d.metricsDomain.ObserveAdd("error")
+	}
+
+	return session, err
+}
+
+// add implements Add and additionally returns the request type.
+func (d *SessionDomain) add(request *AddSessionRequest, ip net.IP) (*entity.Session, requestType, error) {
 	var err error
 	var savedSession *entity.Session
 	var requestType requestType = SessionCreate
@@ -94,22 +238,34 @@ func (d *SessionDomain) Add(request *AddSessionRequest, ip net.IP) (*entity.Sess
 	session := d.parseSession(request, ip)
 
 	if session.IP == nil || session.Port == 0 {
-		return nil, errors.New("IP or port not set")
+		return nil, requestType, errors.New("IP or port not set")
+	}
+
+	if !d.validationDomain.ValdateIP(session.IP) {
+		return nil, requestType, ErrSessionRejected
 	}
 
 	// Decide if this is a CREATE, UPDATE or TOUCH operation
 	session.CalculateID()
-	session.CalculateContentHash()
 	if savedSession, err = d.sessionRepo.GetByID(session.ID); err != nil {
-		return nil, fmt.Errorf("Can't get saved session: %w", err)
+		return nil, requestType, fmt.Errorf("Can't get saved session: %w", err)
 	}
+	d.assignRelay(session, savedSession, ip)
+	session.CalculateContentHash()
 	if savedSession != nil {
-		session.RoomID      = savedSession.RoomID
-		session.Country     = savedSession.Country
-		session.Connectable = savedSession.Connectable
-		session.IsRetroArch = savedSession.IsRetroArch
-		session.CreatedAt   = savedSession.CreatedAt
-		session.UpdatedAt   = savedSession.UpdatedAt
+		session.RoomID             = savedSession.RoomID
+		session.Country            = savedSession.Country
+		session.Connectable        = savedSession.Connectable
+		session.IsRetroArch        = savedSession.IsRetroArch
+		session.ProtocolVersion    = savedSession.ProtocolVersion
+		session.RequiresPassword   = savedSession.RequiresPassword
+		session.ProbeMismatch      = savedSession.ProbeMismatch
+		session.CreatedAt          = savedSession.CreatedAt
+		session.UpdatedAt          = savedSession.UpdatedAt
+		session.PeakPlayerCount    = maxInt16(savedSession.PeakPlayerCount, session.PlayerCount)
+		session.PeakSpectatorCount = maxInt16(savedSession.PeakSpectatorCount, session.SpectatorCount)
+		session.TokenHash          = savedSession.TokenHash
+		session.TokenRequired      = savedSession.TokenRequired
 		if savedSession.ContentHash != session.ContentHash {
 			requestType = SessionUpdate
 		} else {
@@ -117,87 +273,327 @@ func (d *SessionDomain) Add(request *AddSessionRequest, ip net.IP) (*entity.Sess
 		}
 	}
 
+	// Hosts that used their room token once need it for every further update. Legacy clients never send it.
+	if savedSession != nil {
+		if request.RoomToken != "" {
+			if !checkRoomToken(request.RoomToken, savedSession.TokenHash) {
+				return nil, requestType, ErrInvalidRoomToken
+			}
+			if !savedSession.TokenRequired {
+				// Store that the token is required from now on
+				session.TokenRequired = true
+				requestType = SessionUpdate
+			}
+		} else if savedSession.TokenRequired {
+			return nil, requestType, ErrInvalidRoomToken
+		}
+	}
+
 	// Ratelimit on UPDATE or TOUCH
 	if requestType == SessionUpdate || requestType == SessionTouch {
-		threshold := time.Now().Add(-5 * time.Second)
+		threshold := time.Now().Add(-d.config.RateLimit)
 		if savedSession.UpdatedAt.After(threshold) {
-			return nil, ErrRateLimited
+			return nil, requestType, &RateLimitError{"session update", savedSession.UpdatedAt.Sub(threshold)}
 		}
 	}
 
 	if requestType == SessionCreate || requestType == SessionUpdate {
 		// Validate session on CREATE and UPDATE
 		if !d.validateSession(session) {
-			return nil, ErrSessionRejected
+			return nil, requestType, ErrSessionRejected
+		}
+
+		// Nobody can join rooms of cores without netplay support
+		if d.config.RejectNonNetplay && session.Core != nil && !session.Core.Netplay {
+			return nil, requestType, ErrCoreNotNetplay
+		}
+
+		// Every joining client connects to a custom relay, so it gets published with the validated address
+		if session.HostMethod == entity.HostMethodMITM && session.MitmHandle == MitmCustom {
+			address, err := d.customRelay.Validate(session.MitmAddress, session.MitmPort)
+			if err != nil {
+				return nil, requestType, err
+			}
+			session.MitmAddress = address.String()
+		}
+	}
+
+	// Limit the room creations and concurrent rooms per IP on CREATE
+	if requestType == SessionCreate {
+		if err = d.checkCreateLimits(session.IP); err != nil {
+			return nil, requestType, err
 		}
 	}
 
 	// Persist session changes
+	var eventType SessionEventType
+	var token string
 	switch requestType {
 	case SessionCreate:
 		if session.Country, err = d.geopip2Domain.GetCountryCodeForIP(session.IP); err != nil {
-			return nil, fmt.Errorf("Can't find country for given IP %s: %w", session.IP, err)
+			return nil, requestType, fmt.Errorf("Can't find country for given IP %s: %w", session.IP, err)
 		}
 
-		d.trySessionConnect(session)
+		session.PeakPlayerCount = session.PlayerCount
+		session.PeakSpectatorCount = session.SpectatorCount
+
+		// Assume the session is connectable and RetroArch until the probe tells otherwise
+		session.Connectable = true
+		session.IsRetroArch = true
+
+		if token, session.TokenHash, err = newRoomToken(); err != nil {
+			return nil, requestType, err
+		}
 
 		if err = d.sessionRepo.Create(session); err != nil {
-			return nil, fmt.Errorf("Can't create new session: %w", err)
+			if savedSession, _ = d.sessionRepo.GetByID(session.ID); savedSession == nil {
+				return nil, requestType, fmt.Errorf("Can't create new session: %w", err)
+			}
+
+			// Another replica created the same session in the meantime, so this request touches it. The room
+			// token went to the request that created the session and isn't reissued.
+			savedSession.PlayerCount        = session.PlayerCount
+			savedSession.SpectatorCount     = session.SpectatorCount
+			savedSession.PeakPlayerCount    = maxInt16(savedSession.PeakPlayerCount, session.PlayerCount)
+			savedSession.PeakSpectatorCount = maxInt16(savedSession.PeakSpectatorCount, session.SpectatorCount)
+			if err = d.sessionRepo.Touch(savedSession); err != nil {
+				return nil, requestType, fmt.Errorf("Can't touch concurrently created session: %w", err)
+			}
+			session     = savedSession
+			requestType = SessionTouch
+			token       = ""
+			eventType   = SessionTouched
+			break
 		}
+		eventType = SessionCreated
 	case SessionUpdate:
-		d.trySessionConnect(session)
-
 		if err = d.sessionRepo.Update(session); err != nil {
-			return nil, fmt.Errorf("Can't update old session: %w", err)
+			return nil, requestType, fmt.Errorf("Can't update old session: %w", err)
 		}
+		eventType = SessionUpdated
 	case SessionTouch:
-		if !session.Connectable {
-			d.trySessionConnect(session)
-			if session.Connectable {
-				if err = d.sessionRepo.Update(session); err != nil {
-					return nil, fmt.Errorf("Can't update old session: %w", err)
-				}
-				break
-			}
-		}
-
 		if err = d.sessionRepo.Touch(session); err != nil {
-			return nil, fmt.Errorf("Can't touch old session: %w", err)
+			return nil, requestType, fmt.Errorf("Can't touch old session: %w", err)
 		}
+		eventType = SessionTouched
 	}
 
-	return session, nil
+	// Probe new and changed sessions and retry unconnectable ones in the background
+	if requestType != SessionTouch || !session.Connectable {
+		d.probeDomain.Enqueue(*session)
+	}
+
+	d.eventDomain.Publish(SessionEvent{eventType, *session})
+	d.notify(SessionEvent{eventType, *session})
+
+	// Only the host gets to see its room token
+	session.Token = token
+
+	return session, requestType, nil
 }
 
-// Get returns the session with the given RoomID
+// Get returns the session with the given RoomID, masked according to the privacy mode.
 func (d *SessionDomain) Get(roomID int32) (*entity.Session, error) {
 	session, err := d.sessionRepo.GetByRoomID(roomID)
 	if err != nil {
 		return nil, err
 	}
 
+	if session != nil {
+		d.present(session)
+	}
+
 	return session, nil
 }
 
-// List returns a list of all sessions that are currently being hosted
+// List returns a list of all sessions that are currently being hosted, masked according to the privacy mode.
 func (d *SessionDomain) List() ([]entity.Session, error) {
 	sessions, err := d.sessionRepo.GetAll(d.getDeadline())
 	if err != nil {
 		return nil, err
 	}
 
+	for i := range sessions {
+		d.present(&sessions[i])
+	}
+
 	return sessions, nil
 }
 
-// PurgeOld removes all sessions that have not been updated for longer than 45 seconds.
+// Search returns a filtered, sorted and paginated list of all sessions that are currently being hosted together
+// with the total count of matching sessions.
+// Returns ErrInvalidFilter if the request can't be parsed.
+func (d *SessionDomain) Search(request *ListSessionsRequest) ([]entity.Session, int, error) {
+	filter, err := d.parseFilter(request)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sessions, count, err := d.sessionRepo.Find(d.getDeadline(), filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range sessions {
+		d.present(&sessions[i])
+	}
+
+	return sessions, count, nil
+}
+
+// Remove deletes the room of a host right away instead of letting it expire. The room gets archived like an
+// expired one.
+// Returns ErrSessionNotFound if the room doesn't exist.
+// Returns ErrInvalidRoomToken if the room token doesn't belong to the room.
+func (d *SessionDomain) Remove(request *RemoveSessionRequest) error {
+	session, err := d.sessionRepo.GetByRoomID(request.RoomID)
+	if err != nil {
+		return fmt.Errorf("Can't get session to remove: %w", err)
+	}
+	if session == nil {
+		return ErrSessionNotFound
+	}
+
+	if !checkRoomToken(request.RoomToken, session.TokenHash) {
+		return ErrInvalidRoomToken
+	}
+
+	return d.end(session)
+}
+
+// Delete removes a room right away without its room token, like moderators do. The room ends like a room its
+// host removed.
+// Returns ErrSessionNotFound if the room doesn't exist.
+func (d *SessionDomain) Delete(roomID int32) (*entity.Session, error) {
+	session, err := d.sessionRepo.GetByRoomID(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("Can't get session to delete: %w", err)
+	}
+	if session == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	if err = d.end(session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// end deletes a room before it expires and publishes its removal. Local rooms get archived like expired ones
+// and the webhooks are notified, mirrored rooms are handled by their origin.
+func (d *SessionDomain) end(session *entity.Session) error {
+	if err := d.sessionRepo.DeleteByRoomID(session.RoomID); err != nil {
+		return fmt.Errorf("Can't remove session: %w", err)
+	}
+
+	// The room ends now
+	session.UpdatedAt = time.Now()
+	if session.Origin == "" {
+		if err := d.statsDomain.Archive([]entity.Session{*session}); err != nil {
+			return fmt.Errorf("Can't archive removed session: %w", err)
+		}
+	}
+
+	d.eventDomain.Publish(SessionEvent{SessionRemoved, *session})
+	if session.Origin == "" {
+		d.notify(SessionEvent{SessionRemoved, *session})
+	}
+
+	return nil
+}
+
+// Join resolves a join ticket to the session it was issued for, so the client can connect to the hidden host IP.
+// Returns ErrInvalidTicket if the ticket is malformed, expired or the session is gone.
+// Returns a RateLimitError wrapping ErrRateLimited if the IP resolved too many tickets.
+func (d *SessionDomain) Join(ticket string, ip net.IP) (*entity.Session, error) {
+	if d.privacyDomain == nil {
+		return nil, fmt.Errorf("%w: no join tickets issued", ErrInvalidTicket)
+	}
+
+	if allowed, retryAfter := d.privacyDomain.allowJoin(ip); !allowed {
+		return nil, &RateLimitError{"join ticket", retryAfter}
+	}
+
+	roomID, raw, err := d.privacyDomain.parseTicket(ticket, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := d.sessionRepo.GetByRoomID(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("Can't get session of join ticket: %w", err)
+	}
+	if session == nil || !session.UpdatedAt.After(d.getDeadline()) || !d.privacyDomain.verifyTicket(raw, session) {
+		return nil, fmt.Errorf("%w: no matching session", ErrInvalidTicket)
+	}
+
+	return session, nil
+}
+
+// PurgeOld archives and removes all sessions that have not been updated within the session deadline.
 func (d *SessionDomain) PurgeOld() error {
-	if err := d.sessionRepo.PurgeOld(d.getDeadline()); err != nil {
+	sessions, err := d.sessionRepo.PurgeOld(d.getDeadline(), d.statsDomain != nil)
+	if err != nil {
 		return err
 	}
 
+	for _, session := range sessions {
+		d.eventDomain.Publish(SessionEvent{SessionPurged, session})
+		d.notify(SessionEvent{SessionPurged, session})
+	}
+
 	return nil
 }
 
+// checkCreateLimits enforces the room quota and the creation rate limit of an IP
+func (d *SessionDomain) checkCreateLimits(ip net.IP) error {
+	if d.config.MaxRoomsPerIP > 0 {
+		rooms, err := d.sessionRepo.CountByIP(ip, d.getDeadline())
+		if err != nil {
+			return fmt.Errorf("Can't count rooms of IP %s: %w", ip, err)
+		}
+		if rooms >= d.config.MaxRoomsPerIP {
+			return &RateLimitError{"room quota", d.config.SessionDeadline}
+		}
+	}
+
+	if allowed, retryAfter := d.createLimiter.Allow(ip); !allowed {
+		return &RateLimitError{"room creation", retryAfter}
+	}
+
+	return nil
+}
+
+// assignRelay puts a session with a new tunnel on the relay /tunnel handed out to the host for the requested
+// handle, see MitmDomain.Assign. Running rooms stay on the relay they were published with as long as the host keeps
+// its tunnel, even if the relay went down, filled up or would be resolved differently by now.
+func (d *SessionDomain) assignRelay(session *entity.Session, savedSession *entity.Session, ip net.IP) {
+	if session.HostMethod != entity.HostMethodMITM || session.MitmHandle == MitmCustom {
+		return
+	}
+
+	if savedSession != nil && savedSession.HostMethod == entity.HostMethodMITM &&
+		savedSession.MitmHandle != MitmCustom && savedSession.MitmSession == session.MitmSession {
+		session.MitmHandle  = savedSession.MitmHandle
+		session.MitmAddress = savedSession.MitmAddress
+		session.MitmPort    = savedSession.MitmPort
+		return
+	}
+
+	info := d.mitmDomain.Assign(session.MitmHandle, ip)
+	if info == nil {
+		session.HostMethod  = entity.HostMethodUnknown
+		session.MitmHandle  = ""
+		session.MitmSession = ""
+		return
+	}
+
+	session.MitmHandle  = info.Handle
+	session.MitmAddress = info.Address
+	session.MitmPort    = info.Port
+}
+
 // parseSession turns a request into a session information that can be compared to a persisted session
 func (d *SessionDomain) parseSession(req *AddSessionRequest, ip net.IP) *entity.Session {
 	var hostMethod entity.HostMethod = entity.HostMethodUnknown
@@ -208,11 +604,11 @@ func (d *SessionDomain) parseSession(req *AddSessionRequest, ip net.IP) *entity.
 
 	// Set default username
 	if req.Username == "" {
-		req.Username = "Anonymous"
+		req.Username = d.config.DefaultUsername
 	}
 
 	if req.ForceMITM && req.MITMServer != "" && req.MITMSession != "" {
-		if req.MITMServer == "custom" {
+		if req.MITMServer == MitmCustom {
 			if req.MITMCustomServer != "" && req.MITMCustomPort != 0 {
 				hostMethod  = entity.HostMethodMITM
 				mitmHandle  = req.MITMServer
@@ -221,13 +617,10 @@ func (d *SessionDomain) parseSession(req *AddSessionRequest, ip net.IP) *entity.
 				mitmSession = req.MITMSession
 			}
 		} else {
-			if info := d.mitmDomain.GetInfo(req.MITMServer); info != nil {
-				hostMethod  = entity.HostMethodMITM
-				mitmHandle  = req.MITMServer
-				mitmAddress = info.Address
-				mitmPort    = info.Port
-				mitmSession = req.MITMSession
-			}
+			// The relay is picked by assignRelay
+			hostMethod  = entity.HostMethodMITM
+			mitmHandle  = req.MITMServer
+			mitmSession = req.MITMSession
 		}
 	}
 
@@ -241,12 +634,20 @@ func (d *SessionDomain) parseSession(req *AddSessionRequest, ip net.IP) *entity.
 		spcnt = *req.SpectatorCount
 	}
 
+	// Attach the canonical game and flag unknown CRCs or CRCs of systems the core doesn't emulate
+	game := d.gameDatabase.Identify(req.GameCRC, req.CoreName)
+
 	return &entity.Session{
 		Username:            req.Username,
 		GameName:            req.GameName,
 		GameCRC:             strings.ToUpper(req.GameCRC),
+		GameTitle:           game.Title,
+		GameSystem:          game.System,
+		GameRegion:          game.Region,
+		GameStatus:          game.Status,
 		CoreName:            req.CoreName,
 		CoreVersion:         req.CoreVersion,
+		Core:                d.coreInfo.Get(req.CoreName),
 		SubsystemName:       req.SubsystemName,
 		RetroArchVersion:    req.RetroArchVersion,
 		Frontend:            req.Frontend,
@@ -264,83 +665,148 @@ func (d *SessionDomain) parseSession(req *AddSessionRequest, ip net.IP) *entity.
 	}
 }
 
+// parseFilter turns a list request into a repository filter
+func (d *SessionDomain) parseFilter(req *ListSessionsRequest) (*entity.SessionFilter, error) {
+	var err error
+	filter := &entity.SessionFilter{
+		CoreName:               req.CoreName,
+		GameCRC:                req.GameCRC,
+		Country:                req.Country,
+		RetroArchVersionPrefix: req.RetroArchVersion,
+		Search:                 req.Search,
+		Limit:                  req.Limit,
+		Offset:                 req.Offset,
+	}
+
+	if req.HostMethod != "" {
+		method, err := strconv.ParseInt(req.HostMethod, 10, 64)
+		if err != nil || method < entity.HostMethodUnknown || method > entity.HostMethodMITM {
+			return nil, fmt.Errorf("%w: invalid host method '%s'", ErrInvalidFilter, req.HostMethod)
+		}
+		hostMethod := entity.HostMethod(method)
+		filter.HostMethod = &hostMethod
+	}
+	if filter.HasPassword, err = parseOptionalBool(req.HasPassword); err != nil {
+		return nil, fmt.Errorf("%w: invalid has_password value: %v", ErrInvalidFilter, err)
+	}
+	if filter.Connectable, err = parseOptionalBool(req.Connectable); err != nil {
+		return nil, fmt.Errorf("%w: invalid connectable value: %v", ErrInvalidFilter, err)
+	}
+
+	if req.Sort != "" {
+		for _, key := range strings.Split(req.Sort, ",") {
+			sort := entity.SessionSort{Field: entity.SessionSortField(strings.TrimPrefix(key, "-")), Descending: strings.HasPrefix(key, "-")}
+			if !sort.Field.IsValid() {
+				return nil, fmt.Errorf("%w: unknown sort field '%s'", ErrInvalidFilter, key)
+			}
+			filter.Sort = append(filter.Sort, sort)
+		}
+	}
+
+	if filter.Limit < 0 || filter.Limit > MaxListLimit || filter.Offset < 0 {
+		return nil, fmt.Errorf("%w: invalid limit or offset", ErrInvalidFilter)
+	}
+	if filter.Offset > 0 && filter.Limit == 0 {
+		filter.Limit = MaxListLimit
+	}
+
+	return filter, nil
+}
+
 // validateSession validates an incoming session
 func (d *SessionDomain) validateSession(s *entity.Session) bool {
-	if len(s.Username) > 32 ||
-		len(s.CoreName) > 255 ||
-		len(s.GameName) > 255 ||
+	return isValidSession(s, &d.config.MaxLength, d.validationDomain)
+}
+
+// isValidSession checks the field lengths and the string blacklist of a session
+func isValidSession(s *entity.Session, limits *FieldLimits, validationDomain *ValidationDomain) bool {
+	if len(s.Username) > limits.Username ||
+		len(s.CoreName) > limits.CoreName ||
+		len(s.GameName) > limits.GameName ||
 		len(s.GameCRC) != 8 ||
-		len(s.RetroArchVersion) > 32 ||
-		len(s.CoreVersion) > 255 ||
-		len(s.SubsystemName) > 255 ||
-		len(s.Frontend) > 255 ||
-		len(s.MitmSession) > 32 {
+		len(s.RetroArchVersion) > limits.RetroArchVersion ||
+		len(s.CoreVersion) > limits.CoreVersion ||
+		len(s.SubsystemName) > limits.SubsystemName ||
+		len(s.Frontend) > limits.Frontend ||
+		len(s.MitmSession) > limits.MitmSession {
 		return false
 	}
 
-	if !d.validationDomain.ValidateString(s.Username) ||
-		!d.validationDomain.ValidateString(s.CoreName) ||
-		!d.validationDomain.ValidateString(s.CoreVersion) ||
-		!d.validationDomain.ValidateString(s.Frontend) ||
-		!d.validationDomain.ValidateString(s.SubsystemName) ||
-		!d.validationDomain.ValidateString(s.RetroArchVersion) {
+	if !validationDomain.ValidateString(s.Username) ||
+		!validationDomain.ValidateString(s.CoreName) ||
+		!validationDomain.ValidateString(s.CoreVersion) ||
+		!validationDomain.ValidateString(s.Frontend) ||
+		!validationDomain.ValidateString(s.SubsystemName) ||
+		!validationDomain.ValidateString(s.RetroArchVersion) {
 		return false
 	}
 
 	return true
 }
 
-// trySessionConnect tests the session to see whether it's connectable and whether it's RetroArch
-func (d *SessionDomain) trySessionConnect(s *entity.Session) error {
-	s.Connectable = true
-	s.IsRetroArch = true
-
-	// If it's MITM, assume both connectable and RetroArch
-	if s.HostMethod == entity.HostMethodMITM {
-		return nil
-	}
+// present prepares a stored session for the clients. It gets masked according to the privacy mode and the
+// core metadata is attached.
+func (d *SessionDomain) present(s *entity.Session) {
+	d.privacyDomain.Mask(s)
+	s.Core = d.coreInfo.Get(s.CoreName)
+}
 
-	address   := fmt.Sprintf("%s:%d", s.IP, s.Port)
-	conn, err := net.DialTimeout("tcp", address, time.Second * 3)
-	if err != nil {
-		s.Connectable = false
-		return err
+// notify hands a session event to the webhooks. The session is presented like in the public listings.
+func (d *SessionDomain) notify(event SessionEvent) {
+	if !d.webhooks.wants(event.Type) {
+		return
 	}
 
-	ranp  := []byte{0x52,0x41,0x4E,0x50} // RANP
-	full  := []byte{0x46,0x55,0x4C,0x4C} // FULL
-	poke  := []byte{0x50,0x4F,0x4B,0x45} // POKE
-	magic := make([]byte, 4)
+	d.present(&event.Session)
+	d.webhooks.Notify(event)
+}
 
-	// Ignore write errors
-	conn.SetWriteDeadline(time.Now().Add(time.Second * 3))
-	conn.Write(poke)
+func (d *SessionDomain) getDeadline() time.Time {
+	return time.Now().Add(-d.config.SessionDeadline)
+}
 
-	conn.SetReadDeadline(time.Now().Add(time.Second * 3))
-	read, err := conn.Read(magic)
+// GetTunnel returns a tunnel's address/port pair.
+func (d *SessionDomain) GetMitm() *MitmDomain {
+	return d.mitmDomain
+}
 
-	conn.Close()
+// GetMetrics returns the metrics collector of the lobby.
+func (d *SessionDomain) GetMetrics() *MetricsDomain {
+	return d.metricsDomain
+}
 
-	// Assume it's RetroArch on recv error
-	if err != nil || read == 0 {
-		return err
-	}
+// GetConfig returns the lobby configuration.
+func (d *SessionDomain) GetConfig() LobbyConfig {
+	return d.config
+}
 
-	// Assume it's not RetroArch on incomplete magic
-	if read != len(magic) {
-		s.IsRetroArch = false
-	} else if !bytes.Equal(magic, ranp) && !bytes.Equal(magic, full) {
-		s.IsRetroArch = false
-	}
+// GetPrivacy returns the privacy domain
+func (d *SessionDomain) GetPrivacy() *PrivacyDomain {
+	return d.privacyDomain
+}
 
-	return nil
+// GetEvents returns the event bus the session changes are published to.
+func (d *SessionDomain) GetEvents() *EventDomain {
+	return d.eventDomain
 }
 
-func (d *SessionDomain) getDeadline() time.Time {
-	return time.Now().Add(-SessionDeadline * time.Second)
+func maxInt16(a int16, b int16) int16 {
+	if a > b {
+		return a
+	}
+	return b
 }
 
-// GetTunnel returns a tunnel's address/port pair.
-func (d *SessionDomain) GetMitm() *MitmDomain {
-	return d.mitmDomain
+// parseOptionalBool parses a boolean query value. An empty string returns nil.
+func parseOptionalBool(s string) (*bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &b, nil
 }
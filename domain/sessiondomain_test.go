@@ -89,6 +89,17 @@ func (m *SessionRepositoryMock) Touch(s *entity.Session) error {
 	return args.Error(0)
 }
 
+func (m *SessionRepositoryMock) CountByIP(ip net.IP, deadline time.Time) (int, error) {
+	args := m.Called(ip, deadline)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *SessionRepositoryMock) CountByMitmHandle(deadline time.Time) (map[string]int, error) {
+	args := m.Called(deadline)
+	counts, _ := args.Get(0).(map[string]int)
+	return counts, args.Error(1)
+}
+
 func (m *SessionRepositoryMock) GetByID(id string) (*entity.Session, error) {
 	args := m.Called(id)
 	session, _ := args.Get(0).(*entity.Session)
@@ -107,38 +118,112 @@ func (m *SessionRepositoryMock) GetAll(deadline time.Time) ([]entity.Session, er
 	return sessions, args.Error(1)
 }
 
-func (m *SessionRepositoryMock) PurgeOld(deadline time.Time) error {
-	args := m.Called(deadline)
+func (m *SessionRepositoryMock) GetByOrigin(origin string) ([]entity.Session, error) {
+	args := m.Called(origin)
+	sessions, _ := args.Get(0).([]entity.Session)
+	return sessions, args.Error(1)
+}
+
+func (m *SessionRepositoryMock) Find(deadline time.Time, filter *entity.SessionFilter) ([]entity.Session, int, error) {
+	args := m.Called(deadline, filter)
+	sessions, _ := args.Get(0).([]entity.Session)
+	return sessions, args.Int(1), args.Error(2)
+}
+
+func (m *SessionRepositoryMock) DeleteByRoomID(roomID int32) error {
+	args := m.Called(roomID)
+	return args.Error(0)
+}
+
+func (m *SessionRepositoryMock) UpdateConnectivity(s *entity.Session) error {
+	args := m.Called(s)
 	return args.Error(0)
 }
 
+func (m *SessionRepositoryMock) PurgeOld(deadline time.Time, archive bool) ([]entity.Session, error) {
+	args := m.Called(deadline, archive)
+	sessions, _ := args.Get(0).([]entity.Session)
+	return sessions, args.Error(1)
+}
+
+type HistoryRepositoryMock struct {
+	mock.Mock
+}
+
+func (m *HistoryRepositoryMock) Archive(history []entity.SessionHistory) error {
+	args := m.Called(history)
+	return args.Error(0)
+}
+
+func (m *HistoryRepositoryMock) GetBetween(from time.Time, to time.Time) ([]entity.SessionHistory, error) {
+	args := m.Called(from, to)
+	history, _ := args.Get(0).([]entity.SessionHistory)
+	return history, args.Error(1)
+}
+
 func setupSessionDomain(t *testing.T) (*SessionDomain, *SessionRepositoryMock) {
+	sessionDomain, repoMock, _ := setupSessionDomainWithHistory(t)
+	return sessionDomain, repoMock
+}
+
+func setupSessionDomainWithHistory(t *testing.T) (*SessionDomain, *SessionRepositoryMock, *HistoryRepositoryMock) {
 	repoMock := SessionRepositoryMock{}
+	historyMock := HistoryRepositoryMock{}
 
 	validationDomain, err := NewValidationDomain(testStringBlacklist, testIPBlacklist)
 	require.NoError(t, err)
 
 	geoip2Domain := setupGeoip2Domain(t)
 
-	sessionDomain := NewSessionDomain(&repoMock, geoip2Domain, validationDomain, &MitmDomain{})
+	config := DefaultLobbyConfig()
+	eventDomain := NewEventDomain(EventBufferSize)
+	metricsDomain := NewMetricsDomain()
+	probeDomain := NewProbeDomain(&repoMock, eventDomain, metricsDomain, config, &testLogger{})
+	statsDomain := NewStatsDomain(&historyMock)
+	privacyDomain, err := NewPrivacyDomain(config)
 	require.NoError(t, err)
-
-	return sessionDomain, &repoMock
+	sessionDomain := NewSessionDomain(&repoMock, geoip2Domain, validationDomain, metricsDomain, config, SessionDomainOptions{
+		Events:  eventDomain,
+		Probe:   probeDomain,
+		Stats:   statsDomain,
+		Privacy: privacyDomain,
+	})
+
+	return sessionDomain, &repoMock, &historyMock
 }
 
 func TestSessionDomainPurgeOld(t *testing.T) {
 	sessionDomain, repoMock := setupSessionDomain(t)
+	subscription := sessionDomain.GetEvents().Subscribe()
 
 	// Test the deadline duration
-	repoMock.On("PurgeOld", mock.MatchedBy(
+	deadlineMatcher := mock.MatchedBy(
 		func(d time.Time) bool {
 			before := time.Now().Add(-(SessionDeadline - 1) * time.Second)
 			after := time.Now().Add(-(SessionDeadline + 1) * time.Second)
 			return d.Before(before) && d.After(after)
-		})).Return(nil)
+		})
+	repoMock.On("PurgeOld", deadlineMatcher, true).Return([]entity.Session{testSession}, nil)
 
 	err := sessionDomain.PurgeOld()
 	require.NoError(t, err, "Can't purge old sessions")
+	repoMock.AssertExpectations(t)
+
+	event := <-subscription.Events()
+	assert.Equal(t, SessionPurged, event.Type)
+	assert.Equal(t, testSession.Username, event.Session.Username)
+	assert.Empty(t, subscription.Events())
+}
+
+func TestSessionDomainPurgeOldError(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	subscription := sessionDomain.GetEvents().Subscribe()
+
+	repoMock.On("PurgeOld", mock.Anything, true).Return(nil, errors.New("test error"))
+
+	err := sessionDomain.PurgeOld()
+	assert.Error(t, err)
+	assert.Empty(t, subscription.Events())
 }
 
 func TestSessionDomainList(t *testing.T) {
@@ -158,6 +243,126 @@ func TestSessionDomainList(t *testing.T) {
 	assert.Equal(t, 3, len(sessions))
 }
 
+func TestSessionDomainSearch(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+
+	request := ListSessionsRequest{
+		CoreName:    "bsnes",
+		HostMethod:  "3",
+		HasPassword: "0",
+		Connectable: "true",
+		Sort:        "-player_count,username",
+		Limit:       10,
+		Offset:      20,
+	}
+
+	repoMock.On("Find", mock.Anything, mock.MatchedBy(
+		func(f *entity.SessionFilter) bool {
+			return f.CoreName == "bsnes" &&
+				*f.HostMethod == entity.HostMethodMITM &&
+				*f.HasPassword == false &&
+				*f.Connectable == true &&
+				f.Limit == 10 &&
+				f.Offset == 20 &&
+				len(f.Sort) == 2 &&
+				f.Sort[0] == entity.SessionSort{Field: entity.SortByPlayerCount, Descending: true} &&
+				f.Sort[1] == entity.SessionSort{Field: entity.SortByUsername, Descending: false}
+		})).Return(make([]entity.Session, 3), 42, nil)
+
+	sessions, count, err := sessionDomain.Search(&request)
+	require.NoError(t, err, "Can't search sessions")
+	assert.Equal(t, 3, len(sessions))
+	assert.Equal(t, 42, count)
+}
+
+func TestSessionDomainSearchOffsetWithoutLimit(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+
+	repoMock.On("Find", mock.Anything, mock.MatchedBy(
+		func(f *entity.SessionFilter) bool {
+			return f.Limit == MaxListLimit && f.Offset == 5
+		})).Return(make([]entity.Session, 0), 3, nil)
+
+	_, count, err := sessionDomain.Search(&ListSessionsRequest{Offset: 5})
+	require.NoError(t, err, "Can't search sessions")
+	assert.Equal(t, 3, count)
+}
+
+func TestSessionDomainSearchInvalidFilter(t *testing.T) {
+	sessionDomain, _ := setupSessionDomain(t)
+
+	invalidRequests := []ListSessionsRequest{
+		{HostMethod: "7"},
+		{HasPassword: "maybe"},
+		{Connectable: "yes"},
+		{Sort: "ip"},
+		{Limit: MaxListLimit + 1},
+		{Offset: -1},
+	}
+
+	for _, request := range invalidRequests {
+		_, _, err := sessionDomain.Search(&request)
+		assert.True(t, errors.Is(err, ErrInvalidFilter), "Request should be invalid: %v", request)
+	}
+}
+
+func TestSessionDomainListPrivacy(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	sessionDomain.privacyDomain.mode = PrivacyAll
+
+	session := testSession
+	session.UpdatedAt = time.Now()
+	session.CalculateID()
+	repoMock.On("GetAll", mock.Anything).Return([]entity.Session{session}, nil)
+	repoMock.On("GetByRoomID", session.RoomID).Return(&session, nil)
+
+	sessions, err := sessionDomain.List()
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Nil(t, sessions[0].IP)
+	assert.NotEmpty(t, sessions[0].JoinTicket)
+
+	// The ticket resolves to the hidden host IP
+	joined, err := sessionDomain.Join(sessions[0].JoinTicket, testIP)
+	require.NoError(t, err)
+	assert.True(t, joined.IP.Equal(session.IP))
+	assert.Equal(t, session.Port, joined.Port)
+}
+
+func TestSessionDomainJoinInvalid(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+
+	session := testSession
+	session.CalculateID()
+	ticket := sessionDomain.privacyDomain.issueTicket(&session, time.Now())
+
+	// The session expired
+	expired := session
+	expired.UpdatedAt = time.Now().Add(-2 * sessionDomain.config.SessionDeadline)
+	repoMock.On("GetByRoomID", session.RoomID).Return(&expired, nil).Once()
+	_, err := sessionDomain.Join(ticket, testIP)
+	assert.True(t, errors.Is(err, ErrInvalidTicket))
+
+	// The session is gone
+	repoMock.On("GetByRoomID", session.RoomID).Return(nil, nil).Once()
+	_, err = sessionDomain.Join(ticket, testIP)
+	assert.True(t, errors.Is(err, ErrInvalidTicket))
+
+	_, err = sessionDomain.Join("garbage", testIP)
+	assert.True(t, errors.Is(err, ErrInvalidTicket))
+}
+
+func TestSessionDomainJoinRateLimit(t *testing.T) {
+	sessionDomain, _ := setupSessionDomain(t)
+	sessionDomain.privacyDomain.limiter = NewRateLimiter(time.Minute, 1)
+
+	_, err := sessionDomain.Join("garbage", testIP)
+	assert.True(t, errors.Is(err, ErrInvalidTicket))
+
+	_, err = sessionDomain.Join("garbage", testIP)
+	assert.True(t, errors.Is(err, ErrRateLimited))
+}
+
 func TestSessionDomainValidateSessionAtCreate(t *testing.T) {
 	sessionDomain, repoMock := setupSessionDomain(t)
 
@@ -212,6 +417,7 @@ func TestSessionDomainAddSessionTypeCreate(t *testing.T) {
 		func(s string) bool {
 			return s == comp.ID
 		})).Return(nil, nil)
+	repoMock.On("CountByIP", mock.Anything, mock.Anything).Return(0, nil)
 
 	repoMock.On("Create", mock.MatchedBy(
 		func(s *entity.Session) bool {
@@ -223,6 +429,51 @@ func TestSessionDomainAddSessionTypeCreate(t *testing.T) {
 	require.NotNil(t, newSession)
 	assert.Equal(t, comp.ID, newSession.ID)
 	assert.Equal(t, comp.ContentHash, newSession.ContentHash)
+	assert.True(t, newSession.Connectable)
+	assert.False(t, sessionDomain.probeDomain.Enqueue(*newSession), "Created session wasn't queued for a probe")
+}
+
+func TestSessionDomainWithoutOptions(t *testing.T) {
+	repoMock := &SessionRepositoryMock{}
+	validationDomain, err := NewValidationDomain(testStringBlacklist, testIPBlacklist)
+	require.NoError(t, err)
+	sessionDomain := NewSessionDomain(repoMock, setupGeoip2Domain(t), validationDomain, NewMetricsDomain(), DefaultLobbyConfig(), SessionDomainOptions{})
+
+	comp := testSession
+	comp.CalculateID()
+	repoMock.On("GetByID", comp.ID).Return(nil, nil)
+	repoMock.On("CountByIP", mock.Anything, mock.Anything).Return(0, nil)
+	repoMock.On("Create", mock.Anything).Return(nil)
+	repoMock.On("PurgeOld", mock.Anything, false).Return([]entity.Session{comp}, nil)
+
+	request := testRequest
+	_, err = sessionDomain.Add(&request, testIP)
+	require.NoError(t, err)
+	require.NoError(t, sessionDomain.PurgeOld())
+	require.NotNil(t, sessionDomain.GetEvents())
+
+	_, err = sessionDomain.Join("ticket", testIP)
+	assert.True(t, errors.Is(err, ErrInvalidTicket))
+}
+
+func TestSessionDomainAddSessionPublishesEvent(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	subscription := sessionDomain.GetEvents().Subscribe()
+
+	request := testRequest
+	comp := testSession
+	comp.CalculateID()
+	comp.CalculateContentHash()
+
+	repoMock.On("GetByID", comp.ID).Return(&comp, nil)
+	repoMock.On("Touch", comp.ID).Return(nil)
+
+	_, err := sessionDomain.Add(&request, testIP)
+	require.NoError(t, err)
+
+	event := <-subscription.Events()
+	assert.Equal(t, SessionTouched, event.Type)
+	assert.Equal(t, comp.ID, event.Session.ID)
 }
 
 func TestSessionDomainAddSessionTypeCreateShouldSetDefaultUsername(t *testing.T) {
@@ -240,6 +491,7 @@ func TestSessionDomainAddSessionTypeCreateShouldSetDefaultUsername(t *testing.T)
 		func(s string) bool {
 			return s == comp.ID
 		})).Return(nil, nil)
+	repoMock.On("CountByIP", mock.Anything, mock.Anything).Return(0, nil)
 
 	repoMock.On("Create", mock.MatchedBy(
 		func(s *entity.Session) bool {
@@ -332,6 +584,32 @@ func TestSessionDomainAddSessionTypeUpdateRateLimit(t *testing.T) {
 	assert.Nil(t, newSession)
 }
 
+func TestSessionDomainConfiguredDeadlineAndRateLimit(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	sessionDomain.config.SessionDeadline = time.Hour
+	sessionDomain.config.RateLimit = 30 * time.Second
+
+	repoMock.On("GetAll", mock.MatchedBy(
+		func(d time.Time) bool {
+			return d.Before(time.Now().Add(-59*time.Minute)) && d.After(time.Now().Add(-61*time.Minute))
+		})).Return(make([]entity.Session, 1), nil)
+
+	sessions, err := sessionDomain.List()
+	require.NoError(t, err, "Can't list sessions")
+	assert.Equal(t, 1, len(sessions))
+
+	request := testRequest
+	comp := testSession
+	comp.UpdatedAt = time.Now().Add(-20 * time.Second)
+	comp.CalculateID()
+	comp.CalculateContentHash()
+
+	repoMock.On("GetByID", comp.ID).Return(&comp, nil)
+
+	_, err = sessionDomain.Add(&request, testIP)
+	assert.True(t, errors.Is(err, ErrRateLimited))
+}
+
 func TestSessionDomainAddSessionTypeTouchRateLimit(t *testing.T) {
 	sessionDomain, repoMock := setupSessionDomain(t)
 
@@ -356,3 +634,481 @@ func TestSessionDomainAddSessionTypeTouchRateLimit(t *testing.T) {
 	assert.True(t, errors.Is(err, ErrRateLimited))
 	assert.Nil(t, newSession)
 }
+
+func TestSessionDomainAddSessionRoomQuota(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	sessionDomain.config.MaxRoomsPerIP = 2
+
+	request := testRequest
+	comp := testSession
+	comp.CalculateID()
+
+	repoMock.On("GetByID", comp.ID).Return(nil, nil)
+	repoMock.On("CountByIP", mock.MatchedBy(
+		func(ip net.IP) bool {
+			return ip.Equal(testIP)
+		}), mock.Anything).Return(2, nil)
+
+	newSession, err := sessionDomain.Add(&request, testIP)
+	require.Error(t, err)
+	assert.Nil(t, newSession)
+	assert.True(t, errors.Is(err, ErrRateLimited))
+
+	var rateLimitErr *RateLimitError
+	require.True(t, errors.As(err, &rateLimitErr))
+	assert.Equal(t, sessionDomain.config.SessionDeadline, rateLimitErr.RetryAfter)
+}
+
+func TestSessionDomainAddSessionCreateRateLimit(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	sessionDomain.createLimiter = NewRateLimiter(time.Minute, 1)
+
+	repoMock.On("GetByID", mock.Anything).Return(nil, nil)
+	repoMock.On("CountByIP", mock.Anything, mock.Anything).Return(0, nil)
+	repoMock.On("Create", mock.Anything).Return(nil)
+
+	request := testRequest
+	_, err := sessionDomain.Add(&request, testIP)
+	require.NoError(t, err)
+
+	// Varying the port creates a new session ID, but shares the bucket of the IP
+	request = testRequest
+	request.Port = 55356
+	newSession, err := sessionDomain.Add(&request, testIP)
+	require.Error(t, err)
+	assert.Nil(t, newSession)
+
+	var rateLimitErr *RateLimitError
+	require.True(t, errors.As(err, &rateLimitErr))
+	assert.True(t, rateLimitErr.RetryAfter > 0 && rateLimitErr.RetryAfter <= time.Minute)
+}
+
+func TestSessionDomainAddSessionBlacklistedIP(t *testing.T) {
+	sessionDomain, _ := setupSessionDomain(t)
+
+	request := testRequest
+
+	newSession, err := sessionDomain.Add(&request, net.ParseIP("127.0.0.1"))
+	require.Error(t, err)
+	assert.Nil(t, newSession)
+	assert.True(t, errors.Is(err, ErrSessionRejected))
+}
+
+func TestSessionDomainAddSessionReturnsRoomToken(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	subscription := sessionDomain.GetEvents().Subscribe()
+
+	repoMock.On("GetByID", mock.Anything).Return(nil, nil)
+	repoMock.On("CountByIP", mock.Anything, mock.Anything).Return(0, nil)
+	repoMock.On("Create", mock.MatchedBy(
+		func(s *entity.Session) bool {
+			return len(s.TokenHash) == 64 && s.Token == ""
+		})).Return(nil)
+
+	request := testRequest
+	newSession, err := sessionDomain.Add(&request, testIP)
+	require.NoError(t, err)
+	require.NotEmpty(t, newSession.Token)
+	assert.True(t, checkRoomToken(newSession.Token, newSession.TokenHash))
+	assert.Contains(t, newSession.PrintForRetroarch(), "room_token="+newSession.Token+"\n")
+
+	event := <-subscription.Events()
+	assert.Empty(t, event.Session.Token, "Room token was published")
+}
+
+func TestSessionDomainAddSessionRoomToken(t *testing.T) {
+	token, hash, err := newRoomToken()
+	require.NoError(t, err)
+
+	comp := testSession
+	comp.TokenHash = hash
+	comp.CalculateID()
+	comp.CalculateContentHash()
+
+	t.Run("first use is stored", func(t *testing.T) {
+		sessionDomain, repoMock := setupSessionDomain(t)
+		repoMock.On("GetByID", comp.ID).Return(&comp, nil)
+		repoMock.On("Update", mock.MatchedBy(
+			func(s *entity.Session) bool {
+				return s.TokenRequired && s.TokenHash == hash
+			})).Return(nil)
+
+		request := testRequest
+		request.RoomToken = token
+		_, err := sessionDomain.Add(&request, testIP)
+		require.NoError(t, err)
+		repoMock.AssertExpectations(t)
+	})
+
+	t.Run("wrong token", func(t *testing.T) {
+		sessionDomain, repoMock := setupSessionDomain(t)
+		repoMock.On("GetByID", comp.ID).Return(&comp, nil)
+
+		request := testRequest
+		request.RoomToken = "wrong"
+		_, err := sessionDomain.Add(&request, testIP)
+		assert.True(t, errors.Is(err, ErrInvalidRoomToken))
+	})
+
+	t.Run("required token is missing", func(t *testing.T) {
+		sessionDomain, repoMock := setupSessionDomain(t)
+		required := comp
+		required.TokenRequired = true
+		repoMock.On("GetByID", comp.ID).Return(&required, nil)
+
+		request := testRequest
+		_, err := sessionDomain.Add(&request, testIP)
+		assert.True(t, errors.Is(err, ErrInvalidRoomToken))
+	})
+
+	t.Run("legacy clients don't send it", func(t *testing.T) {
+		sessionDomain, repoMock := setupSessionDomain(t)
+		repoMock.On("GetByID", comp.ID).Return(&comp, nil)
+		repoMock.On("Touch", comp.ID).Return(nil)
+
+		request := testRequest
+		_, err := sessionDomain.Add(&request, testIP)
+		require.NoError(t, err)
+	})
+}
+
+func TestSessionDomainRemove(t *testing.T) {
+	sessionDomain, repoMock, historyMock := setupSessionDomainWithHistory(t)
+	subscription := sessionDomain.GetEvents().Subscribe()
+
+	token, hash, err := newRoomToken()
+	require.NoError(t, err)
+
+	session := testSession
+	session.TokenHash = hash
+	repoMock.On("GetByRoomID", session.RoomID).Return(&session, nil)
+	repoMock.On("DeleteByRoomID", session.RoomID).Return(nil)
+	historyMock.On("Archive", mock.MatchedBy(
+		func(h []entity.SessionHistory) bool {
+			return len(h) == 1 && time.Since(h[0].EndedAt) < time.Minute
+		})).Return(nil)
+
+	err = sessionDomain.Remove(&RemoveSessionRequest{session.RoomID, "wrong"})
+	assert.True(t, errors.Is(err, ErrInvalidRoomToken))
+	repoMock.AssertNotCalled(t, "DeleteByRoomID", session.RoomID)
+
+	err = sessionDomain.Remove(&RemoveSessionRequest{session.RoomID, token})
+	require.NoError(t, err)
+	repoMock.AssertExpectations(t)
+	historyMock.AssertExpectations(t)
+
+	event := <-subscription.Events()
+	assert.Equal(t, SessionRemoved, event.Type)
+}
+
+func TestSessionDomainRemoveNotFound(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	repoMock.On("GetByRoomID", int32(42)).Return(nil, nil)
+
+	err := sessionDomain.Remove(&RemoveSessionRequest{42, "token"})
+	assert.True(t, errors.Is(err, ErrSessionNotFound))
+}
+
+func TestSessionDomainRemoveLegacySession(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+
+	// Sessions without a token can't be removed
+	session := testSession
+	repoMock.On("GetByRoomID", session.RoomID).Return(&session, nil)
+
+	err := sessionDomain.Remove(&RemoveSessionRequest{session.RoomID, "token"})
+	assert.True(t, errors.Is(err, ErrInvalidRoomToken))
+}
+
+func TestSessionDomainAddSessionAutoRelay(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	sessionDomain.mitmDomain = NewMitmDomain(
+		[]RelayConfig{
+			{Handle: "nyc", Host: "nyc.example.com", Port: 55435, Region: "na"},
+			{Handle: "frankfurt", Host: "frankfurt.example.com", Port: 55435, Region: "eu"},
+		},
+		repoMock,
+		sessionDomain.geopip2Domain,
+		sessionDomain.config,
+		&testLogger{})
+
+	repoMock.On("GetByID", mock.Anything).Return(nil, nil)
+	repoMock.On("CountByIP", mock.Anything, mock.Anything).Return(0, nil)
+	repoMock.On("Create", mock.Anything).Return(nil)
+
+	request := testRequest
+	request.ForceMITM = true
+	request.MITMServer = MitmAuto
+	request.MITMSession = "abcdef"
+
+	newSession, err := sessionDomain.Add(&request, net.ParseIP("46.243.122.48"))
+	require.NoError(t, err)
+	assert.Equal(t, entity.HostMethod(entity.HostMethodMITM), newSession.HostMethod)
+	assert.Equal(t, "frankfurt", newSession.MitmHandle)
+	assert.Equal(t, "frankfurt.example.com", newSession.MitmAddress)
+}
+
+func TestSessionDomainUpdateSessionAutoRelay(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	sessionDomain.mitmDomain = NewMitmDomain(
+		[]RelayConfig{
+			{Handle: "nyc", Host: "nyc.example.com", Port: 55435, Region: "na"},
+			{Handle: "frankfurt", Host: "frankfurt.example.com", Port: 55435, Region: "eu"},
+		},
+		repoMock,
+		sessionDomain.geopip2Domain,
+		sessionDomain.config,
+		&testLogger{})
+
+	request := testRequest
+	request.ForceMITM = true
+	request.MITMServer = MitmAuto
+	request.MITMSession = "abcdef"
+	ip := net.ParseIP("46.243.122.48")
+
+	// The room was put on nyc while frankfurt was down
+	saved := *sessionDomain.parseSession(&request, ip)
+	saved.MitmHandle = "nyc"
+	saved.MitmAddress = "nyc.example.com"
+	saved.MitmPort = 55435
+	saved.CalculateID()
+	saved.CalculateContentHash()
+	saved.UpdatedAt = time.Now().Add(-10 * time.Second)
+	repoMock.On("GetByID", saved.ID).Return(&saved, nil)
+	repoMock.On("Touch", mock.Anything).Return(nil)
+
+	session, err := sessionDomain.Add(&request, ip)
+	require.NoError(t, err)
+	assert.Equal(t, "nyc", session.MitmHandle, "A running room was moved to the closest relay")
+	repoMock.AssertCalled(t, "Touch", mock.Anything)
+}
+
+func TestSessionDomainAddSessionFullRelay(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	sessionDomain.mitmDomain = NewMitmDomain(
+		[]RelayConfig{
+			{Handle: "madrid", Host: "madrid.example.com", Port: 55435, Region: "eu", MaxSessions: 1},
+			{Handle: "frankfurt", Host: "frankfurt.example.com", Port: 55435, Region: "eu"},
+		},
+		repoMock,
+		sessionDomain.geopip2Domain,
+		sessionDomain.config,
+		&testLogger{})
+
+	repoMock.On("GetByID", mock.Anything).Return(nil, nil)
+	repoMock.On("CountByIP", mock.Anything, mock.Anything).Return(0, nil)
+	repoMock.On("CountByMitmHandle", mock.Anything).Return(map[string]int{"madrid": 1}, nil)
+	repoMock.On("Create", mock.Anything).Return(nil)
+
+	request := testRequest
+	request.ForceMITM = true
+	request.MITMServer = "madrid"
+	request.MITMSession = "abcdef"
+
+	// The room is published on the relay /tunnel handed out to the host
+	tunnel := sessionDomain.mitmDomain.Tunnel(request.MITMServer, testIP)
+	require.NotNil(t, tunnel)
+	newSession, err := sessionDomain.Add(&request, testIP)
+	require.NoError(t, err)
+	assert.Equal(t, tunnel.Handle, newSession.MitmHandle)
+	assert.Equal(t, "frankfurt", newSession.MitmHandle)
+	assert.Equal(t, "frankfurt.example.com", newSession.MitmAddress)
+}
+
+func TestSessionDomainAddSessionRelayDownAfterTunnel(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	sessionDomain.mitmDomain = NewMitmDomain(
+		[]RelayConfig{
+			{Handle: "madrid", Host: "madrid.example.com", Port: 55435, Region: "eu"},
+			{Handle: "frankfurt", Host: "frankfurt.example.com", Port: 55435, Region: "eu"},
+		},
+		repoMock,
+		sessionDomain.geopip2Domain,
+		sessionDomain.config,
+		&testLogger{})
+
+	repoMock.On("GetByID", mock.Anything).Return(nil, nil)
+	repoMock.On("CountByIP", mock.Anything, mock.Anything).Return(0, nil)
+	repoMock.On("Create", mock.Anything).Return(nil)
+
+	request := testRequest
+	request.ForceMITM = true
+	request.MITMServer = "madrid"
+	request.MITMSession = "abcdef"
+
+	tunnel := sessionDomain.mitmDomain.Tunnel(request.MITMServer, testIP)
+	require.NotNil(t, tunnel)
+	assert.Equal(t, "madrid", tunnel.Handle)
+
+	// The host opened its tunnel to madrid before it went down
+	sessionDomain.mitmDomain.relays[1].up = false // madrid
+	newSession, err := sessionDomain.Add(&request, testIP)
+	require.NoError(t, err)
+	assert.Equal(t, "madrid", newSession.MitmHandle, "The room wasn't published on the relay of its tunnel")
+	assert.Equal(t, "madrid.example.com", newSession.MitmAddress)
+}
+
+func TestSessionDomainUpdateSessionFullRelay(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	sessionDomain.mitmDomain = NewMitmDomain(
+		[]RelayConfig{
+			{Handle: "madrid", Host: "madrid.example.com", Port: 55435, Region: "eu", MaxSessions: 1},
+			{Handle: "frankfurt", Host: "frankfurt.example.com", Port: 55435, Region: "eu"},
+		},
+		repoMock,
+		sessionDomain.geopip2Domain,
+		sessionDomain.config,
+		&testLogger{})
+
+	request := testRequest
+	request.ForceMITM = true
+	request.MITMServer = "madrid"
+	request.MITMSession = "abcdef"
+
+	// The room was moved to frankfurt because madrid was full when the host opened its tunnel
+	saved := *sessionDomain.parseSession(&request, testIP)
+	saved.MitmHandle = "frankfurt"
+	saved.MitmAddress = "frankfurt.example.com"
+	saved.MitmPort = 55435
+	saved.CalculateID()
+	saved.CalculateContentHash()
+	saved.UpdatedAt = time.Now().Add(-10 * time.Second)
+	repoMock.On("GetByID", saved.ID).Return(&saved, nil)
+	repoMock.On("CountByMitmHandle", mock.Anything).Return(map[string]int{}, nil)
+	repoMock.On("Touch", mock.Anything).Return(nil)
+
+	// Madrid has room again, but the host is still connected to frankfurt
+	session, err := sessionDomain.Add(&request, testIP)
+	require.NoError(t, err)
+	assert.Equal(t, "frankfurt", session.MitmHandle, "A running room was moved back to the requested relay")
+	assert.Equal(t, "frankfurt.example.com", session.MitmAddress)
+	repoMock.AssertCalled(t, "Touch", mock.Anything)
+	repoMock.AssertNotCalled(t, "CountByMitmHandle", mock.Anything)
+}
+
+func TestSessionDomainUpdateSessionDownRelay(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	sessionDomain.mitmDomain = NewMitmDomain(
+		[]RelayConfig{
+			{Handle: "madrid", Host: "madrid.example.com", Port: 55435, Region: "eu"},
+			{Handle: "frankfurt", Host: "frankfurt.example.com", Port: 55435, Region: "eu"},
+		},
+		repoMock,
+		sessionDomain.geopip2Domain,
+		sessionDomain.config,
+		&testLogger{})
+
+	request := testRequest
+	request.ForceMITM = true
+	request.MITMServer = "madrid"
+	request.MITMSession = "abcdef"
+
+	saved := *sessionDomain.parseSession(&request, testIP)
+	saved.MitmAddress = "madrid.example.com"
+	saved.MitmPort = 55435
+	saved.CalculateID()
+	saved.CalculateContentHash()
+	saved.UpdatedAt = time.Now().Add(-10 * time.Second)
+	repoMock.On("GetByID", saved.ID).Return(&saved, nil)
+	repoMock.On("Touch", mock.Anything).Return(nil)
+	repoMock.On("Update", mock.Anything).Return(nil)
+
+	// The host is still connected to its relay, so the room is still reachable through it
+	sessionDomain.mitmDomain.relays[1].up = false // madrid
+	session, err := sessionDomain.Add(&request, testIP)
+	require.NoError(t, err)
+	assert.Equal(t, "madrid", session.MitmHandle, "A running room was moved off its relay")
+	assert.Equal(t, "madrid.example.com", session.MitmAddress)
+	repoMock.AssertCalled(t, "Touch", mock.Anything)
+
+	// A new tunnel fails over
+	request.MITMSession = "123456"
+	session, err = sessionDomain.Add(&request, testIP)
+	require.NoError(t, err)
+	assert.Equal(t, "frankfurt", session.MitmHandle)
+	assert.Equal(t, "frankfurt.example.com", session.MitmAddress)
+	repoMock.AssertCalled(t, "Update", mock.Anything)
+}
+
+func TestSessionDomainAddSessionCustomRelay(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	sessionDomain.customRelay.resolver = staticResolver{"relay.example.com": {"1.1.1.1"}}
+
+	repoMock.On("GetByID", mock.Anything).Return(nil, nil)
+	repoMock.On("CountByIP", mock.Anything, mock.Anything).Return(0, nil)
+	repoMock.On("Create", mock.Anything).Return(nil)
+
+	request := testRequest
+	request.ForceMITM = true
+	request.MITMServer = MitmCustom
+	request.MITMCustomServer = "relay.example.com"
+	request.MITMCustomPort = 55435
+	request.MITMSession = "abcdef"
+
+	newSession, err := sessionDomain.Add(&request, testIP)
+	require.NoError(t, err)
+	assert.Equal(t, entity.HostMethod(entity.HostMethodMITM), newSession.HostMethod)
+	assert.Equal(t, "1.1.1.1", newSession.MitmAddress, "The relay wasn't published with the validated address")
+
+	request.MITMCustomServer = "192.168.178.1"
+	_, err = sessionDomain.Add(&request, testIP)
+	assert.True(t, errors.Is(err, ErrInvalidCustomRelay), "Private custom relay wasn't rejected")
+}
+
+func TestSessionDomainAddSessionIdentifiesGame(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	sessionDomain.gameDatabase = setupGameDatabaseDomain(t)
+
+	repoMock.On("GetByID", mock.Anything).Return(nil, nil)
+	repoMock.On("CountByIP", mock.Anything, mock.Anything).Return(0, nil)
+	repoMock.On("Create", mock.Anything).Return(nil)
+
+	request := testRequest
+	request.GameCRC = "3337ec46"
+	request.CoreName = "Nestopia"
+
+	newSession, err := sessionDomain.Add(&request, testIP)
+	require.NoError(t, err)
+	assert.Equal(t, "Super Mario Bros. (World)", newSession.GameTitle)
+	assert.Equal(t, "Nintendo - Nintendo Entertainment System", newSession.GameSystem)
+	assert.Equal(t, "World", newSession.GameRegion)
+	assert.Equal(t, GameVerified, newSession.GameStatus)
+}
+
+func TestSessionDomainAddSessionCoreInfo(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	sessionDomain.coreInfo = setupCoreInfoDomain(t)
+
+	repoMock.On("GetByID", mock.Anything).Return(nil, nil)
+	repoMock.On("CountByIP", mock.Anything, mock.Anything).Return(0, nil)
+	repoMock.On("Create", mock.Anything).Return(nil)
+
+	request := testRequest
+	request.CoreName = "DOSBox-SVN"
+
+	// Rooms of cores without netplay support are only flagged by default
+	newSession, err := sessionDomain.Add(&request, testIP)
+	require.NoError(t, err)
+	require.NotNil(t, newSession.Core)
+	assert.False(t, newSession.Core.Netplay)
+
+	sessionDomain.config.RejectNonNetplay = true
+	request.Port = 55356
+	_, err = sessionDomain.Add(&request, testIP)
+	assert.True(t, errors.Is(err, ErrCoreNotNetplay))
+}
+
+func TestSessionDomainListCoreInfo(t *testing.T) {
+	sessionDomain, repoMock := setupSessionDomain(t)
+	sessionDomain.coreInfo = setupCoreInfoDomain(t)
+
+	session := testSession
+	session.CoreName = "Nestopia"
+	repoMock.On("GetAll", mock.Anything).Return([]entity.Session{session, testSession}, nil)
+
+	sessions, err := sessionDomain.List()
+	require.NoError(t, err)
+	require.NotNil(t, sessions[0].Core)
+	assert.Equal(t, "Nintendo - NES / Famicom (Nestopia UE)", sessions[0].Core.DisplayName)
+	assert.Nil(t, sessions[1].Core)
+}
@@ -0,0 +1,406 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// DefaultStatsLimit is the default length of the top lists in the statistics.
+const DefaultStatsLimit = 10
+
+// MaxStatsLimit is the maximal length of the top lists in the statistics.
+const MaxStatsLimit = 100
+
+// MaxStatsDays and MaxStatsWeeks are the maximal amount of buckets a statistic can cover.
+const (
+	MaxStatsDays  = 366
+	MaxStatsWeeks = 53
+)
+
+// StatsCacheTTL is how long the statistics of a day or week are cached. Rooms are archived when they end, so
+// the statistics of past buckets still change while their rooms are running.
+const StatsCacheTTL = 10 * time.Minute
+
+// maxStatsCacheSize is the amount of cached buckets above which the expired ones are dropped.
+const maxStatsCacheSize = 2 * (MaxStatsDays + MaxStatsWeeks)
+
+// ErrInvalidStatsRequest is thrown when a statistics request has an invalid period or range.
+var ErrInvalidStatsRequest = errors.New("Invalid statistics request")
+
+// StatsPeriod enum
+type StatsPeriod string
+
+// StatsPeriod enum values
+const (
+	StatsDaily  StatsPeriod = "daily"
+	StatsWeekly StatsPeriod = "weekly"
+)
+
+// HistoryRepository interface to decouple the domain logic from the repository code.
+type HistoryRepository interface {
+	Archive(history []entity.SessionHistory) error
+	GetBetween(from time.Time, to time.Time) ([]entity.SessionHistory, error)
+}
+
+// StatsRequest defines the request for the StatsDomain.Get() request.
+type StatsRequest struct {
+	From  string `query:"from"` // First day as YYYY-MM-DD
+	To    string `query:"to"`   // Last day as YYYY-MM-DD
+	Limit int    `query:"limit"`
+}
+
+// StatsBucket holds the statistics of a single day or week. Sessions count for the bucket they started in.
+type StatsBucket struct {
+	Start     time.Time    `json:"start"`
+	End       time.Time    `json:"end"`
+	Rooms     int          `json:"rooms"`
+	PeakRooms int          `json:"peak_rooms"` // Maximal amount of concurrent rooms within the bucket
+	Games     []StatsEntry `json:"games"`
+	Cores     []StatsEntry `json:"cores"`
+	Countries []StatsEntry `json:"countries"`
+}
+
+// StatsEntry holds the statistics of a single game, core or country.
+type StatsEntry struct {
+	Name        string `json:"name"`
+	GameCRC     string `json:"game_crc,omitempty"`
+	Rooms       int    `json:"rooms"`
+	PlayTime    int64  `json:"play_time"` // Seconds the rooms were hosted
+	PeakPlayers int16  `json:"peak_players"`
+}
+
+// statsCacheKey identifies a cached bucket by its period and its start as unix time.
+type statsCacheKey struct {
+	period StatsPeriod
+	start  int64
+}
+
+// statsCacheEntry is a cached bucket with top lists of MaxStatsLimit entries.
+type statsCacheEntry struct {
+	bucket  StatsBucket
+	expires time.Time
+}
+
+// StatsDomain archives expired sessions and aggregates the play statistics of the archive. The aggregated
+// buckets are cached, so every bucket is only loaded once per StatsCacheTTL no matter the requested ranges.
+type StatsDomain struct {
+	historyRepo HistoryRepository
+	mutex       sync.Mutex
+	cache       map[statsCacheKey]statsCacheEntry
+}
+
+// NewStatsDomain returns an initalized StatsDomain struct.
+func NewStatsDomain(historyRepo HistoryRepository) *StatsDomain {
+	return &StatsDomain{historyRepo: historyRepo, cache: make(map[statsCacheKey]statsCacheEntry)}
+}
+
+// Archive stores the history of the given sessions.
+func (d *StatsDomain) Archive(sessions []entity.Session) error {
+	if d == nil || len(sessions) == 0 {
+		return nil
+	}
+
+	history := make([]entity.SessionHistory, len(sessions))
+	for i := range sessions {
+		history[i] = entity.NewSessionHistory(&sessions[i])
+	}
+
+	return d.historyRepo.Archive(history)
+}
+
+// Get returns the statistics for every day or week of the requested range. Without a range the last
+// 30 days or 12 weeks are returned.
+// Returns ErrInvalidStatsRequest if the period or range is invalid.
+func (d *StatsDomain) Get(period StatsPeriod, request *StatsRequest) ([]StatsBucket, error) {
+	from, to, err := parseStatsRange(period, request, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	limit := request.Limit
+	if limit == 0 {
+		limit = DefaultStatsLimit
+	} else if limit < 0 || limit > MaxStatsLimit {
+		return nil, fmt.Errorf("%w: invalid limit %d", ErrInvalidStatsRequest, limit)
+	}
+
+	now := time.Now()
+	buckets := d.cached(period, from, to, now)
+
+	// Load the history of the uncached buckets at once
+	first, last := -1, -1
+	for i := range buckets {
+		if buckets[i].End.IsZero() {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first >= 0 {
+		start, end := buckets[first].Start, nextBucket(period, buckets[last].Start)
+		history, err := d.historyRepo.GetBetween(start, end)
+		if err != nil {
+			return nil, err
+		}
+
+		aggregated := aggregateBuckets(history, period, start, end)
+		copy(buckets[first:], aggregated)
+		d.store(period, aggregated, now)
+	}
+
+	for i := range buckets {
+		buckets[i].Games = truncateEntries(buckets[i].Games, limit)
+		buckets[i].Cores = truncateEntries(buckets[i].Cores, limit)
+		buckets[i].Countries = truncateEntries(buckets[i].Countries, limit)
+	}
+
+	return buckets, nil
+}
+
+// cached returns the buckets between from and to. Buckets that aren't cached only have their start set.
+func (d *StatsDomain) cached(period StatsPeriod, from time.Time, to time.Time, now time.Time) []StatsBucket {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	buckets := make([]StatsBucket, 0)
+	for start := from; start.Before(to); start = nextBucket(period, start) {
+		entry, found := d.cache[statsCacheKey{period, start.Unix()}]
+		if found && now.Before(entry.expires) {
+			buckets = append(buckets, entry.bucket)
+		} else {
+			buckets = append(buckets, StatsBucket{Start: start})
+		}
+	}
+
+	return buckets
+}
+
+// store caches the buckets and drops the expired ones once the cache is full.
+func (d *StatsDomain) store(period StatsPeriod, buckets []StatsBucket, now time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if len(d.cache)+len(buckets) > maxStatsCacheSize {
+		for key, entry := range d.cache {
+			if !now.Before(entry.expires) {
+				delete(d.cache, key)
+			}
+		}
+	}
+	if len(d.cache)+len(buckets) > maxStatsCacheSize {
+		d.cache = make(map[statsCacheKey]statsCacheEntry)
+	}
+
+	for _, bucket := range buckets {
+		d.cache[statsCacheKey{period, bucket.Start.Unix()}] = statsCacheEntry{bucket, now.Add(StatsCacheTTL)}
+	}
+}
+
+// parseStatsRange returns the start of the first and the end of the last bucket in UTC.
+func parseStatsRange(period StatsPeriod, request *StatsRequest, now time.Time) (time.Time, time.Time, error) {
+	if period != StatsDaily && period != StatsWeekly {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: unknown period '%s'", ErrInvalidStatsRequest, period)
+	}
+
+	to := now.UTC().Truncate(24 * time.Hour)
+	if request.To != "" {
+		t, err := time.Parse("2006-01-02", request.To)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: invalid end date '%s'", ErrInvalidStatsRequest, request.To)
+		}
+		to = t
+	}
+
+	from := to.AddDate(0, 0, -29)
+	if period == StatsWeekly {
+		from = to.AddDate(0, 0, -7*11)
+	}
+	if request.From != "" {
+		t, err := time.Parse("2006-01-02", request.From)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: invalid start date '%s'", ErrInvalidStatsRequest, request.From)
+		}
+		from = t
+	}
+
+	// Weeks start on monday
+	if period == StatsWeekly {
+		from = from.AddDate(0, 0, -(int(from.Weekday())+6)%7)
+		to = to.AddDate(0, 0, -(int(to.Weekday())+6)%7)
+	}
+	to = nextBucket(period, to)
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: start date is after the end date", ErrInvalidStatsRequest)
+	}
+	maxBuckets := MaxStatsDays
+	if period == StatsWeekly {
+		maxBuckets = MaxStatsWeeks
+	}
+	if to.Sub(from) > time.Duration(maxBuckets)*24*time.Hour*bucketDays(period) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: range exceeds %d buckets", ErrInvalidStatsRequest, maxBuckets)
+	}
+
+	return from, to, nil
+}
+
+func bucketDays(period StatsPeriod) time.Duration {
+	if period == StatsWeekly {
+		return 7
+	}
+	return 1
+}
+
+func nextBucket(period StatsPeriod, start time.Time) time.Time {
+	return start.AddDate(0, 0, int(bucketDays(period)))
+}
+
+// aggregateBuckets calculates the statistics of every bucket between from and to in a single pass over the
+// history. The top lists have up to MaxStatsLimit entries.
+func aggregateBuckets(history []entity.SessionHistory, period StatsPeriod, from time.Time, to time.Time) []StatsBucket {
+	type change struct {
+		at    time.Time
+		delta int
+	}
+	type counts struct {
+		games     map[string]*StatsEntry
+		cores     map[string]*StatsEntry
+		countries map[string]*StatsEntry
+		changes   []change
+	}
+
+	var buckets []StatsBucket
+	var bucketCounts []counts
+	for start := from; start.Before(to); start = nextBucket(period, start) {
+		buckets = append(buckets, StatsBucket{Start: start, End: nextBucket(period, start)})
+		bucketCounts = append(bucketCounts, counts{
+			games:     make(map[string]*StatsEntry),
+			cores:     make(map[string]*StatsEntry),
+			countries: make(map[string]*StatsEntry),
+		})
+	}
+
+	// Buckets are whole days or weeks in UTC
+	bucketLength := 24 * time.Hour * bucketDays(period)
+	index := func(t time.Time) int {
+		i := int(t.Sub(from) / bucketLength)
+		if i >= len(buckets) {
+			i = len(buckets) - 1
+		}
+		return i
+	}
+
+	for i := range history {
+		h := &history[i]
+		if h.EndedAt.Before(from) || !h.StartedAt.Before(to) {
+			continue
+		}
+
+		// Track the concurrent rooms within every bucket the room spans
+		first, last := 0, index(h.EndedAt)
+		if h.StartedAt.After(from) {
+			first = index(h.StartedAt)
+		}
+		for b := first; b <= last; b++ {
+			start, end := h.StartedAt, h.EndedAt
+			if start.Before(buckets[b].Start) {
+				start = buckets[b].Start
+			}
+			if end.After(buckets[b].End) {
+				end = buckets[b].End
+			}
+			bucketCounts[b].changes = append(bucketCounts[b].changes, change{start, 1}, change{end, -1})
+		}
+
+		// Rooms count for the bucket they started in
+		if h.StartedAt.Before(from) {
+			continue
+		}
+
+		b := index(h.StartedAt)
+		buckets[b].Rooms++
+		countEntry(bucketCounts[b].games, h.GameName+"\x00"+h.GameCRC, h.GameName, h.GameCRC, h)
+		countEntry(bucketCounts[b].cores, h.CoreName, h.CoreName, "", h)
+		countEntry(bucketCounts[b].countries, h.Country, h.Country, "", h)
+	}
+
+	for b := range buckets {
+		changes := bucketCounts[b].changes
+
+		// Rooms that end at the same time another one starts don't overlap
+		sort.Slice(changes, func(i, j int) bool {
+			if changes[i].at.Equal(changes[j].at) {
+				return changes[i].delta < changes[j].delta
+			}
+			return changes[i].at.Before(changes[j].at)
+		})
+		concurrent := 0
+		for _, c := range changes {
+			concurrent += c.delta
+			if concurrent > buckets[b].PeakRooms {
+				buckets[b].PeakRooms = concurrent
+			}
+		}
+
+		buckets[b].Games = topEntries(bucketCounts[b].games, MaxStatsLimit)
+		buckets[b].Cores = topEntries(bucketCounts[b].cores, MaxStatsLimit)
+		buckets[b].Countries = topEntries(bucketCounts[b].countries, MaxStatsLimit)
+	}
+
+	return buckets
+}
+
+func countEntry(entries map[string]*StatsEntry, key string, name string, gameCRC string, h *entity.SessionHistory) {
+	entry, found := entries[key]
+	if !found {
+		entry = &StatsEntry{Name: name, GameCRC: gameCRC}
+		entries[key] = entry
+	}
+
+	entry.Rooms++
+	entry.PlayTime += int64(h.Duration().Seconds())
+	if h.PeakPlayers > entry.PeakPlayers {
+		entry.PeakPlayers = h.PeakPlayers
+	}
+}
+
+// topEntries returns the entries with the most rooms, ties are ordered by play time and name.
+func topEntries(entries map[string]*StatsEntry, limit int) []StatsEntry {
+	top := make([]StatsEntry, 0, len(entries))
+	for _, entry := range entries {
+		top = append(top, *entry)
+	}
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Rooms != top[j].Rooms {
+			return top[i].Rooms > top[j].Rooms
+		}
+		if top[i].PlayTime != top[j].PlayTime {
+			return top[i].PlayTime > top[j].PlayTime
+		}
+		if top[i].Name != top[j].Name {
+			return top[i].Name < top[j].Name
+		}
+		return top[i].GameCRC < top[j].GameCRC
+	})
+
+	if len(top) > limit {
+		top = top[:limit]
+	}
+
+	return top
+}
+
+// truncateEntries returns the first limit entries without sharing the cached array.
+func truncateEntries(entries []StatsEntry, limit int) []StatsEntry {
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return append([]StatsEntry{}, entries...)
+}
@@ -0,0 +1,210 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+var statsDay = time.Date(2021, 3, 3, 0, 0, 0, 0, time.UTC) // Wednesday
+
+func testHistory(game string, core string, country string, start time.Time, duration time.Duration, peak int16) entity.SessionHistory {
+	return entity.SessionHistory{
+		GameName:    game,
+		GameCRC:     "FFFFFFFF",
+		CoreName:    core,
+		Country:     country,
+		PeakPlayers: peak,
+		StartedAt:   start,
+		EndedAt:     start.Add(duration),
+	}
+}
+
+func TestStatsDomainArchive(t *testing.T) {
+	historyMock := HistoryRepositoryMock{}
+	statsDomain := NewStatsDomain(&historyMock)
+
+	// Nothing to archive
+	err := statsDomain.Archive(nil)
+	require.NoError(t, err)
+	historyMock.AssertNotCalled(t, "Archive", mock.Anything)
+
+	session := testSession
+	session.PeakPlayerCount = 4
+	historyMock.On("Archive", mock.MatchedBy(
+		func(h []entity.SessionHistory) bool {
+			return len(h) == 1 &&
+				h[0].PeakPlayers == 4 &&
+				h[0].StartedAt.Equal(session.CreatedAt) &&
+				h[0].EndedAt.Equal(session.UpdatedAt)
+		})).Return(nil)
+
+	err = statsDomain.Archive([]entity.Session{session})
+	require.NoError(t, err)
+	historyMock.AssertExpectations(t)
+}
+
+func TestStatsDomainGetDaily(t *testing.T) {
+	historyMock := HistoryRepositoryMock{}
+	statsDomain := NewStatsDomain(&historyMock)
+
+	history := []entity.SessionHistory{
+		testHistory("supergame", "bsnes", "de", statsDay.Add(10*time.Hour), time.Hour, 2),
+		testHistory("supergame", "bsnes", "en", statsDay.Add(10*time.Hour+30*time.Minute), time.Hour, 4),
+		testHistory("megagame", "genesis", "de", statsDay.Add(11*time.Hour+30*time.Minute), time.Hour, 2),
+		// Spans midnight and counts for the first day only
+		testHistory("megagame", "genesis", "de", statsDay.Add(23*time.Hour), 2*time.Hour, 2),
+	}
+	historyMock.On("GetBetween", statsDay, statsDay.AddDate(0, 0, 2)).Return(history, nil)
+
+	buckets, err := statsDomain.Get(StatsDaily, &StatsRequest{From: "2021-03-03", To: "2021-03-04"})
+	require.NoError(t, err)
+	require.Len(t, buckets, 2)
+
+	first := buckets[0]
+	assert.Equal(t, statsDay, first.Start)
+	assert.Equal(t, statsDay.AddDate(0, 0, 1), first.End)
+	assert.Equal(t, 4, first.Rooms)
+	assert.Equal(t, 2, first.PeakRooms, "Rooms ending when another one starts don't overlap")
+
+	require.Len(t, first.Games, 2)
+	assert.Equal(t, "megagame", first.Games[0].Name, "Ties are ordered by play time")
+	assert.Equal(t, 2, first.Games[0].Rooms)
+	assert.Equal(t, int64(3*60*60), first.Games[0].PlayTime)
+	assert.Equal(t, "supergame", first.Games[1].Name)
+	assert.Equal(t, int16(4), first.Games[1].PeakPlayers)
+	assert.Equal(t, "FFFFFFFF", first.Games[1].GameCRC)
+
+	require.Len(t, first.Countries, 2)
+	assert.Equal(t, "de", first.Countries[0].Name)
+	assert.Equal(t, 3, first.Countries[0].Rooms)
+	assert.Equal(t, "", first.Cores[0].GameCRC)
+
+	second := buckets[1]
+	assert.Equal(t, 0, second.Rooms)
+	assert.Equal(t, 1, second.PeakRooms)
+	assert.Empty(t, second.Games)
+}
+
+func TestStatsDomainGetLimit(t *testing.T) {
+	historyMock := HistoryRepositoryMock{}
+	statsDomain := NewStatsDomain(&historyMock)
+
+	history := []entity.SessionHistory{
+		testHistory("a", "bsnes", "de", statsDay, time.Hour, 1),
+		testHistory("b", "bsnes", "de", statsDay, time.Hour, 1),
+		testHistory("c", "bsnes", "de", statsDay, time.Hour, 1),
+	}
+	historyMock.On("GetBetween", mock.Anything, mock.Anything).Return(history, nil)
+
+	buckets, err := statsDomain.Get(StatsDaily, &StatsRequest{From: "2021-03-03", To: "2021-03-03", Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, buckets, 1)
+	require.Len(t, buckets[0].Games, 2)
+	assert.Equal(t, "a", buckets[0].Games[0].Name)
+	assert.Equal(t, "b", buckets[0].Games[1].Name)
+	assert.Equal(t, 3, buckets[0].PeakRooms)
+}
+
+func TestStatsDomainGetCached(t *testing.T) {
+	historyMock := HistoryRepositoryMock{}
+	statsDomain := NewStatsDomain(&historyMock)
+
+	history := []entity.SessionHistory{
+		testHistory("supergame", "bsnes", "de", statsDay.Add(10*time.Hour), time.Hour, 2),
+		testHistory("megagame", "genesis", "de", statsDay.Add(11*time.Hour), time.Hour, 2),
+	}
+	historyMock.On("GetBetween", statsDay, statsDay.AddDate(0, 0, 1)).Return(history, nil).Once()
+
+	buckets, err := statsDomain.Get(StatsDaily, &StatsRequest{From: "2021-03-03", To: "2021-03-03", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, buckets[0].Games, 1)
+
+	// Cached buckets keep the full top lists
+	buckets, err = statsDomain.Get(StatsDaily, &StatsRequest{From: "2021-03-03", To: "2021-03-03"})
+	require.NoError(t, err)
+	require.Len(t, buckets, 1)
+	assert.Equal(t, 2, buckets[0].Rooms)
+	assert.Len(t, buckets[0].Games, 2)
+
+	// Only the uncached buckets are loaded
+	historyMock.On("GetBetween", statsDay.AddDate(0, 0, 1), statsDay.AddDate(0, 0, 3)).Return([]entity.SessionHistory{}, nil).Once()
+	buckets, err = statsDomain.Get(StatsDaily, &StatsRequest{From: "2021-03-03", To: "2021-03-05"})
+	require.NoError(t, err)
+	require.Len(t, buckets, 3)
+	assert.Equal(t, 2, buckets[0].Rooms)
+	assert.Equal(t, statsDay.AddDate(0, 0, 2), buckets[2].Start)
+	assert.Equal(t, statsDay.AddDate(0, 0, 3), buckets[2].End)
+	historyMock.AssertExpectations(t)
+
+	// Expired buckets are loaded again
+	for key, entry := range statsDomain.cache {
+		entry.expires = time.Now()
+		statsDomain.cache[key] = entry
+	}
+	historyMock.On("GetBetween", statsDay, statsDay.AddDate(0, 0, 1)).Return(history, nil).Once()
+	_, err = statsDomain.Get(StatsDaily, &StatsRequest{From: "2021-03-03", To: "2021-03-03"})
+	require.NoError(t, err)
+	historyMock.AssertExpectations(t)
+}
+
+func TestStatsDomainGetWeekly(t *testing.T) {
+	historyMock := HistoryRepositoryMock{}
+	statsDomain := NewStatsDomain(&historyMock)
+
+	monday := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	historyMock.On("GetBetween", monday, monday.AddDate(0, 0, 14)).Return([]entity.SessionHistory{}, nil)
+
+	buckets, err := statsDomain.Get(StatsWeekly, &StatsRequest{From: "2021-03-03", To: "2021-03-09"})
+	require.NoError(t, err)
+	require.Len(t, buckets, 2)
+	assert.Equal(t, monday, buckets[0].Start)
+	assert.Equal(t, monday.AddDate(0, 0, 7), buckets[1].Start)
+}
+
+func TestStatsDomainGetDefaultRange(t *testing.T) {
+	historyMock := HistoryRepositoryMock{}
+	statsDomain := NewStatsDomain(&historyMock)
+
+	historyMock.On("GetBetween", mock.Anything, mock.Anything).Return([]entity.SessionHistory{}, nil)
+
+	buckets, err := statsDomain.Get(StatsDaily, &StatsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, buckets, 30)
+
+	buckets, err = statsDomain.Get(StatsWeekly, &StatsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, buckets, 12)
+	assert.Equal(t, time.Monday, buckets[0].Start.Weekday())
+}
+
+func TestStatsDomainGetInvalid(t *testing.T) {
+	historyMock := HistoryRepositoryMock{}
+	statsDomain := NewStatsDomain(&historyMock)
+
+	requests := []struct {
+		period  StatsPeriod
+		request StatsRequest
+	}{
+		{"monthly", StatsRequest{}},
+		{StatsDaily, StatsRequest{From: "03/03/2021"}},
+		{StatsDaily, StatsRequest{To: "tomorrow"}},
+		{StatsDaily, StatsRequest{From: "2021-03-04", To: "2021-03-03"}},
+		{StatsDaily, StatsRequest{From: "2019-01-01", To: "2021-03-03"}},
+		{StatsDaily, StatsRequest{Limit: -1}},
+		{StatsDaily, StatsRequest{Limit: MaxStatsLimit + 1}},
+		{StatsWeekly, StatsRequest{From: "2020-01-01", To: "2021-03-03"}},
+	}
+
+	for _, r := range requests {
+		_, err := statsDomain.Get(r.period, &r.request)
+		assert.True(t, errors.Is(err, ErrInvalidStatsRequest), "Request %v wasn't rejected", r)
+	}
+	historyMock.AssertNotCalled(t, "GetBetween", mock.Anything, mock.Anything)
+}
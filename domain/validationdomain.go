@@ -4,36 +4,61 @@ import (
 	"fmt"
 	"net"
 	"regexp"
+	"sync"
 	"unicode"
 )
 
 // ValidationDomain provides the domain logic for session validation
 type ValidationDomain struct {
-	stringBlacklist []regexp.Regexp
-	ipBlacklist     []net.IP
+	mutex     sync.RWMutex
+	blacklist *blacklist // Blacklist from the configuration file
+	bans      *blacklist // Bans added at runtime
+}
+
+// blacklist is a compiled set of string and IP blacklist entries.
+type blacklist struct {
+	strings []regexp.Regexp
+	ips     *ipTrie
 }
 
 // NewValidationDomain creates a new initalized Validation domain logic struct.
+// IP blacklist entries can either be single IPs or CIDR ranges.
 func NewValidationDomain(stringBlacklist []string, ipBlacklist []string) (*ValidationDomain, error) {
-	ub := make([]regexp.Regexp, 0, len(stringBlacklist))
-	for _, entry := range stringBlacklist {
-		exp, err := regexp.Compile(entry)
-		if err != nil {
-			return nil, fmt.Errorf("Can't compile username blacklist regexp '%s': %w", entry, err)
-		}
-		ub = append(ub, *exp)
+	d := &ValidationDomain{bans: &blacklist{ips: newIPTrie()}}
+	if err := d.Reload(stringBlacklist, ipBlacklist); err != nil {
+		return nil, err
 	}
 
-	ib := make([]net.IP, 0, len(ipBlacklist))
-	for _, entry := range ipBlacklist {
-		ip := net.ParseIP(entry)
-		if ip == nil {
-			return nil, fmt.Errorf("Can't parse ip blacklist entry '%s'", entry)
-		}
-		ib = append(ib, ip)
+	return d, nil
+}
+
+// Reload replaces the blacklists at runtime. The old blacklists stay active if the new ones can't be parsed.
+func (d *ValidationDomain) Reload(stringBlacklist []string, ipBlacklist []string) error {
+	b, err := compileBlacklist(stringBlacklist, ipBlacklist)
+	if err != nil {
+		return err
 	}
 
-	return &ValidationDomain{ub, ib}, nil
+	d.mutex.Lock()
+	d.blacklist = b
+	d.mutex.Unlock()
+
+	return nil
+}
+
+// SetBans replaces the runtime bans, which are checked in addition to the blacklists.
+// The old bans stay active if the new ones can't be parsed.
+func (d *ValidationDomain) SetBans(stringBans []string, ipBans []string) error {
+	b, err := compileBlacklist(stringBans, ipBans)
+	if err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	d.bans = b
+	d.mutex.Unlock()
+
+	return nil
 }
 
 // ValidateString validates a string against a regexp based blacklist and other rulesets. The validation has linear complexity.
@@ -42,24 +67,19 @@ func (d *ValidationDomain) ValidateString(s string) bool {
 		return false
 	}
 
-	for _, entry := range d.stringBlacklist {
-		if entry.MatchString(s) {
-			return false
-		}
-	}
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
 
-	return true
+	return !d.blacklist.matchString(s) && !d.bans.matchString(s)
 }
 
-// ValdateIP validates an IP address against a IP blacklist. The validation has linear complexity.
+// ValdateIP validates an IP address against a IP blacklist. The lookup is done in a prefix tree
+// and has a complexity linear to the address length.
 func (d *ValidationDomain) ValdateIP(ip net.IP) bool {
-	for _, entry := range d.ipBlacklist {
-		if entry.Equal(ip) {
-			return false
-		}
-	}
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
 
-	return true
+	return !d.blacklist.ips.Contains(ip) && !d.bans.ips.Contains(ip)
 }
 
 func (d *ValidationDomain) isASCII(s string) bool {
@@ -71,3 +91,35 @@ func (d *ValidationDomain) isASCII(s string) bool {
 
 	return true
 }
+
+func compileBlacklist(stringBlacklist []string, ipBlacklist []string) (*blacklist, error) {
+	ub := make([]regexp.Regexp, 0, len(stringBlacklist))
+	for _, entry := range stringBlacklist {
+		exp, err := regexp.Compile(entry)
+		if err != nil {
+			return nil, fmt.Errorf("Can't compile username blacklist regexp '%s': %w", entry, err)
+		}
+		ub = append(ub, *exp)
+	}
+
+	ib := newIPTrie()
+	for _, entry := range ipBlacklist {
+		network, err := parseIPNetwork(entry)
+		if err != nil {
+			return nil, fmt.Errorf("Can't parse ip blacklist entry '%s': %w", entry, err)
+		}
+		ib.Insert(network)
+	}
+
+	return &blacklist{ub, ib}, nil
+}
+
+func (b *blacklist) matchString(s string) bool {
+	for _, entry := range b.strings {
+		if entry.MatchString(s) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -66,3 +66,61 @@ func TestValidationDomainValidateIP(t *testing.T) {
 	assert.False(t, validationDomain.ValdateIP(net.ParseIP("127.0.0.1")))
 	assert.False(t, validationDomain.ValdateIP(net.ParseIP("2001:db8:0:8d3:0:8a2e:70:7344")))
 }
+
+func TestValidationDomainValidateIPRange(t *testing.T) {
+	validationDomain, err := NewValidationDomain(testStringBlacklist, []string{
+		"10.0.0.0/8",
+		"192.168.178.0/24",
+		"2001:db8:abcd::/48",
+	})
+	require.NoError(t, err)
+
+	assert.False(t, validationDomain.ValdateIP(net.ParseIP("10.0.0.1")))
+	assert.False(t, validationDomain.ValdateIP(net.ParseIP("10.255.255.255")))
+	assert.False(t, validationDomain.ValdateIP(net.ParseIP("192.168.178.2")))
+	assert.False(t, validationDomain.ValdateIP(net.ParseIP("::ffff:192.168.178.2")))
+	assert.False(t, validationDomain.ValdateIP(net.ParseIP("2001:db8:abcd:12::1")))
+	assert.True(t, validationDomain.ValdateIP(net.ParseIP("11.0.0.1")))
+	assert.True(t, validationDomain.ValdateIP(net.ParseIP("192.168.179.2")))
+	assert.True(t, validationDomain.ValdateIP(net.ParseIP("2001:db8:abce::1")))
+}
+
+func TestValidationDomainValidateIPv4MappedRange(t *testing.T) {
+	validationDomain, err := NewValidationDomain(testStringBlacklist, []string{"::ffff:10.0.0.0/104"})
+	require.NoError(t, err)
+
+	assert.False(t, validationDomain.ValdateIP(net.ParseIP("10.0.0.1")))
+	assert.False(t, validationDomain.ValdateIP(net.ParseIP("::ffff:10.1.2.3")))
+	assert.True(t, validationDomain.ValdateIP(net.ParseIP("11.0.0.1")))
+	assert.True(t, validationDomain.ValdateIP(net.ParseIP("2001:db8::1")))
+}
+
+func TestValidationDomainInvalidIPRange(t *testing.T) {
+	_, err := NewValidationDomain(testStringBlacklist, []string{"10.0.0.0/33"})
+	require.Error(t, err)
+
+	_, err = NewValidationDomain(testStringBlacklist, []string{"2001:db8::/129"})
+	require.Error(t, err)
+}
+
+func TestValidationDomainReload(t *testing.T) {
+	validationDomain, err := NewValidationDomain(testStringBlacklist, testIPBlacklist)
+	require.NoError(t, err)
+
+	assert.False(t, validationDomain.ValdateIP(net.ParseIP("127.0.0.1")))
+	assert.True(t, validationDomain.ValidateString("newBadWord"))
+
+	err = validationDomain.Reload([]string{"^newBad.*"}, []string{"8.8.8.0/24"})
+	require.NoError(t, err)
+
+	assert.True(t, validationDomain.ValdateIP(net.ParseIP("127.0.0.1")))
+	assert.False(t, validationDomain.ValdateIP(net.ParseIP("8.8.8.8")))
+	assert.False(t, validationDomain.ValidateString("newBadWord"))
+
+	// Invalid entries should keep the old blacklists
+	err = validationDomain.Reload([]string{"["}, []string{"1.1.1.1"})
+	require.Error(t, err)
+
+	assert.False(t, validationDomain.ValdateIP(net.ParseIP("8.8.8.8")))
+	assert.True(t, validationDomain.ValdateIP(net.ParseIP("1.1.1.1")))
+}
@@ -0,0 +1,426 @@
+package domain
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// The headers of a webhook request besides the JSON content type.
+const (
+	WebhookEventHeader     = "X-Lobby-Event"     // Type of the session event
+	WebhookDeliveryHeader  = "X-Lobby-Delivery"  // ID of the notification, the same on every attempt
+	WebhookSignatureHeader = "X-Lobby-Signature" // "sha256=" followed by the hex HMAC-SHA256 of the body, see SignWebhook
+)
+
+// webhookBatchSize is the maximal amount of queued notifications loaded per run.
+const webhookBatchSize = 100
+
+// webhookMaxResponse is the amount of the response body that is read, so the connection can be reused.
+const webhookMaxResponse = 4 << 10
+
+// webhookEvents are the session events a webhook can be notified about. Touches are too frequent.
+var webhookEvents = map[SessionEventType]struct{}{
+	SessionCreated: {},
+	SessionUpdated: {},
+	SessionRemoved: {},
+	SessionPurged:  {},
+}
+
+// defaultWebhookEvents are the events of a webhook without configured events: rooms appearing and closing.
+var defaultWebhookEvents = []SessionEventType{SessionCreated, SessionRemoved, SessionPurged}
+
+// WebhookConfig configures a webhook that gets notified about the rooms matching its filters.
+type WebhookConfig struct {
+	Name      string             // Identifies the webhook in the queue and the logs
+	URL       string             // Receiver of the POST requests
+	Secret    string             // Key of the request signature
+	Events    []SessionEventType // Any of created, updated, removed and purged. Rooms appearing and closing if empty
+	Cores     []string           // Core names, case insensitive. Any core if empty
+	GameCRCs  []string           // Game CRCs, case insensitive. Any game if empty
+	Countries []string           // Two letter country codes of the hosts. Any country if empty
+	Username  string             // Regular expression the username needs to match. Any username if empty
+}
+
+// WebhookPayload is the JSON body of a webhook request.
+type WebhookPayload struct {
+	Event     SessionEventType `json:"event"`
+	Hook      string           `json:"hook"`
+	Timestamp time.Time        `json:"timestamp"` // Time of the event, the request may be sent a lot later
+	Session   entity.Session   `json:"session"`
+}
+
+// ValidateWebhooks checks the webhook configuration for invalid values.
+func ValidateWebhooks(hooks []WebhookConfig) error {
+	_, err := compileWebhooks(hooks)
+	return err
+}
+
+// SignWebhook returns the signature header of a webhook request body. Receivers compute it with their copy of
+// the secret and compare it in constant time.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhook is a configured webhook with its compiled filters.
+type webhook struct {
+	config    WebhookConfig
+	events    map[SessionEventType]struct{}
+	cores     map[string]struct{}
+	crcs      map[string]struct{}
+	countries map[string]struct{}
+	username  *regexp.Regexp
+}
+
+// compileWebhooks validates the webhook configuration and compiles the filters.
+func compileWebhooks(hooks []WebhookConfig) ([]*webhook, error) {
+	compiled := make([]*webhook, 0, len(hooks))
+	names := make(map[string]struct{}, len(hooks))
+	for _, c := range hooks {
+		if c.Name == "" || len(c.Name) > 64 {
+			return nil, fmt.Errorf("invalid webhook name '%s'", c.Name)
+		}
+		if _, found := names[c.Name]; found {
+			return nil, fmt.Errorf("duplicate webhook name '%s'", c.Name)
+		}
+		names[c.Name] = struct{}{}
+
+		if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook %s has an invalid URL '%s'", c.Name, c.URL)
+		}
+		if c.Secret == "" {
+			return nil, fmt.Errorf("webhook %s needs a secret", c.Name)
+		}
+
+		h := &webhook{
+			config:    c,
+			events:    make(map[SessionEventType]struct{}),
+			cores:     make(map[string]struct{}, len(c.Cores)),
+			crcs:      make(map[string]struct{}, len(c.GameCRCs)),
+			countries: make(map[string]struct{}, len(c.Countries)),
+		}
+
+		events := c.Events
+		if len(events) == 0 {
+			events = defaultWebhookEvents
+		}
+		for _, e := range events {
+			if _, found := webhookEvents[e]; !found {
+				return nil, fmt.Errorf("webhook %s has an unsupported event '%s'", c.Name, e)
+			}
+			h.events[e] = struct{}{}
+		}
+		for _, core := range c.Cores {
+			h.cores[strings.ToLower(core)] = struct{}{}
+		}
+		for _, crc := range c.GameCRCs {
+			if len(crc) != 8 {
+				return nil, fmt.Errorf("webhook %s has an invalid game CRC '%s'", c.Name, crc)
+			}
+			h.crcs[strings.ToUpper(crc)] = struct{}{}
+		}
+		for _, country := range c.Countries {
+			if len(country) != 2 {
+				return nil, fmt.Errorf("webhook %s has an invalid country code '%s'", c.Name, country)
+			}
+			h.countries[strings.ToLower(country)] = struct{}{}
+		}
+		if c.Username != "" {
+			var err error
+			if h.username, err = regexp.Compile(c.Username); err != nil {
+				return nil, fmt.Errorf("webhook %s has an invalid username expression: %w", c.Name, err)
+			}
+		}
+
+		compiled = append(compiled, h)
+	}
+
+	return compiled, nil
+}
+
+// matches checks whether the webhook wants to be notified about the event.
+func (h *webhook) matches(event *SessionEvent) bool {
+	if _, found := h.events[event.Type]; !found {
+		return false
+	}
+	if !matchesSet(h.cores, strings.ToLower(event.Session.CoreName)) ||
+		!matchesSet(h.crcs, strings.ToUpper(event.Session.GameCRC)) ||
+		!matchesSet(h.countries, strings.ToLower(event.Session.Country)) {
+		return false
+	}
+	if h.username != nil && !h.username.MatchString(event.Session.Username) {
+		return false
+	}
+
+	return true
+}
+
+// matchesSet checks whether the value is part of the filter set. An empty set matches any value.
+func matchesSet(set map[string]struct{}, value string) bool {
+	if len(set) == 0 {
+		return true
+	}
+	_, found := set[value]
+	return found
+}
+
+// WebhookRepository interface to decouple the domain logic from the repository code.
+type WebhookRepository interface {
+	Enqueue(d *entity.WebhookDelivery) error
+	GetDue(now time.Time, limit int) ([]entity.WebhookDelivery, error)
+	Reschedule(d *entity.WebhookDelivery) error
+	Delete(id uint) error
+}
+
+// WebhookDomain notifies external services like chat bots about rooms appearing and closing. The events of the
+// session domain are queued in the database for every webhook whose filters match, so pending notifications
+// survive restarts. Only the replica holding the webhook lease delivers them. Failed deliveries are retried with
+// an exponential backoff. A notification can arrive more than once, receivers recognize it by its delivery ID.
+type WebhookDomain struct {
+	hooks       []*webhook
+	events      map[SessionEventType]struct{}
+	webhookRepo WebhookRepository
+	leaseDomain *LeaseDomain
+	config      LobbyConfig
+	logger      Logger
+	client      *http.Client
+	wake        chan struct{}
+}
+
+// NewWebhookDomain creates a new webhook domain. The deliveries need to be started with Run.
+func NewWebhookDomain(
+	hooks []WebhookConfig,
+	webhookRepo WebhookRepository,
+	leaseDomain *LeaseDomain,
+	config LobbyConfig,
+	logger Logger) (*WebhookDomain, error) {
+	compiled, err := compileWebhooks(hooks)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(map[SessionEventType]struct{})
+	for _, h := range compiled {
+		for e := range h.events {
+			events[e] = struct{}{}
+		}
+	}
+
+	return &WebhookDomain{
+		hooks:       compiled,
+		events:      events,
+		webhookRepo: webhookRepo,
+		leaseDomain: leaseDomain,
+		config:      config,
+		logger:      logger,
+		client:      &http.Client{Timeout: config.WebhookTimeout},
+		wake:        make(chan struct{}, 1),
+	}, nil
+}
+
+// Notify queues the event for every webhook whose filters match the session. Errors are logged, so the session
+// handling isn't affected by the webhooks.
+func (d *WebhookDomain) Notify(event SessionEvent) {
+	if d == nil {
+		return
+	}
+
+	now := time.Now()
+	queued := false
+	for _, h := range d.hooks {
+		if !h.matches(&event) {
+			continue
+		}
+
+		payload, err := json.Marshal(WebhookPayload{event.Type, h.config.Name, now, event.Session})
+		if err != nil {
+			d.logger.Errorf("Can't encode %s notification for webhook %s: %v", event.Type, h.config.Name, err)
+			continue
+		}
+
+		delivery := entity.WebhookDelivery{Hook: h.config.Name, Event: string(event.Type), Payload: string(payload), NextAttempt: now}
+		if err = d.webhookRepo.Enqueue(&delivery); err != nil {
+			d.logger.Errorf("Can't queue %s notification for webhook %s: %v", event.Type, h.config.Name, err)
+			continue
+		}
+		queued = true
+	}
+
+	if queued {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run delivers the queued notifications until the context gets canceled. New notifications are delivered right
+// away, the queue is checked for due retries in the webhook interval.
+func (d *WebhookDomain) Run(ctx context.Context) {
+	if len(d.hooks) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(d.config.WebhookInterval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverAll(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// wants checks whether any webhook can be notified about events of the given type.
+func (d *WebhookDomain) wants(eventType SessionEventType) bool {
+	if d == nil {
+		return false
+	}
+
+	_, found := d.events[eventType]
+	return found
+}
+
+// deliverAll attempts the due notifications if this replica holds the webhook lease. A run stops starting new
+// attempts after the webhook interval, so it ends before the lease expires. After a failure the further
+// notifications of the same webhook wait for the next run.
+func (d *WebhookDomain) deliverAll(ctx context.Context, now time.Time) {
+	leader, err := d.leaseDomain.Acquire(WebhookLease, d.config.WebhookInterval+d.config.WebhookTimeout)
+	if err != nil {
+		d.logger.Errorf("Can't acquire webhook lease: %v", err)
+		return
+	}
+	if !leader {
+		return
+	}
+
+	deliveries, err := d.webhookRepo.GetDue(now, webhookBatchSize)
+	if err != nil {
+		d.logger.Errorf("Can't get queued webhook notifications: %v", err)
+		return
+	}
+
+	start := time.Now()
+	failed := make(map[string]struct{})
+	for i := range deliveries {
+		if ctx.Err() != nil || time.Since(start) > d.config.WebhookInterval {
+			return
+		}
+		if _, found := failed[deliveries[i].Hook]; found {
+			continue
+		}
+		if !d.deliver(ctx, &deliveries[i], now) {
+			failed[deliveries[i].Hook] = struct{}{}
+		}
+	}
+}
+
+// deliver sends a queued notification and removes it from the queue. A failed notification is rescheduled with
+// an exponential backoff or dropped once it reaches the max attempts. Returns false if the webhook failed.
+func (d *WebhookDomain) deliver(ctx context.Context, delivery *entity.WebhookDelivery, now time.Time) bool {
+	hook := d.hook(delivery.Hook)
+	if hook == nil {
+		// The webhook got removed from the configuration
+		if err := d.webhookRepo.Delete(delivery.ID); err != nil {
+			d.logger.Errorf("Can't drop notification of removed webhook %s: %v", delivery.Hook, err)
+		}
+		return true
+	}
+
+	err := d.send(ctx, hook, delivery)
+	if err == nil {
+		if err = d.webhookRepo.Delete(delivery.ID); err != nil {
+			d.logger.Errorf("Can't remove delivered notification of webhook %s: %v", delivery.Hook, err)
+		}
+		return true
+	}
+	if ctx.Err() != nil {
+		// Shutting down, the attempt doesn't count
+		return false
+	}
+
+	delivery.Attempts++
+	if delivery.Attempts >= d.config.WebhookMaxAttempts {
+		d.logger.Errorf("Dropping %s notification of webhook %s after %d attempts: %v", delivery.Event, delivery.Hook, delivery.Attempts, err)
+		if err = d.webhookRepo.Delete(delivery.ID); err != nil {
+			d.logger.Errorf("Can't drop notification of webhook %s: %v", delivery.Hook, err)
+		}
+		return false
+	}
+
+	delivery.NextAttempt = now.Add(d.backoff(delivery.Attempts))
+	if err = d.webhookRepo.Reschedule(delivery); err != nil {
+		d.logger.Errorf("Can't reschedule notification of webhook %s: %v", delivery.Hook, err)
+	}
+
+	return false
+}
+
+// send posts the signed notification to the webhook.
+func (d *WebhookDomain) send(ctx context.Context, hook *webhook, delivery *entity.WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.config.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(hook.config.Secret, []byte(delivery.Payload)))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookMaxResponse))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// backoff returns the delay after the given amount of failed attempts. It doubles with every attempt, starting
+// at the webhook interval, up to the max backoff.
+func (d *WebhookDomain) backoff(attempts int) time.Duration {
+	delay := d.config.WebhookInterval
+	for i := 1; i < attempts && delay < d.config.WebhookMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.config.WebhookMaxBackoff {
+		delay = d.config.WebhookMaxBackoff
+	}
+
+	return delay
+}
+
+// hook returns the configured webhook with the given name or nil.
+func (d *WebhookDomain) hook(name string) *webhook {
+	for _, h := range d.hooks {
+		if h.config.Name == name {
+			return h
+		}
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/libretro/netplay-lobby-server-go/model"
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+	"github.com/libretro/netplay-lobby-server-go/model/repository"
+)
+
+const testWebhookSecret = "hooksecret"
+
+// webhookReceiver records the requests of the webhooks and answers with the statuses in order, 200 afterwards.
+type webhookReceiver struct {
+	mutex    sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, string(body))
+
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *webhookReceiver) count() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.requests)
+}
+
+func setupWebhookReceiver(t *testing.T, statuses ...int) (*webhookReceiver, string) {
+	receiver := &webhookReceiver{statuses: statuses}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+	return receiver, server.URL
+}
+
+func setupWebhookDomain(t *testing.T, hooks []WebhookConfig, webhookRepo WebhookRepository) *WebhookDomain {
+	leaseDomain, err := NewLeaseDomain(repository.NewMemoryLeaseRepository())
+	require.NoError(t, err)
+	webhookDomain, err := NewWebhookDomain(hooks, webhookRepo, leaseDomain, DefaultLobbyConfig(), &testLogger{})
+	require.NoError(t, err)
+	return webhookDomain
+}
+
+func getQueued(t *testing.T, webhookRepo WebhookRepository) []entity.WebhookDelivery {
+	deliveries, err := webhookRepo.GetDue(time.Now().Add(time.Hour), webhookBatchSize)
+	require.NoError(t, err)
+	return deliveries
+}
+
+func TestWebhookDomainNotifyFilters(t *testing.T) {
+	webhookRepo := repository.NewMemoryWebhookRepository()
+	webhookDomain := setupWebhookDomain(t, []WebhookConfig{
+		{Name: "all", URL: "http://localhost/all", Secret: testWebhookSecret},
+		{
+			Name:      "nes",
+			URL:       "http://localhost/nes",
+			Secret:    testWebhookSecret,
+			Events:    []SessionEventType{SessionCreated},
+			Cores:     []string{"Nestopia"},
+			Countries: []string{"DE"},
+			Username:  "^team-",
+		},
+	}, webhookRepo)
+
+	nes := testSession
+	nes.CoreName = "nestopia"
+	nes.Country = "de"
+	nes.Username = "team-link"
+	other := nes
+	other.Username = "link"
+
+	webhookDomain.Notify(SessionEvent{SessionCreated, testSession})
+	webhookDomain.Notify(SessionEvent{SessionCreated, nes})
+	webhookDomain.Notify(SessionEvent{SessionCreated, other})
+	webhookDomain.Notify(SessionEvent{SessionUpdated, nes})
+	webhookDomain.Notify(SessionEvent{SessionTouched, nes})
+	webhookDomain.Notify(SessionEvent{SessionPurged, nes})
+
+	hooks := []string{}
+	events := []string{}
+	for _, d := range getQueued(t, webhookRepo) {
+		hooks = append(hooks, d.Hook)
+		events = append(events, d.Event)
+	}
+	assert.Equal(t, []string{"all", "all", "nes", "all", "all"}, hooks)
+	assert.Equal(t, []string{"created", "created", "created", "created", "purged"}, events)
+
+	assert.True(t, webhookDomain.wants(SessionCreated))
+	assert.False(t, webhookDomain.wants(SessionUpdated))
+	assert.False(t, webhookDomain.wants(SessionTouched))
+}
+
+func TestWebhookDomainDeliver(t *testing.T) {
+	receiver, url := setupWebhookReceiver(t)
+	webhookRepo := repository.NewMemoryWebhookRepository()
+	webhookDomain := setupWebhookDomain(t, []WebhookConfig{{Name: "discord", URL: url, Secret: testWebhookSecret}}, webhookRepo)
+
+	webhookDomain.Notify(SessionEvent{SessionCreated, testSession})
+	queued := getQueued(t, webhookRepo)
+	require.Equal(t, 1, len(queued))
+
+	webhookDomain.deliverAll(context.Background(), time.Now())
+	require.Equal(t, 1, receiver.count())
+	assert.Equal(t, 0, len(getQueued(t, webhookRepo)), "Delivered notification is still queued")
+
+	req, body := receiver.requests[0], receiver.bodies[0]
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Equal(t, "created", req.Header.Get(WebhookEventHeader))
+	assert.Equal(t, "1", req.Header.Get(WebhookDeliveryHeader))
+	assert.Equal(t, SignWebhook(testWebhookSecret, []byte(body)), req.Header.Get(WebhookSignatureHeader))
+	assert.NotEqual(t, SignWebhook("wrong", []byte(body)), req.Header.Get(WebhookSignatureHeader))
+
+	var payload WebhookPayload
+	require.NoError(t, json.Unmarshal([]byte(body), &payload))
+	assert.Equal(t, SessionCreated, payload.Event)
+	assert.Equal(t, "discord", payload.Hook)
+	assert.Equal(t, testSession.Username, payload.Session.Username)
+	assert.Equal(t, testSession.RoomID, payload.Session.RoomID)
+	assert.WithinDuration(t, time.Now(), payload.Timestamp, time.Minute)
+}
+
+func TestWebhookDomainRetry(t *testing.T) {
+	receiver, url := setupWebhookReceiver(t, http.StatusInternalServerError, http.StatusBadGateway)
+	webhookRepo := repository.NewMemoryWebhookRepository()
+	webhookDomain := setupWebhookDomain(t, []WebhookConfig{{Name: "discord", URL: url, Secret: testWebhookSecret}}, webhookRepo)
+	interval := webhookDomain.config.WebhookInterval
+
+	webhookDomain.Notify(SessionEvent{SessionCreated, testSession})
+	webhookDomain.Notify(SessionEvent{SessionRemoved, testSession})
+
+	// The further notifications of a failed webhook wait for the next run
+	now := time.Now()
+	webhookDomain.deliverAll(context.Background(), now)
+	assert.Equal(t, 1, receiver.count())
+	queued := getQueued(t, webhookRepo)
+	require.Equal(t, 2, len(queued))
+	assert.Equal(t, "removed", queued[0].Event)
+	assert.Equal(t, "created", queued[1].Event)
+	assert.Equal(t, 1, queued[1].Attempts)
+	assert.True(t, queued[1].NextAttempt.Equal(now.Add(interval)))
+
+	webhookDomain.deliverAll(context.Background(), now)
+	assert.Equal(t, 2, receiver.count())
+
+	// Both are due again after the backoff
+	webhookDomain.deliverAll(context.Background(), now.Add(4*interval))
+	assert.Equal(t, 4, receiver.count())
+	assert.Equal(t, 0, len(getQueued(t, webhookRepo)))
+	assert.Equal(t, receiver.requests[0].Header.Get(WebhookDeliveryHeader), receiver.requests[2].Header.Get(WebhookDeliveryHeader))
+	assert.Equal(t, 0, webhookDomain.logger.(*testLogger).errors)
+}
+
+func TestWebhookDomainMaxAttempts(t *testing.T) {
+	receiver, url := setupWebhookReceiver(t, http.StatusInternalServerError, http.StatusInternalServerError)
+	webhookRepo := repository.NewMemoryWebhookRepository()
+	webhookDomain := setupWebhookDomain(t, []WebhookConfig{{Name: "discord", URL: url, Secret: testWebhookSecret}}, webhookRepo)
+	webhookDomain.config.WebhookMaxAttempts = 2
+
+	webhookDomain.Notify(SessionEvent{SessionCreated, testSession})
+	webhookDomain.deliverAll(context.Background(), time.Now())
+	webhookDomain.deliverAll(context.Background(), time.Now().Add(time.Hour))
+
+	assert.Equal(t, 2, receiver.count())
+	assert.Equal(t, 0, len(getQueued(t, webhookRepo)), "Notification wasn't dropped")
+	assert.Equal(t, 1, webhookDomain.logger.(*testLogger).errors)
+}
+
+func TestWebhookDomainBackoff(t *testing.T) {
+	webhookDomain := setupWebhookDomain(t, nil, repository.NewMemoryWebhookRepository())
+	interval := webhookDomain.config.WebhookInterval
+
+	assert.Equal(t, interval, webhookDomain.backoff(1))
+	assert.Equal(t, 2*interval, webhookDomain.backoff(2))
+	assert.Equal(t, 8*interval, webhookDomain.backoff(4))
+	assert.Equal(t, webhookDomain.config.WebhookMaxBackoff, webhookDomain.backoff(1000))
+}
+
+func TestWebhookDomainRemovedHook(t *testing.T) {
+	webhookRepo := repository.NewMemoryWebhookRepository()
+	require.NoError(t, webhookRepo.Enqueue(&entity.WebhookDelivery{Hook: "gone", Event: "created", Payload: "{}", NextAttempt: time.Now()}))
+
+	webhookDomain := setupWebhookDomain(t, []WebhookConfig{{Name: "discord", URL: "http://localhost/", Secret: testWebhookSecret}}, webhookRepo)
+	webhookDomain.deliverAll(context.Background(), time.Now())
+	assert.Equal(t, 0, len(getQueued(t, webhookRepo)))
+}
+
+func TestWebhookDomainFollower(t *testing.T) {
+	receiver, url := setupWebhookReceiver(t)
+	webhookRepo := repository.NewMemoryWebhookRepository()
+	leaseDomain, leaseRepoMock := setupLeaseDomain(t)
+	config := DefaultLobbyConfig()
+	webhookDomain, err := NewWebhookDomain([]WebhookConfig{{Name: "discord", URL: url, Secret: testWebhookSecret}}, webhookRepo, leaseDomain, config, &testLogger{})
+	require.NoError(t, err)
+
+	// Only the replica holding the lease delivers
+	leaseRepoMock.On("Acquire", WebhookLease, leaseDomain.holder, 3*(config.WebhookInterval+config.WebhookTimeout)).Return(false, nil)
+	webhookDomain.Notify(SessionEvent{SessionCreated, testSession})
+	webhookDomain.deliverAll(context.Background(), time.Now())
+
+	assert.Equal(t, 0, receiver.count())
+	assert.Equal(t, 1, len(getQueued(t, webhookRepo)))
+	leaseRepoMock.AssertExpectations(t)
+}
+
+func TestWebhookDomainRestart(t *testing.T) {
+	receiver, url := setupWebhookReceiver(t)
+	hooks := []WebhookConfig{{Name: "discord", URL: url, Secret: testWebhookSecret}}
+	path := filepath.Join(t.TempDir(), "lobby.db")
+
+	openRepo := func() WebhookRepository {
+		db, err := model.GetSqliteDB(path)
+		require.NoError(t, err, "Can't open sqlite3 db")
+		t.Cleanup(func() { db.Close() })
+		require.NoError(t, db.AutoMigrate(&entity.WebhookDelivery{}).Error)
+		return repository.NewWebhookRepository(db)
+	}
+
+	before := setupWebhookDomain(t, hooks, openRepo())
+	before.Notify(SessionEvent{SessionPurged, testSession})
+
+	// The queued notification is delivered after a restart
+	after := setupWebhookDomain(t, hooks, openRepo())
+	after.deliverAll(context.Background(), time.Now())
+	require.Equal(t, 1, receiver.count())
+	assert.Equal(t, "purged", receiver.requests[0].Header.Get(WebhookEventHeader))
+}
+
+func TestWebhookDomainSessionEvents(t *testing.T) {
+	r := setupReplica(t, filepath.Join(t.TempDir(), "lobby.db"), false)
+	webhookRepo := repository.NewMemoryWebhookRepository()
+	r.sessionDomain.webhooks = setupWebhookDomain(t, []WebhookConfig{
+		{Name: "bsnes", URL: "http://localhost/", Secret: testWebhookSecret, Cores: []string{"bsnes"}},
+	}, webhookRepo)
+
+	request := testRequest
+	created, err := r.sessionDomain.Add(&request, testIP)
+	require.NoError(t, err)
+
+	old := testSession
+	old.Port = 55356
+	old.UpdatedAt = time.Now().Add(-2 * time.Minute)
+	old.CalculateID()
+	old.CalculateContentHash()
+	require.NoError(t, r.sessionRepo.Create(&old))
+	require.NoError(t, r.sessionDomain.PurgeOld())
+
+	queued := getQueued(t, webhookRepo)
+	require.Equal(t, 2, len(queued))
+	assert.Equal(t, "created", queued[0].Event)
+	assert.Equal(t, "purged", queued[1].Event)
+
+	var payload WebhookPayload
+	require.NoError(t, json.Unmarshal([]byte(queued[0].Payload), &payload))
+	assert.Equal(t, created.RoomID, payload.Session.RoomID)
+	assert.Equal(t, "bsnes", payload.Session.CoreName)
+}
+
+func TestValidateWebhooks(t *testing.T) {
+	valid := WebhookConfig{Name: "discord", URL: "https://bot.example.com/lobby", Secret: "secret"}
+	require.NoError(t, ValidateWebhooks([]WebhookConfig{valid}))
+
+	invalid := []func(c *WebhookConfig){
+		func(c *WebhookConfig) { c.Name = "" },
+		func(c *WebhookConfig) { c.URL = "ftp://bot.example.com" },
+		func(c *WebhookConfig) { c.URL = "https://" },
+		func(c *WebhookConfig) { c.Secret = "" },
+		func(c *WebhookConfig) { c.Events = []SessionEventType{SessionTouched} },
+		func(c *WebhookConfig) { c.Events = []SessionEventType{"closed"} },
+		func(c *WebhookConfig) { c.GameCRCs = []string{"FFFF"} },
+		func(c *WebhookConfig) { c.Countries = []string{"germany"} },
+		func(c *WebhookConfig) { c.Username = "(" },
+	}
+	for i, modify := range invalid {
+		config := valid
+		modify(&config)
+		assert.Error(t, ValidateWebhooks([]WebhookConfig{config}), "Webhook %d wasn't rejected", i)
+	}
+
+	assert.Error(t, ValidateWebhooks([]WebhookConfig{valid, valid}), "Duplicate webhook wasn't rejected")
+}
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/jinzhu/gorm"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -18,6 +26,9 @@ import (
 	"github.com/libretro/netplay-lobby-server-go/model/repository"
 )
 
+// ShutdownTimeout is the time in-flight requests get to finish on shutdown.
+const ShutdownTimeout = 10 * time.Second
+
 func main() {
 	var verbose = flag.Bool("v", false, "verbose logging")
 	flag.Parse()
@@ -27,42 +38,147 @@ func main() {
 	server.Server.ReadTimeout = 5 * time.Second
 	server.Server.WriteTimeout = 5 * time.Second
 
-	config, err := readConfig()
+	configReader, config, err := readConfig()
 	if err != nil {
 		server.Logger.Fatalf("Can't get configuration values: %v", err)
 	}
 
+	if *verbose {
+		server.Logger.SetLevel(log.INFO)
+	} else {
+		server.Logger.SetLevel(log.WARN)
+	}
+
+	validationDomain, err := domain.NewValidationDomain(config.Blacklist.Strings, config.Blacklist.IPs)
+	if err != nil {
+		server.Logger.Fatalf("Can't intialize validation domain: %v", err)
+	}
+
+	geoIP2Domain, err := domain.NewGeoIP2Domain(config.Server.GeoLite2Path)
+	if err != nil {
+		server.Logger.Fatalf("Can't intialize geolite2 database: %v", err)
+	}
+
 	// Init domain logic and model
-	db, err := initDatabase(config.Database.Type, config.Database.Connection)
+	metricsDomain := domain.NewMetricsDomain()
+	repos, err := initRepositories(config.Database.Type, config.Database.Connection, metricsDomain)
 	if err != nil {
 		server.Logger.Fatalf("Can't initialize database: %v", err)
 	}
-	db = db.AutoMigrate(&entity.Session{})
 
-	if *verbose {
-		server.Logger.SetLevel(log.INFO)
-	} else {
-		server.Logger.SetLevel(log.WARN)
+	leaseDomain, err := domain.NewLeaseDomain(repos.lease)
+	if err != nil {
+		server.Logger.Fatalf("Can't initialize lease domain: %v", err)
+	}
+
+	webhookDomain, err := domain.NewWebhookDomain(config.Webhooks, repos.webhook, leaseDomain, config.Lobby, server.Logger)
+	if err != nil {
+		server.Logger.Fatalf("Can't initialize webhooks: %v", err)
 	}
 
-	sessionDomain, err := initDomain(db, config)
+	statsDomain := domain.NewStatsDomain(repos.history)
+	sessionDomain, probeDomain, err := initDomain(repos.session, config, geoIP2Domain, validationDomain, metricsDomain, statsDomain, webhookDomain, server.Logger)
 	if err != nil {
 		server.Logger.Fatalf("Can't initialize domain logic: %v", err)
 	}
 
+	// Reload the blacklists when the configuration file changes
+	configReader.OnConfigChange(func(e fsnotify.Event) {
+		newConfig, err := unmarshalConfig(configReader)
+		if err != nil {
+			server.Logger.Errorf("Can't reload configuration: %v", err)
+			return
+		}
+		if err := validationDomain.Reload(newConfig.Blacklist.Strings, newConfig.Blacklist.IPs); err != nil {
+			server.Logger.Errorf("Can't reload blacklists: %v", err)
+			return
+		}
+		server.Logger.Infof("Reloaded blacklists from %s", e.Name)
+	})
+	configReader.WatchConfig()
+
 	sessionCotroller := controller.NewSessionController(sessionDomain)
+	metricsController := controller.NewMetricsController(sessionDomain, metricsDomain)
+	statsController := controller.NewStatsController(statsDomain)
+	apiV2Controller := controller.NewAPIv2Controller(sessionDomain)
 
-	// Start the cleanup job to purge old sessions
-	go func() {
-		for true {
-			err := sessionDomain.PurgeOld()
-			if err != nil {
-				server.Logger.Fatalf("Can't purge old sessions: %v", err)
-			}
-			time.Sleep(2 * time.Minute)
+	federationDomain := domain.NewFederationDomain(config.Federation.Peers, repos.session, validationDomain, sessionDomain.GetEvents(), leaseDomain, config.Lobby, server.Logger)
+	var federationController *controller.FederationController
+	if config.Federation.Token != "" {
+		federationController = controller.NewFederationController(federationDomain, config.Federation.Token)
+	}
+
+	var adminDomain *domain.AdminDomain
+	var adminController *controller.AdminController
+	if config.Admin.Token != "" {
+		adminDomain, err = domain.NewAdminDomain(repos.session, sessionDomain, repos.ban, validationDomain)
+		if err != nil {
+			server.Logger.Fatalf("Can't initialize admin domain: %v", err)
 		}
+		adminController = controller.NewAdminController(adminDomain, config.Admin.Token)
+	}
+
+	// Stop gracefully on SIGINT and SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Start the cleanup job to purge old sessions, only one replica purges at a time
+	var workers sync.WaitGroup
+	purger := leaseDomain.Purger(sessionDomain, config.Lobby.PurgeInterval)
+	purgeWorker := domain.NewPurgeWorker(purger, config.Lobby.PurgeInterval, server.Logger)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		purgeWorker.Run(ctx)
 	}()
 
+	// Start the connectivity probe workers
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		probeDomain.Run(ctx)
+	}()
+
+	// Start the relay health checks
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		sessionDomain.GetMitm().Run(ctx)
+	}()
+
+	// Start mirroring the rooms of the federation peers
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		federationDomain.Run(ctx)
+	}()
+
+	// Start delivering the webhook notifications, only one replica delivers at a time
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		webhookDomain.Run(ctx)
+	}()
+
+	// Feed the event streams from the database, so they carry the changes of the other replicas as well
+	if config.Lobby.Replicated {
+		eventFeedDomain := domain.NewEventFeedDomain(repos.session, sessionDomain.GetEvents(), config.Lobby, server.Logger)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			eventFeedDomain.Run(ctx)
+		}()
+	}
+
+	// Pick up the bans issued at other replicas
+	if adminDomain != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			adminDomain.Run(ctx, config.Lobby.BanReloadInterval, server.Logger)
+		}()
+	}
+
 	// Server setup
 	server.Use(middleware.Logger())
 	server.Use(middleware.Recover())
@@ -70,16 +186,55 @@ func main() {
 
 	// Set the routes and prerender templates
 	sessionCotroller.RegisterRoutes(server)
+	metricsController.RegisterRoutes(server)
+	statsController.RegisterRoutes(server)
+	apiV2Controller.RegisterRoutes(server)
+	if federationController != nil {
+		federationController.RegisterRoutes(server)
+	}
+	if adminController != nil {
+		adminController.RegisterRoutes(server)
+	}
 	templatePath := fmt.Sprintf("%s/*.html", config.Server.TemplatePath)
 	if err = sessionCotroller.PrerenderTemplates(server, templatePath); err != nil {
 		server.Logger.Fatalf("Can't prerender templates: %v", err)
 	}
 
+	// Long lived requests like event streams get canceled as soon as the shutdown starts
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	server.Server.BaseContext = func(net.Listener) context.Context { return requestCtx }
+	server.Server.RegisterOnShutdown(cancelRequests)
+
 	// Start serving
-	server.Logger.Fatal(server.Start(config.Server.Address))
+	go func() {
+		if err := server.Start(config.Server.Address); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			server.Logger.Fatalf("Can't start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	server.Logger.Warnf("Shutting down, waiting up to %s for in-flight requests", ShutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		server.Logger.Errorf("Can't shut down server gracefully: %v", err)
+	}
+
+	workers.Wait()
+	if err := leaseDomain.ReleaseAll(); err != nil {
+		server.Logger.Errorf("Can't release leases: %v", err)
+	}
+	geoIP2Domain.Close()
+	if repos.db != nil {
+		if err := repos.db.Close(); err != nil {
+			server.Logger.Errorf("Can't close database: %v", err)
+		}
+	}
 }
 
-func readConfig() (*Config, error) {
+func readConfig() (*viper.Viper, *Config, error) {
 	viper := viper.New()
 	viper.SetConfigName("lobby")
 	viper.SetConfigType("yaml")
@@ -87,12 +242,35 @@ func readConfig() (*Config, error) {
 	viper.AddConfigPath("$HOME/.lobby")
 	viper.AddConfigPath("./config")
 	if err := viper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("Can't read configuration file: %w", err)
+		return nil, nil, fmt.Errorf("Can't read configuration file: %w", err)
+	}
+	conf, err := unmarshalConfig(viper)
+	if err != nil {
+		return nil, nil, err
 	}
-	var conf Config
+	return viper, conf, nil
+}
+
+func unmarshalConfig(viper *viper.Viper) (*Config, error) {
+	conf := Config{Lobby: domain.DefaultLobbyConfig()}
 	if err := viper.Unmarshal(&conf); err != nil {
 		return nil, fmt.Errorf("Can't unmarshal configuration file: %w", err)
 	}
+	if err := conf.Lobby.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid lobby configuration: %w", err)
+	}
+	if conf.Lobby.Replicated && conf.Database.Type == "memory" {
+		return nil, errors.New("Invalid lobby configuration: replicas can't share the memory database")
+	}
+	if err := domain.ValidateRelays(conf.RelayConfigs()); err != nil {
+		return nil, fmt.Errorf("Invalid relay configuration: %w", err)
+	}
+	if err := domain.ValidatePeers(conf.Federation.Peers, conf.Lobby); err != nil {
+		return nil, fmt.Errorf("Invalid federation configuration: %w", err)
+	}
+	if err := domain.ValidateWebhooks(conf.Webhooks); err != nil {
+		return nil, fmt.Errorf("Invalid webhook configuration: %w", err)
+	}
 	return &conf, nil
 }
 
@@ -109,18 +287,91 @@ func initDatabase(databaseType string, connectionString string) (*gorm.DB, error
 	return nil, fmt.Errorf("Unknown database type in configuration: %s", databaseType)
 }
 
-func initDomain(db *gorm.DB, config *Config) (*domain.SessionDomain, error) {
-	repo := repository.NewSessionRepository(db)
-	geo2Domain, err := domain.NewGeoIP2Domain(config.Server.GeoLite2Path)
+// repositories holds the repositories of the configured database type.
+type repositories struct {
+	db      *gorm.DB // nil for the memory type
+	session domain.SessionRepository
+	ban     domain.BanRepository
+	history domain.HistoryRepository
+	lease   domain.LeaseRepository
+	webhook domain.WebhookRepository
+}
+
+// initRepositories creates the repositories for the configured database type.
+func initRepositories(databaseType string, connectionString string, metricsDomain *domain.MetricsDomain) (*repositories, error) {
+	if databaseType == "memory" {
+		historyRepo := repository.NewMemoryHistoryRepository()
+		sessionRepo := repository.NewMemorySessionRepository()
+		sessionRepo.SetQueryObserver(metricsDomain.ObserveQuery)
+		sessionRepo.SetHistoryRepository(historyRepo)
+		return &repositories{
+			session: sessionRepo,
+			ban:     repository.NewMemoryBanRepository(),
+			history: historyRepo,
+			lease:   repository.NewMemoryLeaseRepository(),
+			webhook: repository.NewMemoryWebhookRepository(),
+		}, nil
+	}
+
+	db, err := initDatabase(databaseType, connectionString)
+	if err != nil {
+		return nil, err
+	}
+	db = db.AutoMigrate(&entity.Session{}, &entity.Ban{}, &entity.SessionHistory{}, &entity.Lease{}, &entity.WebhookDelivery{})
+
+	sessionRepo := repository.NewSessionRepository(db)
+	sessionRepo.SetQueryObserver(metricsDomain.ObserveQuery)
+	return &repositories{
+		db:      db,
+		session: sessionRepo,
+		ban:     repository.NewBanRepository(db),
+		history: repository.NewHistoryRepository(db),
+		lease:   repository.NewLeaseRepository(db),
+		webhook: repository.NewWebhookRepository(db),
+	}, nil
+}
+
+func initDomain(
+	sessionRepo domain.SessionRepository,
+	config *Config,
+	geoIP2Domain *domain.GeoIP2Domain,
+	validationDomain *domain.ValidationDomain,
+	metricsDomain *domain.MetricsDomain,
+	statsDomain *domain.StatsDomain,
+	webhookDomain *domain.WebhookDomain,
+	logger domain.Logger) (*domain.SessionDomain, *domain.ProbeDomain, error) {
+	mitmDomain := domain.NewMitmDomain(config.RelayConfigs(), sessionRepo, geoIP2Domain, config.Lobby, logger)
+	eventDomain := domain.NewEventDomain(domain.EventBufferSize)
+	probeDomain := domain.NewProbeDomain(sessionRepo, eventDomain, metricsDomain, config.Lobby, logger)
+	privacyDomain, err := domain.NewPrivacyDomain(config.Lobby)
 	if err != nil {
-		return nil, fmt.Errorf("Can't intialize geolite2 database: %w", err)
+		return nil, nil, err
 	}
-	validationDomain, err := domain.NewValidationDomain(config.Blacklist.Strings, config.Blacklist.IPs)
+	customRelayDomain := domain.NewCustomRelayDomain(validationDomain, config.Lobby)
+	coreInfoDomain, err := domain.NewCoreInfoDomain(config.Cores.InfoPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't load core info files: %w", err)
+	}
+	// The systems of the .info files are extended by the configured ones
+	coreSystems := coreInfoDomain.CoreSystems()
+	for core, systems := range config.Games.CoreSystems {
+		coreSystems[core] = append(coreSystems[core], systems...)
+	}
+	gameDatabaseDomain, err := domain.NewGameDatabaseDomain(config.Games.DatPath, coreSystems)
 	if err != nil {
-		return nil, fmt.Errorf("Can't intialize validation domain: %w", err)
+		return nil, nil, fmt.Errorf("can't load game database: %w", err)
 	}
-	mitmDomain := domain.NewMitmDomain(config.Relay)
-	sessionDomain := domain.NewSessionDomain(repo, geo2Domain, validationDomain, mitmDomain)
+	sessionDomain := domain.NewSessionDomain(sessionRepo, geoIP2Domain, validationDomain, metricsDomain, config.Lobby, domain.SessionDomainOptions{
+		Mitm:         mitmDomain,
+		Events:       eventDomain,
+		Probe:        probeDomain,
+		Stats:        statsDomain,
+		Privacy:      privacyDomain,
+		CustomRelay:  customRelayDomain,
+		GameDatabase: gameDatabaseDomain,
+		CoreInfo:     coreInfoDomain,
+		Webhooks:     webhookDomain,
+	})
 
-	return sessionDomain, nil
+	return sessionDomain, probeDomain, nil
 }
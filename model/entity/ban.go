@@ -0,0 +1,23 @@
+package entity
+
+import (
+	"time"
+)
+
+// BanType is the enum for the type of a ban.
+type BanType string
+
+// The enum values for BanType.
+const (
+	BanTypeIP     BanType = "ip"
+	BanTypeString BanType = "string"
+)
+
+// Ban is the database presentation of a runtime ban issued by an operator.
+type Ban struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	Type      BanType   `json:"type" gorm:"size:16;not null"`
+	Pattern   string    `json:"pattern" gorm:"not null"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created"`
+}
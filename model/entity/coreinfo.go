@@ -0,0 +1,19 @@
+package entity
+
+// The savestate support levels of a core, from none to fully deterministic.
+const (
+	SavestatesNone          = "none"
+	SavestatesBasic         = "basic"
+	SavestatesSerialized    = "serialized"
+	SavestatesDeterministic = "deterministic"
+)
+
+// CoreInfo is the metadata of a libretro core from its .info file.
+type CoreInfo struct {
+	DisplayName   string
+	SystemName    string
+	Databases     []string // Systems as named by the libretro-database, like "Nintendo - Nintendo Entertainment System"
+	Savestates    string   // Savestate support level
+	Deterministic bool     // Whether savestates are the same on every machine
+	Netplay       bool     // Whether RetroArch allows netplay with the core, which needs deterministic savestates
+}
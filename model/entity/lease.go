@@ -0,0 +1,12 @@
+package entity
+
+import (
+	"time"
+)
+
+// Lease is the database presentation of a lease that elects a single lobby replica for a job.
+type Lease struct {
+	Name      string    `gorm:"primary_key;size:64"`
+	Holder    string    `gorm:"size:64;not null"` // Random ID of the replica holding the lease
+	ExpiresAt time.Time `gorm:"not null"`
+}
@@ -22,17 +22,35 @@ const (
 	HostMethodMITM    = 3
 )
 
+// String returns the name of the host method.
+func (m HostMethod) String() string {
+	switch m {
+	case HostMethodManual:
+		return "manual"
+	case HostMethodUPNP:
+		return "upnp"
+	case HostMethodMITM:
+		return "mitm"
+	}
+	return "unknown"
+}
+
 // Session is the database presentation of a netplay session.
 type Session struct {
-	ID                  string     `json:"-" gorm:"primary_key;size:64"`
+	ID                  string     `json:"-" gorm:"primary_key;size:64;unique_index"` // Unique on sqlite as well, where the RoomID becomes the primary key
 	ContentHash         string     `json:"-" gorm:"size:64"`
 	RoomID              int32      `json:"id" gorm:"AUTO_INCREMENT;unique_index"`
 	Username            string     `json:"username"`
 	Country             string     `json:"country" gorm:"size:2"`
 	GameName            string     `json:"game_name"`
 	GameCRC             string     `json:"game_crc"`
+	GameTitle           string     `json:"game_title,omitempty"`  // Canonical title from the game database
+	GameSystem          string     `json:"game_system,omitempty"` // System of the game from the game database
+	GameRegion          string     `json:"game_region,omitempty"` // Region of the game from the game database
+	GameStatus          string     `json:"game_status,omitempty"` // Result of the game identification, see GameDatabaseDomain
 	CoreName            string     `json:"core_name"`
 	CoreVersion         string     `json:"core_version"`
+	Core                *CoreInfo  `json:"-" gorm:"-"` // Metadata of the core, only set if its .info file is known
 	SubsystemName       string     `json:"subsystem_name"`
 	RetroArchVersion    string     `json:"retroarch_version"`
 	Frontend            string     `json:"frontend"`
@@ -47,8 +65,18 @@ type Session struct {
 	HasSpectatePassword bool       `json:"has_spectate_password"`
 	Connectable         bool       `json:"connectable"`
 	IsRetroArch         bool       `json:"is_retroarch"`
+	ProtocolVersion     uint32     `json:"protocol_version,omitempty"`  // Highest netplay protocol version the host advertised
+	RequiresPassword    bool       `json:"requires_password,omitempty"` // Whether the host asked for a password in its handshake
+	ProbeMismatch       string     `json:"probe_mismatch,omitempty"`    // Claims of the host that don't match its handshake
 	PlayerCount         int16      `json:"player_count"`
 	SpectatorCount      int16      `json:"spectator_count"`
+	PeakPlayerCount     int16      `json:"-"`
+	PeakSpectatorCount  int16      `json:"-"`
+	JoinTicket          string     `json:"join_ticket,omitempty" gorm:"-"`                   // Resolves the hidden host IP, see PrivacyDomain
+	Token               string     `json:"-" gorm:"-"`                                       // Plain room token, only known right after the creation
+	TokenHash           string     `json:"-" gorm:"size:64"`                                 // SHA-256 of the room token
+	TokenRequired       bool       `json:"-"`                                                // Whether the host used its room token, so updates require it
+	Origin              string     `json:"origin,omitempty" gorm:"size:64;index;default:''"` // Peer lobby of a mirrored session, empty for local ones
 	CreatedAt           time.Time  `json:"created"`
 	UpdatedAt           time.Time  `json:"updated" gorm:"index"`
 }
@@ -67,6 +95,22 @@ func (s *Session) CalculateID() {
 	s.ID = hex.EncodeToString(hash)
 }
 
+// CalculateOriginID creates a 32 byte SHAKE256 (SHA3) hash of the origin and the RoomID a mirrored session has
+// at its origin for the db to use as PK. It can't collide with the IDs of the local sessions.
+func (s *Session) CalculateOriginID(originRoomID int32) {
+	hash := make([]byte, 32)
+	shake := sha3.NewShake256()
+
+	shake.Write([]byte("origin:"))
+	shake.Write([]byte(s.Origin))
+	shake.Write([]byte("/"))
+	shake.Write([]byte(strconv.FormatInt(int64(originRoomID), 10)))
+
+	shake.Read(hash)
+
+	s.ID = hex.EncodeToString(hash)
+}
+
 // CalculateContentHash creates a 32 byte SHAKE256 (SHA3) hash of the session content.
 func (s *Session) CalculateContentHash() {
 	hash := make([]byte, 32)
@@ -131,5 +175,9 @@ func (s *Session) PrintForRetroarch() string {
 		connectable,
 	)
 
+	if s.Token != "" {
+		str += fmt.Sprintf("room_token=%s\n", s.Token)
+	}
+
 	return str
 }
@@ -119,3 +119,11 @@ func TestSessionHostMethodChangesContentHash(t *testing.T) {
 
 	assert.NotEqual(t, oldHash, newHash)
 }
+
+func TestHostMethodString(t *testing.T) {
+	assert.Equal(t, "unknown", HostMethod(HostMethodUnknown).String())
+	assert.Equal(t, "manual", HostMethod(HostMethodManual).String())
+	assert.Equal(t, "upnp", HostMethod(HostMethodUPNP).String())
+	assert.Equal(t, "mitm", HostMethod(HostMethodMITM).String())
+	assert.Equal(t, "unknown", HostMethod(42).String())
+}
@@ -0,0 +1,47 @@
+package entity
+
+// SessionSortField is the enum for the fields sessions can be sorted by.
+type SessionSortField string
+
+// The enum values for SessionSortField.
+const (
+	SortByRoomID      SessionSortField = "id"
+	SortByUsername    SessionSortField = "username"
+	SortByGameName    SessionSortField = "game_name"
+	SortByCoreName    SessionSortField = "core_name"
+	SortByCountry     SessionSortField = "country"
+	SortByPlayerCount SessionSortField = "player_count"
+	SortByCreatedAt   SessionSortField = "created"
+	SortByUpdatedAt   SessionSortField = "updated"
+)
+
+// IsValid returns true if the value is a known sort field.
+func (f SessionSortField) IsValid() bool {
+	switch f {
+	case SortByRoomID, SortByUsername, SortByGameName, SortByCoreName,
+		SortByCountry, SortByPlayerCount, SortByCreatedAt, SortByUpdatedAt:
+		return true
+	}
+	return false
+}
+
+// SessionSort is a single sort key of a SessionFilter.
+type SessionSort struct {
+	Field      SessionSortField
+	Descending bool
+}
+
+// SessionFilter describes a filtered, sorted and paginated session query. Zero values disable the respective filter.
+type SessionFilter struct {
+	CoreName               string
+	GameCRC                string
+	Country                string
+	HostMethod             *HostMethod
+	HasPassword            *bool
+	Connectable            *bool
+	RetroArchVersionPrefix string
+	Search                 string // Substring of the username or game name
+	Sort                   []SessionSort
+	Limit                  int
+	Offset                 int
+}
@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"time"
+)
+
+// SessionHistory is the archived record of an expired session.
+type SessionHistory struct {
+	ID             uint       `json:"id" gorm:"primary_key"`
+	RoomID         int32      `json:"room_id"`
+	Username       string     `json:"username"`
+	GameName       string     `json:"game_name"`
+	GameCRC        string     `json:"game_crc"`
+	CoreName       string     `json:"core_name"`
+	CoreVersion    string     `json:"core_version"`
+	Country        string     `json:"country" gorm:"size:2"`
+	HostMethod     HostMethod `json:"host_method"`
+	PeakPlayers    int16      `json:"peak_players"`
+	PeakSpectators int16      `json:"peak_spectators"`
+	StartedAt      time.Time  `json:"started" gorm:"index"`
+	EndedAt        time.Time  `json:"ended" gorm:"index"`
+}
+
+// TableName sets the table name of the history.
+func (SessionHistory) TableName() string {
+	return "session_history"
+}
+
+// NewSessionHistory creates the history record of a session. The session ends with its last update.
+func NewSessionHistory(s *Session) SessionHistory {
+	return SessionHistory{
+		RoomID:         s.RoomID,
+		Username:       s.Username,
+		GameName:       s.GameName,
+		GameCRC:        s.GameCRC,
+		CoreName:       s.CoreName,
+		CoreVersion:    s.CoreVersion,
+		Country:        s.Country,
+		HostMethod:     s.HostMethod,
+		PeakPlayers:    s.PeakPlayerCount,
+		PeakSpectators: s.PeakSpectatorCount,
+		StartedAt:      s.CreatedAt,
+		EndedAt:        s.UpdatedAt,
+	}
+}
+
+// Duration returns how long the session was hosted.
+func (h *SessionHistory) Duration() time.Duration {
+	return h.EndedAt.Sub(h.StartedAt)
+}
@@ -0,0 +1,16 @@
+package entity
+
+import (
+	"time"
+)
+
+// WebhookDelivery is the database presentation of a queued webhook notification.
+type WebhookDelivery struct {
+	ID          uint      `gorm:"primary_key"`
+	Hook        string    `gorm:"size:64;not null"`   // Name of the configured webhook
+	Event       string    `gorm:"size:16;not null"`   // Type of the session event
+	Payload     string    `gorm:"type:text;not null"` // JSON body, signed on every attempt
+	Attempts    int       `gorm:"not null"`           // Failed delivery attempts so far
+	NextAttempt time.Time `gorm:"index;not null"`
+	CreatedAt   time.Time
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// BanRepository abstracts the database operation for Bans.
+type BanRepository struct {
+	db *gorm.DB
+}
+
+// NewBanRepository returns a new BanRepository.
+func NewBanRepository(db *gorm.DB) *BanRepository {
+	return &BanRepository{db}
+}
+
+// GetAll returns all bans ordered by creation.
+func (r *BanRepository) GetAll() ([]entity.Ban, error) {
+	var b []entity.Ban
+	if err := r.db.Order("id").Find(&b).Error; err != nil {
+		return nil, fmt.Errorf("can't query for all bans: %w", err)
+	}
+
+	return b, nil
+}
+
+// Create creates a new ban.
+func (r *BanRepository) Create(b *entity.Ban) error {
+	if err := r.db.Create(b).Error; err != nil {
+		return fmt.Errorf("can't create ban %v: %w", b, err)
+	}
+
+	return nil
+}
+
+// Delete deletes the ban with the given ID.
+func (r *BanRepository) Delete(id uint) error {
+	if err := r.db.Where("id = ?", id).Delete(entity.Ban{}).Error; err != nil {
+		return fmt.Errorf("can't delete ban with ID %d: %w", id, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/libretro/netplay-lobby-server-go/model"
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// testedBanRepository is implemented by every ban repository the test suite runs against.
+type testedBanRepository interface {
+	Create(b *entity.Ban) error
+	GetAll() ([]entity.Ban, error)
+	Delete(id uint) error
+}
+
+// banRepositories are the setups of all ban repository implementations.
+var banRepositories = []struct {
+	name  string
+	setup func(t *testing.T) testedBanRepository
+}{
+	{"gorm", setupBanRepository},
+	{"memory", func(t *testing.T) testedBanRepository { return NewMemoryBanRepository() }},
+}
+
+func setupBanRepository(t *testing.T) testedBanRepository {
+	db, err := model.GetSqliteDB(":memory:")
+	if err != nil {
+		t.Fatalf("Can't open sqlite3 db: %v", err)
+	}
+	db.AutoMigrate(entity.Ban{})
+
+	return NewBanRepository(db)
+}
+
+// testBanRepositories runs the test against every ban repository implementation.
+func testBanRepositories(t *testing.T, test func(t *testing.T, banRepository testedBanRepository)) {
+	for _, r := range banRepositories {
+		setup := r.setup
+		t.Run(r.name, func(t *testing.T) {
+			test(t, setup(t))
+		})
+	}
+}
+
+func TestBanRepositoryCreateAndGetAll(t *testing.T) {
+	testBanRepositories(t, func(t *testing.T, banRepository testedBanRepository) {
+
+		ipBan := entity.Ban{Type: entity.BanTypeIP, Pattern: "10.0.0.0/8", Reason: "griefing"}
+		err := banRepository.Create(&ipBan)
+		require.NoError(t, err, "Can't create ban")
+		assert.NotZero(t, ipBan.ID)
+
+		stringBan := entity.Ban{Type: entity.BanTypeString, Pattern: "^troll.*"}
+		err = banRepository.Create(&stringBan)
+		require.NoError(t, err, "Can't create ban")
+
+		bans, err := banRepository.GetAll()
+		require.NoError(t, err, "Can't get all bans")
+		require.Equal(t, 2, len(bans))
+		assert.Equal(t, entity.BanTypeIP, bans[0].Type)
+		assert.Equal(t, "10.0.0.0/8", bans[0].Pattern)
+		assert.Equal(t, "griefing", bans[0].Reason)
+		assert.Equal(t, entity.BanTypeString, bans[1].Type)
+	})
+}
+
+func TestBanRepositoryDelete(t *testing.T) {
+	testBanRepositories(t, func(t *testing.T, banRepository testedBanRepository) {
+
+		ban := entity.Ban{Type: entity.BanTypeIP, Pattern: "1.1.1.1"}
+		err := banRepository.Create(&ban)
+		require.NoError(t, err, "Can't create ban")
+
+		err = banRepository.Delete(ban.ID)
+		require.NoError(t, err, "Can't delete ban")
+
+		bans, err := banRepository.GetAll()
+		require.NoError(t, err, "Can't get all bans")
+		assert.Equal(t, 0, len(bans))
+	})
+}
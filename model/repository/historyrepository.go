@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// HistoryRepository abstracts the database operation for the session history.
+type HistoryRepository struct {
+	db *gorm.DB
+}
+
+// NewHistoryRepository returns a new HistoryRepository.
+func NewHistoryRepository(db *gorm.DB) *HistoryRepository {
+	return &HistoryRepository{db}
+}
+
+// Archive stores the history records in a single transaction.
+func (r *HistoryRepository) Archive(history []entity.SessionHistory) error {
+	tx := r.db.Begin()
+	if err := tx.Error; err != nil {
+		return fmt.Errorf("can't begin history transaction: %w", err)
+	}
+
+	for i := range history {
+		if err := tx.Create(&history[i]).Error; err != nil {
+			tx.Rollback()
+			return fmt.Errorf("can't archive session %d: %w", history[i].RoomID, err)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("can't commit history transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetBetween returns all history records of sessions that were hosted between from and to, ordered by start.
+func (r *HistoryRepository) GetBetween(from time.Time, to time.Time) ([]entity.SessionHistory, error) {
+	var h []entity.SessionHistory
+	if err := r.db.Where("ended_at >= ? AND started_at < ?", from, to).Order("started_at").Order("id").Find(&h).Error; err != nil {
+		return nil, fmt.Errorf("can't query history between %s and %s: %w", from, to, err)
+	}
+
+	return h, nil
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/libretro/netplay-lobby-server-go/model"
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// testedHistoryRepository is implemented by every history repository the test suite runs against.
+type testedHistoryRepository interface {
+	Archive(history []entity.SessionHistory) error
+	GetBetween(from time.Time, to time.Time) ([]entity.SessionHistory, error)
+}
+
+// historyRepositories are the setups of all history repository implementations.
+var historyRepositories = []struct {
+	name  string
+	setup func(t *testing.T) testedHistoryRepository
+}{
+	{"gorm", setupHistoryRepository},
+	{"memory", func(t *testing.T) testedHistoryRepository { return NewMemoryHistoryRepository() }},
+}
+
+func setupHistoryRepository(t *testing.T) testedHistoryRepository {
+	db, err := model.GetSqliteDB(":memory:")
+	if err != nil {
+		t.Fatalf("Can't open sqlite3 db: %v", err)
+	}
+	db.AutoMigrate(entity.SessionHistory{})
+
+	return NewHistoryRepository(db)
+}
+
+// testHistoryRepositories runs the test against every history repository implementation.
+func testHistoryRepositories(t *testing.T, test func(t *testing.T, historyRepository testedHistoryRepository)) {
+	for _, r := range historyRepositories {
+		setup := r.setup
+		t.Run(r.name, func(t *testing.T) {
+			test(t, setup(t))
+		})
+	}
+}
+
+func TestHistoryRepositoryArchiveAndGetBetween(t *testing.T) {
+	testHistoryRepositories(t, func(t *testing.T, historyRepository testedHistoryRepository) {
+		now := time.Now()
+		session := testSession
+		session.RoomID = 10
+		session.PeakPlayerCount = 4
+		session.CreatedAt = now.Add(-3 * time.Hour)
+		session.UpdatedAt = now.Add(-2 * time.Hour)
+		old := entity.NewSessionHistory(&session)
+
+		session.RoomID = 11
+		session.CreatedAt = now.Add(-90 * time.Minute)
+		session.UpdatedAt = now.Add(-30 * time.Minute)
+		recent := entity.NewSessionHistory(&session)
+
+		err := historyRepository.Archive([]entity.SessionHistory{recent, old})
+		require.NoError(t, err, "Can't archive sessions")
+
+		history, err := historyRepository.GetBetween(now.Add(-4*time.Hour), now)
+		require.NoError(t, err, "Can't get history")
+		require.Equal(t, 2, len(history))
+		assert.Equal(t, int32(10), history[0].RoomID, "History is not ordered by start")
+		assert.Equal(t, int16(4), history[0].PeakPlayers)
+		assert.Equal(t, "unes", history[0].CoreName)
+		assert.Equal(t, time.Hour, history[0].Duration())
+		assert.NotZero(t, history[0].ID)
+
+		// Sessions that overlap the start of the range are included
+		history, err = historyRepository.GetBetween(now.Add(-time.Hour), now)
+		require.NoError(t, err, "Can't get history")
+		require.Equal(t, 1, len(history))
+		assert.Equal(t, int32(11), history[0].RoomID)
+	})
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// LeaseRepository abstracts the database operation for Leases. The leases are shared by all replicas using the
+// same database.
+type LeaseRepository struct {
+	db *gorm.DB
+}
+
+// NewLeaseRepository returns a new LeaseRepository.
+func NewLeaseRepository(db *gorm.DB) *LeaseRepository {
+	return &LeaseRepository{db}
+}
+
+// Acquire renews the lease with the given name if the holder holds it or takes it over if it is free or expired.
+// Returns false if another holder holds the lease.
+func (r *LeaseRepository) Acquire(name string, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	lease := entity.Lease{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)}
+
+	result := r.db.Model(&entity.Lease{}).
+		Where("name = ? AND (holder = ? OR expires_at < ?)", name, holder, now).
+		Updates(map[string]interface{}{"holder": holder, "expires_at": lease.ExpiresAt})
+	if result.Error != nil {
+		return false, fmt.Errorf("can't renew lease %s: %w", name, result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	// MySQL doesn't count renewals without changes as affected rows, so the own lease can be found as well
+	var current entity.Lease
+	if err := r.db.Where("name = ?", name).First(&current).Error; err == nil {
+		return current.Holder == holder, nil
+	} else if !gorm.IsRecordNotFoundError(err) {
+		return false, fmt.Errorf("can't query lease %s: %w", name, err)
+	}
+
+	// Of concurrent creations only one passes the primary key, the others find the lease of the winner
+	if err := r.db.Create(&lease).Error; err != nil {
+		if r.db.Where("name = ?", name).First(&current).Error != nil {
+			return false, fmt.Errorf("can't create lease %s: %w", name, err)
+		}
+		return current.Holder == holder, nil
+	}
+
+	return true, nil
+}
+
+// Release gives up the lease with the given name if the holder holds it.
+func (r *LeaseRepository) Release(name string, holder string) error {
+	if err := r.db.Where("name = ? AND holder = ?", name, holder).Delete(entity.Lease{}).Error; err != nil {
+		return fmt.Errorf("can't release lease %s: %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/libretro/netplay-lobby-server-go/model"
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// testedLeaseRepository is implemented by every lease repository the test suite runs against.
+type testedLeaseRepository interface {
+	Acquire(name string, holder string, ttl time.Duration) (bool, error)
+	Release(name string, holder string) error
+}
+
+// leaseRepositories are the setups of all lease repository implementations.
+var leaseRepositories = []struct {
+	name  string
+	setup func(t *testing.T) testedLeaseRepository
+}{
+	{"gorm", setupLeaseRepository},
+	{"memory", func(t *testing.T) testedLeaseRepository { return NewMemoryLeaseRepository() }},
+}
+
+func setupLeaseRepository(t *testing.T) testedLeaseRepository {
+	db, err := model.GetSqliteDB(":memory:")
+	if err != nil {
+		t.Fatalf("Can't open sqlite3 db: %v", err)
+	}
+	db.AutoMigrate(entity.Lease{})
+
+	return NewLeaseRepository(db)
+}
+
+// testLeaseRepositories runs the test against every lease repository implementation.
+func testLeaseRepositories(t *testing.T, test func(t *testing.T, leaseRepository testedLeaseRepository)) {
+	for _, r := range leaseRepositories {
+		setup := r.setup
+		t.Run(r.name, func(t *testing.T) {
+			test(t, setup(t))
+		})
+	}
+}
+
+func TestLeaseRepositoryAcquire(t *testing.T) {
+	testLeaseRepositories(t, func(t *testing.T, leaseRepository testedLeaseRepository) {
+		acquired, err := leaseRepository.Acquire("purge", "a", time.Minute)
+		require.NoError(t, err, "Can't acquire lease")
+		assert.True(t, acquired)
+
+		acquired, err = leaseRepository.Acquire("purge", "b", time.Minute)
+		require.NoError(t, err, "Can't acquire lease")
+		assert.False(t, acquired, "Lease was taken over before it expired")
+
+		acquired, err = leaseRepository.Acquire("purge", "a", time.Minute)
+		require.NoError(t, err, "Can't renew lease")
+		assert.True(t, acquired)
+
+		acquired, err = leaseRepository.Acquire("federation", "b", time.Minute)
+		require.NoError(t, err, "Can't acquire lease")
+		assert.True(t, acquired, "Leases with different names block each other")
+	})
+}
+
+func TestLeaseRepositoryExpiry(t *testing.T) {
+	testLeaseRepositories(t, func(t *testing.T, leaseRepository testedLeaseRepository) {
+		acquired, err := leaseRepository.Acquire("purge", "a", -time.Second)
+		require.NoError(t, err, "Can't acquire lease")
+		assert.True(t, acquired)
+
+		acquired, err = leaseRepository.Acquire("purge", "b", time.Minute)
+		require.NoError(t, err, "Can't take over expired lease")
+		assert.True(t, acquired)
+
+		acquired, err = leaseRepository.Acquire("purge", "a", time.Minute)
+		require.NoError(t, err, "Can't acquire lease")
+		assert.False(t, acquired)
+	})
+}
+
+func TestLeaseRepositoryRelease(t *testing.T) {
+	testLeaseRepositories(t, func(t *testing.T, leaseRepository testedLeaseRepository) {
+		acquired, err := leaseRepository.Acquire("purge", "a", time.Minute)
+		require.NoError(t, err, "Can't acquire lease")
+		require.True(t, acquired)
+
+		require.NoError(t, leaseRepository.Release("purge", "b"), "Can't release lease")
+		acquired, err = leaseRepository.Acquire("purge", "b", time.Minute)
+		require.NoError(t, err, "Can't acquire lease")
+		assert.False(t, acquired, "Lease was released by another holder")
+
+		require.NoError(t, leaseRepository.Release("purge", "a"), "Can't release lease")
+		acquired, err = leaseRepository.Acquire("purge", "b", time.Minute)
+		require.NoError(t, err, "Can't acquire lease")
+		assert.True(t, acquired)
+	})
+}
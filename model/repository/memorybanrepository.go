@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// MemoryBanRepository is an in-memory ban store for lobbies without a database. Bans are lost on restart.
+type MemoryBanRepository struct {
+	mutex  sync.Mutex
+	bans   []entity.Ban
+	nextID uint
+}
+
+// NewMemoryBanRepository returns a new, empty MemoryBanRepository.
+func NewMemoryBanRepository() *MemoryBanRepository {
+	return &MemoryBanRepository{nextID: 1}
+}
+
+// GetAll returns all bans ordered by creation.
+func (r *MemoryBanRepository) GetAll() ([]entity.Ban, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]entity.Ban{}, r.bans...), nil
+}
+
+// Create creates a new ban.
+func (r *MemoryBanRepository) Create(b *entity.Ban) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	b.ID = r.nextID
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now()
+	}
+	r.nextID++
+	r.bans = append(r.bans, *b)
+
+	return nil
+}
+
+// Delete deletes the ban with the given ID.
+func (r *MemoryBanRepository) Delete(id uint) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, b := range r.bans {
+		if b.ID == id {
+			r.bans = append(r.bans[:i], r.bans[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// MemoryHistoryRepository is an in-memory session history for lobbies without a database. The history is lost on restart.
+type MemoryHistoryRepository struct {
+	mutex   sync.RWMutex
+	history []entity.SessionHistory
+	nextID  uint
+}
+
+// NewMemoryHistoryRepository returns a new, empty MemoryHistoryRepository.
+func NewMemoryHistoryRepository() *MemoryHistoryRepository {
+	return &MemoryHistoryRepository{nextID: 1}
+}
+
+// Archive stores the history records.
+func (r *MemoryHistoryRepository) Archive(history []entity.SessionHistory) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i := range history {
+		history[i].ID = r.nextID
+		history[i].StartedAt = history[i].StartedAt.Round(0)
+		history[i].EndedAt = history[i].EndedAt.Round(0)
+		r.nextID++
+		r.history = append(r.history, history[i])
+	}
+
+	return nil
+}
+
+// GetBetween returns all history records of sessions that were hosted between from and to, ordered by start.
+func (r *MemoryHistoryRepository) GetBetween(from time.Time, to time.Time) ([]entity.SessionHistory, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	h := make([]entity.SessionHistory, 0)
+	for _, entry := range r.history {
+		if !entry.EndedAt.Before(from) && entry.StartedAt.Before(to) {
+			h = append(h, entry)
+		}
+	}
+	sort.SliceStable(h, func(i, j int) bool { return h[i].StartedAt.Before(h[j].StartedAt) })
+
+	return h, nil
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// MemoryLeaseRepository is an in-memory lease store for lobbies without a database. It only elects between
+// the holders of a single process.
+type MemoryLeaseRepository struct {
+	mutex  sync.Mutex
+	leases map[string]entity.Lease
+}
+
+// NewMemoryLeaseRepository returns a new, empty MemoryLeaseRepository.
+func NewMemoryLeaseRepository() *MemoryLeaseRepository {
+	return &MemoryLeaseRepository{leases: make(map[string]entity.Lease)}
+}
+
+// Acquire renews the lease with the given name if the holder holds it or takes it over if it is free or expired.
+// Returns false if another holder holds the lease.
+func (r *MemoryLeaseRepository) Acquire(name string, holder string, ttl time.Duration) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	if lease, found := r.leases[name]; found && lease.Holder != holder && !lease.ExpiresAt.Before(now) {
+		return false, nil
+	}
+	r.leases[name] = entity.Lease{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)}
+
+	return true, nil
+}
+
+// Release gives up the lease with the given name if the holder holds it.
+func (r *MemoryLeaseRepository) Release(name string, holder string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if lease, found := r.leases[name]; found && lease.Holder == holder {
+		delete(r.leases, name)
+	}
+
+	return nil
+}
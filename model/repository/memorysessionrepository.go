@@ -0,0 +1,522 @@
+package repository
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// sessionComparator compares two sessions by a single sort field.
+type sessionComparator func(a *entity.Session, b *entity.Session) int
+
+// sortComparators maps the sort fields to their comparators.
+var sortComparators = map[entity.SessionSortField]sessionComparator{
+	entity.SortByRoomID:      func(a, b *entity.Session) int { return compareInt(int64(a.RoomID), int64(b.RoomID)) },
+	entity.SortByUsername:    func(a, b *entity.Session) int { return strings.Compare(a.Username, b.Username) },
+	entity.SortByGameName:    func(a, b *entity.Session) int { return strings.Compare(a.GameName, b.GameName) },
+	entity.SortByCoreName:    func(a, b *entity.Session) int { return strings.Compare(a.CoreName, b.CoreName) },
+	entity.SortByCountry:     func(a, b *entity.Session) int { return strings.Compare(a.Country, b.Country) },
+	entity.SortByPlayerCount: func(a, b *entity.Session) int { return compareInt(int64(a.PlayerCount), int64(b.PlayerCount)) },
+	entity.SortByCreatedAt:   func(a, b *entity.Session) int { return compareTime(a.CreatedAt, b.CreatedAt) },
+	entity.SortByUpdatedAt:   func(a, b *entity.Session) int { return compareTime(a.UpdatedAt, b.UpdatedAt) },
+}
+
+// MemorySessionRepository is a concurrent in-memory session store for lobbies without a database.
+// Sessions are indexed by ID and RoomID and local sessions are kept in a min-heap ordered by UpdatedAt for the expiry.
+type MemorySessionRepository struct {
+	mutex         sync.RWMutex
+	byID          map[string]*memorySession
+	byRoomID      map[int32]*memorySession
+	expiry        expiryQueue
+	nextRoomID    int32
+	history       *MemoryHistoryRepository
+	queryObserver QueryObserver
+}
+
+// memorySession is a stored session together with its position in the expiry queue, -1 for mirrored sessions.
+type memorySession struct {
+	session entity.Session
+	index   int
+}
+
+// NewMemorySessionRepository returns a new, empty MemorySessionRepository.
+func NewMemorySessionRepository() *MemorySessionRepository {
+	return &MemorySessionRepository{
+		byID:       make(map[string]*memorySession),
+		byRoomID:   make(map[int32]*memorySession),
+		nextRoomID: 1,
+	}
+}
+
+// SetQueryObserver sets an observer that records the query durations.
+func (r *MemorySessionRepository) SetQueryObserver(observer QueryObserver) {
+	r.queryObserver = observer
+}
+
+// SetHistoryRepository sets the history the purged sessions are archived to.
+func (r *MemorySessionRepository) SetHistoryRepository(history *MemoryHistoryRepository) {
+	r.history = history
+}
+
+// GetAll returns all sessions currently beeing hosted. Deadline is used to filter our old sessions. Deadline of zero value deactivates this filter.
+func (r *MemorySessionRepository) GetAll(deadline time.Time) ([]entity.Session, error) {
+	defer r.observe("get_all", time.Now())
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	s := r.filter(func(s *entity.Session) bool { return isAlive(s, deadline) })
+	sortSessions(s, nil)
+
+	return s, nil
+}
+
+// GetOld returns all local sessions older than the given timestamp. Mirrored sessions expire with their origin.
+func (r *MemorySessionRepository) GetOld(deadline time.Time) ([]entity.Session, error) {
+	defer r.observe("get_old", time.Now())
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	s := make([]entity.Session, 0)
+	r.expiry.walkBefore(0, deadline, func(m *memorySession) {
+		s = append(s, m.session)
+	})
+	sort.SliceStable(s, func(i, j int) bool { return s[i].Username < s[j].Username })
+
+	return s, nil
+}
+
+// Find returns all sessions currently beeing hosted that match the given filter together with the total count of
+// matching sessions before pagination. Deadline is used to filter our old sessions. Deadline of zero value deactivates this filter.
+func (r *MemorySessionRepository) Find(deadline time.Time, filter *entity.SessionFilter) ([]entity.Session, int, error) {
+	defer r.observe("find", time.Now())
+
+	for _, sort := range filter.Sort {
+		if _, found := sortComparators[sort.Field]; !found {
+			return nil, 0, fmt.Errorf("unknown sort field '%s'", sort.Field)
+		}
+	}
+
+	r.mutex.RLock()
+	s := r.filter(func(s *entity.Session) bool { return isAlive(s, deadline) && matchesFilter(s, filter) })
+	r.mutex.RUnlock()
+
+	sortSessions(s, filter.Sort)
+
+	count := len(s)
+	if filter.Offset > 0 {
+		if filter.Offset >= len(s) {
+			s = s[:0]
+		} else {
+			s = s[filter.Offset:]
+		}
+	}
+	if filter.Limit > 0 && filter.Limit < len(s) {
+		s = s[:filter.Limit]
+	}
+
+	return s, count, nil
+}
+
+// CountByIP returns the amount of local sessions currently beeing hosted from the given IP.
+func (r *MemorySessionRepository) CountByIP(ip net.IP, deadline time.Time) (int, error) {
+	defer r.observe("count_by_ip", time.Now())
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	count := 0
+	for _, m := range r.byID {
+		if m.session.Origin == "" && m.session.IP.Equal(ip) && m.session.UpdatedAt.After(deadline) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// CountByMitmHandle returns the amount of local relayed sessions currently beeing hosted per relay handle.
+func (r *MemorySessionRepository) CountByMitmHandle(deadline time.Time) (map[string]int, error) {
+	defer r.observe("count_by_mitm_handle", time.Now())
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	counts := make(map[string]int)
+	for _, m := range r.byID {
+		if m.session.Origin == "" && m.session.HostMethod == entity.HostMethodMITM && m.session.UpdatedAt.After(deadline) {
+			counts[m.session.MitmHandle]++
+		}
+	}
+
+	return counts, nil
+}
+
+// GetByOrigin returns all sessions mirrored from the given peer lobby.
+func (r *MemorySessionRepository) GetByOrigin(origin string) ([]entity.Session, error) {
+	defer r.observe("get_by_origin", time.Now())
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	s := r.filter(func(s *entity.Session) bool { return s.Origin == origin })
+	sort.Slice(s, func(i, j int) bool { return s[i].RoomID < s[j].RoomID })
+
+	return s, nil
+}
+
+// GetByID returns the session with the given ID. Returns nil if session can't be found.
+func (r *MemorySessionRepository) GetByID(id string) (*entity.Session, error) {
+	defer r.observe("get_by_id", time.Now())
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if m, found := r.byID[id]; found {
+		s := copySession(&m.session)
+		return &s, nil
+	}
+
+	return nil, nil
+}
+
+// GetByRoomID returns the session with the given RoomID. Returns nil if session can't be found.
+func (r *MemorySessionRepository) GetByRoomID(id int32) (*entity.Session, error) {
+	defer r.observe("get_by_room_id", time.Now())
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if m, found := r.byRoomID[id]; found {
+		s := copySession(&m.session)
+		return &s, nil
+	}
+
+	return nil, nil
+}
+
+// Create creates a new session. A RoomID of zero gets allocated, the timestamps are set if they are zero.
+func (r *MemorySessionRepository) Create(s *entity.Session) error {
+	defer r.observe("create", time.Now())
+
+	if s.IP == nil {
+		return fmt.Errorf("can't create session %v: %w", s, errors.New("IP can't be null"))
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, found := r.byID[s.ID]; found {
+		return fmt.Errorf("can't create session %v: %w", s, errors.New("duplicate ID"))
+	}
+
+	if s.RoomID == 0 {
+		for r.byRoomID[r.nextRoomID] != nil {
+			r.nextRoomID++
+		}
+		s.RoomID = r.nextRoomID
+	} else if _, found := r.byRoomID[s.RoomID]; found {
+		return fmt.Errorf("can't create session %v: %w", s, errors.New("duplicate RoomID"))
+	}
+	if s.RoomID >= r.nextRoomID {
+		r.nextRoomID = s.RoomID + 1
+	}
+
+	now := time.Now()
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = now
+	}
+	if s.UpdatedAt.IsZero() {
+		s.UpdatedAt = now
+	}
+
+	m := &memorySession{session: copySession(s), index: -1}
+	r.byID[s.ID] = m
+	r.byRoomID[s.RoomID] = m
+	if s.Origin == "" {
+		heap.Push(&r.expiry, m)
+	}
+
+	return nil
+}
+
+// Update updates a session.
+func (r *MemorySessionRepository) Update(s *entity.Session) error {
+	defer r.observe("update", time.Now())
+
+	if s.IP == nil {
+		return fmt.Errorf("can't update session %v: %w", s, errors.New("IP can't be null"))
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	m, found := r.byID[s.ID]
+	if !found {
+		return fmt.Errorf("can't update session %v: %w", s, errors.New("session not found"))
+	}
+	if other, found := r.byRoomID[s.RoomID]; found && other != m {
+		return fmt.Errorf("can't update session %v: %w", s, errors.New("duplicate RoomID"))
+	}
+
+	s.UpdatedAt = time.Now()
+
+	delete(r.byRoomID, m.session.RoomID)
+	m.session = copySession(s)
+	r.byRoomID[s.RoomID] = m
+	r.fixExpiry(m)
+
+	return nil
+}
+
+// Touch updates the UpdatedAt timestamp and the player counts.
+func (r *MemorySessionRepository) Touch(s *entity.Session) error {
+	defer r.observe("touch", time.Now())
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if m, found := r.byID[s.ID]; found {
+		m.session.UpdatedAt = time.Now().Round(0)
+		m.session.PlayerCount = s.PlayerCount
+		m.session.SpectatorCount = s.SpectatorCount
+		m.session.PeakPlayerCount = s.PeakPlayerCount
+		m.session.PeakSpectatorCount = s.PeakSpectatorCount
+		r.fixExpiry(m)
+	}
+
+	return nil
+}
+
+// UpdateConnectivity updates the probe results of a session without touching it.
+func (r *MemorySessionRepository) UpdateConnectivity(s *entity.Session) error {
+	defer r.observe("update_connectivity", time.Now())
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if m, found := r.byID[s.ID]; found {
+		m.session.Connectable = s.Connectable
+		m.session.IsRetroArch = s.IsRetroArch
+		m.session.ProtocolVersion = s.ProtocolVersion
+		m.session.RequiresPassword = s.RequiresPassword
+		m.session.ProbeMismatch = s.ProbeMismatch
+	}
+
+	return nil
+}
+
+// DeleteByRoomID deletes the session with the given RoomID.
+func (r *MemorySessionRepository) DeleteByRoomID(roomID int32) error {
+	defer r.observe("delete_by_room_id", time.Now())
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if m, found := r.byRoomID[roomID]; found {
+		if m.index >= 0 {
+			heap.Remove(&r.expiry, m.index)
+		}
+		r.remove(m)
+	}
+
+	return nil
+}
+
+// PurgeOld deletes all local sessions older than the given timestamp and returns the deleted sessions. With archive
+// set, the history of the deleted sessions is stored in the history repository, see SetHistoryRepository.
+func (r *MemorySessionRepository) PurgeOld(deadline time.Time, archive bool) ([]entity.Session, error) {
+	defer r.observe("purge_old", time.Now())
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	purged := make([]entity.Session, 0)
+	for len(r.expiry) > 0 && r.expiry[0].session.UpdatedAt.Before(deadline) {
+		m := heap.Pop(&r.expiry).(*memorySession)
+		r.remove(m)
+		purged = append(purged, m.session)
+	}
+	sort.SliceStable(purged, func(i, j int) bool { return purged[i].Username < purged[j].Username })
+
+	if archive && r.history != nil && len(purged) > 0 {
+		history := make([]entity.SessionHistory, len(purged))
+		for i := range purged {
+			history[i] = entity.NewSessionHistory(&purged[i])
+		}
+		if err := r.history.Archive(history); err != nil {
+			return nil, fmt.Errorf("can't archive old sessions: %w", err)
+		}
+	}
+
+	return purged, nil
+}
+
+// filter returns copies of all sessions matching the predicate. Needs to be called with the mutex held.
+func (r *MemorySessionRepository) filter(predicate func(s *entity.Session) bool) []entity.Session {
+	s := make([]entity.Session, 0)
+	for _, m := range r.byID {
+		if predicate(&m.session) {
+			s = append(s, m.session)
+		}
+	}
+
+	return s
+}
+
+// fixExpiry restores the expiry order after the session got updated. Needs to be called with the mutex held.
+func (r *MemorySessionRepository) fixExpiry(m *memorySession) {
+	if m.index >= 0 {
+		heap.Fix(&r.expiry, m.index)
+	}
+}
+
+// remove drops the session from the indexes. Needs to be called with the mutex held.
+func (r *MemorySessionRepository) remove(m *memorySession) {
+	delete(r.byID, m.session.ID)
+	delete(r.byRoomID, m.session.RoomID)
+}
+
+func (r *MemorySessionRepository) observe(query string, start time.Time) {
+	if r.queryObserver != nil {
+		r.queryObserver(query, time.Since(start))
+	}
+}
+
+// expiryQueue is a min-heap of sessions ordered by UpdatedAt.
+type expiryQueue []*memorySession
+
+func (q expiryQueue) Len() int { return len(q) }
+
+func (q expiryQueue) Less(i, j int) bool {
+	return q[i].session.UpdatedAt.Before(q[j].session.UpdatedAt)
+}
+
+func (q expiryQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *expiryQueue) Push(x interface{}) {
+	m := x.(*memorySession)
+	m.index = len(*q)
+	*q = append(*q, m)
+}
+
+func (q *expiryQueue) Pop() interface{} {
+	old := *q
+	m := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	m.index = -1
+	return m
+}
+
+// walkBefore calls fn for every session in the subtree of i that is older than the deadline.
+// Subtrees of sessions newer than the deadline are skipped, since their children are even newer.
+func (q expiryQueue) walkBefore(i int, deadline time.Time, fn func(m *memorySession)) {
+	if i >= len(q) || !q[i].session.UpdatedAt.Before(deadline) {
+		return
+	}
+
+	fn(q[i])
+	q.walkBefore(2*i+1, deadline, fn)
+	q.walkBefore(2*i+2, deadline, fn)
+}
+
+// copySession returns a copy of the session that doesn't share memory with the original
+// and has its timestamps stripped of the monotonic clock reading, like a database would.
+func copySession(s *entity.Session) entity.Session {
+	c := *s
+	c.IP = append(net.IP(nil), s.IP...)
+	c.CreatedAt = s.CreatedAt.Round(0)
+	c.UpdatedAt = s.UpdatedAt.Round(0)
+	return c
+}
+
+// isAlive returns true if the session got updated after the deadline. Deadline of zero value matches all sessions.
+func isAlive(s *entity.Session, deadline time.Time) bool {
+	return deadline.IsZero() || s.UpdatedAt.After(deadline)
+}
+
+// matchesFilter implements the filters of SessionRepository.Find.
+func matchesFilter(s *entity.Session, filter *entity.SessionFilter) bool {
+	if filter.CoreName != "" && s.CoreName != filter.CoreName {
+		return false
+	}
+	if filter.GameCRC != "" && s.GameCRC != strings.ToUpper(filter.GameCRC) {
+		return false
+	}
+	if filter.Country != "" && s.Country != strings.ToLower(filter.Country) {
+		return false
+	}
+	if filter.HostMethod != nil && s.HostMethod != *filter.HostMethod {
+		return false
+	}
+	if filter.HasPassword != nil && s.HasPassword != *filter.HasPassword {
+		return false
+	}
+	if filter.Connectable != nil && s.Connectable != *filter.Connectable {
+		return false
+	}
+	if filter.RetroArchVersionPrefix != "" && !strings.HasPrefix(s.RetroArchVersion, filter.RetroArchVersionPrefix) {
+		return false
+	}
+	if filter.Search != "" {
+		search := strings.ToLower(filter.Search)
+		if !strings.Contains(strings.ToLower(s.Username), search) && !strings.Contains(strings.ToLower(s.GameName), search) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sortSessions sorts by the given sort keys, followed by username and RoomID.
+func sortSessions(s []entity.Session, keys []entity.SessionSort) {
+	keys = append(append([]entity.SessionSort(nil), keys...),
+		entity.SessionSort{Field: entity.SortByUsername},
+		entity.SessionSort{Field: entity.SortByRoomID})
+
+	sort.SliceStable(s, func(i, j int) bool {
+		for _, key := range keys {
+			c := sortComparators[key.Field](&s[i], &s[j])
+			if key.Descending {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+func compareInt(a int64, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareTime(a time.Time, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
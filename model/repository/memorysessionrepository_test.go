@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemorySessionRepositoryRoomIDAllocation(t *testing.T) {
+	sessionRepository := NewMemorySessionRepository()
+	session := testSession
+
+	session.RoomID = 2
+	session.CalculateID()
+	err := sessionRepository.Create(&session)
+	require.NoError(t, err, "Can't create session")
+
+	session.Username = "aladin"
+	session.RoomID = 0
+	session.CalculateID()
+	err = sessionRepository.Create(&session)
+	require.NoError(t, err, "Can't create session")
+	assert.Equal(t, int32(3), session.RoomID)
+
+	session.Username = "link"
+	session.RoomID = 3
+	session.CalculateID()
+	err = sessionRepository.Create(&session)
+	require.Error(t, err, "Should not be able to create a duplicate RoomID")
+
+	session.Username = "aladin"
+	session.RoomID = 0
+	session.CalculateID()
+	err = sessionRepository.Create(&session)
+	require.Error(t, err, "Should not be able to create a duplicate ID")
+}
+
+func TestMemorySessionRepositoryExpiryOrder(t *testing.T) {
+	sessionRepository := NewMemorySessionRepository()
+
+	for i := 0; i < 10; i++ {
+		session := testSession
+		session.Username = fmt.Sprintf("user%d", i)
+		session.UpdatedAt = time.Now().Add(-time.Duration(i) * time.Minute)
+		session.CalculateID()
+		err := sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
+	}
+
+	// Touching an old session moves it to the end of the expiry queue
+	old, err := sessionRepository.GetAll(time.Time{})
+	require.NoError(t, err, "Can't get all sessions")
+	for _, s := range old {
+		if s.Username == "user9" {
+			err = sessionRepository.Touch(&s)
+			require.NoError(t, err, "Can't touch session")
+		}
+	}
+
+	deadline := time.Now().Add(-150 * time.Second)
+	oldSessions, err := sessionRepository.GetOld(deadline)
+	require.NoError(t, err, "Can't get old sessions")
+	assert.Equal(t, 6, len(oldSessions))
+
+	purged, err := sessionRepository.PurgeOld(deadline, false)
+	require.NoError(t, err, "Can't purge old sessions")
+	assert.Equal(t, 6, len(purged))
+
+	sessions, err := sessionRepository.GetAll(time.Time{})
+	require.NoError(t, err, "Can't get all sessions")
+	require.Equal(t, 4, len(sessions))
+	assert.Equal(t, []string{"user0", "user1", "user2", "user9"},
+		[]string{sessions[0].Username, sessions[1].Username, sessions[2].Username, sessions[3].Username})
+}
+
+func TestMemorySessionRepositoryConcurrentCreate(t *testing.T) {
+	sessionRepository := NewMemorySessionRepository()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			session := testSession
+			session.Username = fmt.Sprintf("user%d", i)
+			session.RoomID = 0
+			session.CalculateID()
+			assert.NoError(t, sessionRepository.Create(&session))
+		}(i)
+	}
+	wg.Wait()
+
+	sessions, err := sessionRepository.GetAll(time.Time{})
+	require.NoError(t, err, "Can't get all sessions")
+	require.Equal(t, 50, len(sessions))
+
+	roomIDs := make(map[int32]bool)
+	for _, s := range sessions {
+		roomIDs[s.RoomID] = true
+	}
+	assert.Equal(t, 50, len(roomIDs), "RoomIDs are not unique")
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// MemoryWebhookRepository is an in-memory webhook queue for lobbies without a database. Pending deliveries are
+// lost on restart.
+type MemoryWebhookRepository struct {
+	mutex      sync.Mutex
+	deliveries map[uint]entity.WebhookDelivery
+	nextID     uint
+}
+
+// NewMemoryWebhookRepository returns a new, empty MemoryWebhookRepository.
+func NewMemoryWebhookRepository() *MemoryWebhookRepository {
+	return &MemoryWebhookRepository{deliveries: make(map[uint]entity.WebhookDelivery), nextID: 1}
+}
+
+// Enqueue creates a new delivery.
+func (r *MemoryWebhookRepository) Enqueue(d *entity.WebhookDelivery) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	d.ID = r.nextID
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = time.Now()
+	}
+	r.nextID++
+	r.deliveries[d.ID] = *d
+
+	return nil
+}
+
+// GetDue returns up to limit deliveries whose next attempt is due, the oldest first.
+func (r *MemoryWebhookRepository) GetDue(now time.Time, limit int) ([]entity.WebhookDelivery, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	due := []entity.WebhookDelivery{}
+	for _, d := range r.deliveries {
+		if !d.NextAttempt.After(now) {
+			due = append(due, d)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttempt.Equal(due[j].NextAttempt) {
+			return due[i].NextAttempt.Before(due[j].NextAttempt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	return due, nil
+}
+
+// Reschedule stores the attempts and the next attempt of a delivery.
+func (r *MemoryWebhookRepository) Reschedule(d *entity.WebhookDelivery) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if saved, found := r.deliveries[d.ID]; found {
+		saved.Attempts = d.Attempts
+		saved.NextAttempt = d.NextAttempt
+		r.deliveries[d.ID] = saved
+	}
+
+	return nil
+}
+
+// Delete deletes the delivery with the given ID.
+func (r *MemoryWebhookRepository) Delete(id uint) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.deliveries, id)
+
+	return nil
+}
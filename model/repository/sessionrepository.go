@@ -2,6 +2,9 @@ package repository
 
 import (
 	"fmt"
+	"math"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/jinzhu/gorm"
@@ -9,18 +12,41 @@ import (
 	"github.com/libretro/netplay-lobby-server-go/model/entity"
 )
 
+// sortColumns maps the sort fields to their database columns.
+var sortColumns = map[entity.SessionSortField]string{
+	entity.SortByRoomID:      "room_id",
+	entity.SortByUsername:    "username",
+	entity.SortByGameName:    "game_name",
+	entity.SortByCoreName:    "core_name",
+	entity.SortByCountry:     "country",
+	entity.SortByPlayerCount: "player_count",
+	entity.SortByCreatedAt:   "created_at",
+	entity.SortByUpdatedAt:   "updated_at",
+}
+
+// QueryObserver gets called with the name and duration of every repository query.
+type QueryObserver func(query string, duration time.Duration)
+
 // SessionRepository abstracts the database operation for Sessions.
 type SessionRepository struct {
-	db *gorm.DB
+	db            *gorm.DB
+	queryObserver QueryObserver
 }
 
 // NewSessionRepository returns a new SessionRepository.
 func NewSessionRepository(db *gorm.DB) *SessionRepository {
-	return &SessionRepository{db}
+	return &SessionRepository{db, nil}
+}
+
+// SetQueryObserver sets an observer that records the query durations.
+func (r *SessionRepository) SetQueryObserver(observer QueryObserver) {
+	r.queryObserver = observer
 }
 
 // GetAll returns all sessions currently beeing hosted. Deadline is used to filter our old sessions. Deadline of zero value deactivates this filter.
 func (r *SessionRepository) GetAll(deadline time.Time) ([]entity.Session, error) {
+	defer r.observe("get_all", time.Now())
+
 	var s []entity.Session
 	if deadline.IsZero() {
 		if err := r.db.Order("username").Find(&s).Error; err != nil {
@@ -33,8 +59,146 @@ func (r *SessionRepository) GetAll(deadline time.Time) ([]entity.Session, error)
 	return s, nil
 }
 
+// GetOld returns all local sessions older than the given timestamp. Mirrored sessions expire with their origin.
+func (r *SessionRepository) GetOld(deadline time.Time) ([]entity.Session, error) {
+	defer r.observe("get_old", time.Now())
+
+	var s []entity.Session
+	if err := r.db.Where("origin = '' AND updated_at < ?", deadline).Order("username").Find(&s).Error; err != nil {
+		return nil, fmt.Errorf("can't query for old sessions with deadline %s: %w", deadline, err)
+	}
+
+	return s, nil
+}
+
+// Find returns all sessions currently beeing hosted that match the given filter together with the total count of
+// matching sessions before pagination. Deadline is used to filter our old sessions. Deadline of zero value deactivates this filter.
+func (r *SessionRepository) Find(deadline time.Time, filter *entity.SessionFilter) ([]entity.Session, int, error) {
+	defer r.observe("find", time.Now())
+
+	query := r.db.Model(&entity.Session{})
+	if !deadline.IsZero() {
+		query = query.Where("updated_at > ?", deadline)
+	}
+	if filter.CoreName != "" {
+		query = query.Where("core_name = ?", filter.CoreName)
+	}
+	if filter.GameCRC != "" {
+		query = query.Where("game_crc = ?", strings.ToUpper(filter.GameCRC))
+	}
+	if filter.Country != "" {
+		query = query.Where("country = ?", strings.ToLower(filter.Country))
+	}
+	if filter.HostMethod != nil {
+		query = query.Where("host_method = ?", *filter.HostMethod)
+	}
+	if filter.HasPassword != nil {
+		query = query.Where("has_password = ?", *filter.HasPassword)
+	}
+	if filter.Connectable != nil {
+		query = query.Where("connectable = ?", *filter.Connectable)
+	}
+	if filter.RetroArchVersionPrefix != "" {
+		query = query.Where("retro_arch_version LIKE ? ESCAPE '!'", escapeLike(filter.RetroArchVersionPrefix)+"%")
+	}
+	if filter.Search != "" {
+		search := "%" + escapeLike(strings.ToLower(filter.Search)) + "%"
+		query = query.Where("LOWER(username) LIKE ? ESCAPE '!' OR LOWER(game_name) LIKE ? ESCAPE '!'", search, search)
+	}
+
+	var count int
+	if err := query.Count(&count).Error; err != nil {
+		return nil, 0, fmt.Errorf("can't count filtered sessions: %w", err)
+	}
+
+	for _, sort := range filter.Sort {
+		column, found := sortColumns[sort.Field]
+		if !found {
+			return nil, 0, fmt.Errorf("unknown sort field '%s'", sort.Field)
+		}
+		if sort.Descending {
+			column += " DESC"
+		}
+		query = query.Order(column)
+	}
+	query = query.Order("username").Order("room_id")
+
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	} else if filter.Offset > 0 {
+		// An offset needs a limit on sqlite and gets ignored without one on MySQL
+		query = query.Limit(math.MaxInt64)
+	}
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+
+	var s []entity.Session
+	if err := query.Find(&s).Error; err != nil {
+		return nil, 0, fmt.Errorf("can't query for filtered sessions: %w", err)
+	}
+
+	return s, count, nil
+}
+
+// CountByIP returns the amount of local sessions currently beeing hosted from the given IP.
+func (r *SessionRepository) CountByIP(ip net.IP, deadline time.Time) (int, error) {
+	defer r.observe("count_by_ip", time.Now())
+
+	var count int
+	if err := r.db.Model(&entity.Session{}).Where("origin = '' AND ip = ? AND updated_at > ?", []byte(ip.To16()), deadline).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("can't count sessions of IP %s: %w", ip, err)
+	}
+
+	return count, nil
+}
+
+// CountByMitmHandle returns the amount of local relayed sessions currently beeing hosted per relay handle.
+func (r *SessionRepository) CountByMitmHandle(deadline time.Time) (map[string]int, error) {
+	defer r.observe("count_by_mitm_handle", time.Now())
+
+	rows, err := r.db.Model(&entity.Session{}).
+		Select("mitm_handle, COUNT(*)").
+		Where("origin = '' AND host_method = ? AND updated_at > ?", entity.HostMethodMITM, deadline).
+		Group("mitm_handle").
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("can't count sessions per relay: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var handle string
+		var count int
+		if err := rows.Scan(&handle, &count); err != nil {
+			return nil, fmt.Errorf("can't read session count per relay: %w", err)
+		}
+		counts[handle] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("can't read session counts per relay: %w", err)
+	}
+
+	return counts, nil
+}
+
+// GetByOrigin returns all sessions mirrored from the given peer lobby.
+func (r *SessionRepository) GetByOrigin(origin string) ([]entity.Session, error) {
+	defer r.observe("get_by_origin", time.Now())
+
+	var s []entity.Session
+	if err := r.db.Where("origin = ?", origin).Order("room_id").Find(&s).Error; err != nil {
+		return nil, fmt.Errorf("can't query for sessions of origin %s: %w", origin, err)
+	}
+
+	return s, nil
+}
+
 // GetByID returns the session with the given ID. Returns nil if session can't be found.
 func (r *SessionRepository) GetByID(id string) (*entity.Session, error) {
+	defer r.observe("get_by_id", time.Now())
+
 	var s entity.Session
 	if err := r.db.Where("id = ?", id).First(&s).Error; err != nil {
 		if gorm.IsRecordNotFoundError(err) {
@@ -48,6 +212,8 @@ func (r *SessionRepository) GetByID(id string) (*entity.Session, error) {
 
 // GetByRoomID returns the session with the given RoomID. Returns nil if session can't be found.
 func (r *SessionRepository) GetByRoomID(id int32) (*entity.Session, error) {
+	defer r.observe("get_by_room_id", time.Now())
+
 	var s entity.Session
 	if err := r.db.Where("room_id = ?", id).First(&s).Error; err != nil {
 		if gorm.IsRecordNotFoundError(err) {
@@ -61,6 +227,8 @@ func (r *SessionRepository) GetByRoomID(id int32) (*entity.Session, error) {
 
 // Create creates a new session.
 func (r *SessionRepository) Create(s *entity.Session) error {
+	defer r.observe("create", time.Now())
+
 	if err := r.db.Create(s).Error; err != nil {
 		return fmt.Errorf("can't create session %v: %w", s, err)
 	}
@@ -70,6 +238,8 @@ func (r *SessionRepository) Create(s *entity.Session) error {
 
 // Update updates a session.
 func (r *SessionRepository) Update(s *entity.Session) error {
+	defer r.observe("update", time.Now())
+
 	if err := r.db.Model(&s).Save(&s).Error; err != nil {
 		return fmt.Errorf("can't update session %v: %w", s, err)
 	}
@@ -77,24 +247,106 @@ func (r *SessionRepository) Update(s *entity.Session) error {
 	return nil
 }
 
-// Touch updates the UpdatedAt timestamp.
+// Touch updates the UpdatedAt timestamp and the player counts.
 func (r *SessionRepository) Touch(s *entity.Session) error {
+	defer r.observe("touch", time.Now())
+
 	if err := r.db.Model(&entity.Session{}).
 		Where("id = ?", s.ID).
-		Update("updated_at", time.Now()).
-		Update("player_count", s.PlayerCount).
-		Update("spectator_count", s.SpectatorCount).Error; err != nil {
+		UpdateColumns(map[string]interface{}{
+			"updated_at":           time.Now(),
+			"player_count":         s.PlayerCount,
+			"spectator_count":      s.SpectatorCount,
+			"peak_player_count":    s.PeakPlayerCount,
+			"peak_spectator_count": s.PeakSpectatorCount,
+		}).Error; err != nil {
 		return fmt.Errorf("can't touch session with ID %s: %w", s.ID, err)
 	}
 
 	return nil
 }
 
-// PurgeOld purges all sessions older than the given timestamp.
-func (r *SessionRepository) PurgeOld(deadline time.Time) error {
-	if err := r.db.Where("updated_at < ?", deadline).Delete(entity.Session{}).Error; err != nil {
-		return fmt.Errorf("can't delete old sessions: %w", err)
+// UpdateConnectivity updates the probe results of a session without touching it.
+func (r *SessionRepository) UpdateConnectivity(s *entity.Session) error {
+	defer r.observe("update_connectivity", time.Now())
+
+	if err := r.db.Model(&entity.Session{}).
+		Where("id = ?", s.ID).
+		UpdateColumns(map[string]interface{}{
+			"connectable":       s.Connectable,
+			"is_retro_arch":     s.IsRetroArch,
+			"protocol_version":  s.ProtocolVersion,
+			"requires_password": s.RequiresPassword,
+			"probe_mismatch":    s.ProbeMismatch,
+		}).Error; err != nil {
+		return fmt.Errorf("can't update connectivity of session with ID %s: %w", s.ID, err)
+	}
+
+	return nil
+}
+
+// DeleteByRoomID deletes the session with the given RoomID.
+func (r *SessionRepository) DeleteByRoomID(roomID int32) error {
+	defer r.observe("delete_by_room_id", time.Now())
+
+	if err := r.db.Where("room_id = ?", roomID).Delete(entity.Session{}).Error; err != nil {
+		return fmt.Errorf("can't delete session with RoomID %d: %w", roomID, err)
 	}
 
 	return nil
 }
+
+// PurgeOld deletes all local sessions older than the given timestamp and returns the deleted sessions. Sessions
+// touched while purging are kept. With archive set, the history of the deleted sessions is stored in the same transaction.
+func (r *SessionRepository) PurgeOld(deadline time.Time, archive bool) ([]entity.Session, error) {
+	defer r.observe("purge_old", time.Now())
+
+	tx := r.db.Begin()
+	if err := tx.Error; err != nil {
+		return nil, fmt.Errorf("can't begin purge transaction: %w", err)
+	}
+
+	var old []entity.Session
+	if err := tx.Where("origin = '' AND updated_at < ?", deadline).Order("username").Find(&old).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("can't query for old sessions with deadline %s: %w", deadline, err)
+	}
+
+	purged := make([]entity.Session, 0, len(old))
+	for i := range old {
+		result := tx.Where("id = ? AND updated_at < ?", old[i].ID, deadline).Delete(entity.Session{})
+		if result.Error != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("can't delete old session with ID %s: %w", old[i].ID, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		if archive {
+			history := entity.NewSessionHistory(&old[i])
+			if err := tx.Create(&history).Error; err != nil {
+				tx.Rollback()
+				return nil, fmt.Errorf("can't archive session %d: %w", old[i].RoomID, err)
+			}
+		}
+		purged = append(purged, old[i])
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("can't commit purge transaction: %w", err)
+	}
+
+	return purged, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern with '!' as escape character.
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+func (r *SessionRepository) observe(query string, start time.Time) {
+	if r.queryObserver != nil {
+		r.queryObserver(query, time.Since(start))
+	}
+}
@@ -41,7 +41,56 @@ var testSession = entity.Session{
 	ContentHash:         "",
 }
 
-func setupSessionRepository(t *testing.T) *SessionRepository {
+// testedSessionRepository is implemented by every session repository the test suite runs against.
+type testedSessionRepository interface {
+	Create(s *entity.Session) error
+	GetByID(id string) (*entity.Session, error)
+	GetByRoomID(roomID int32) (*entity.Session, error)
+	GetAll(deadline time.Time) ([]entity.Session, error)
+	GetOld(deadline time.Time) ([]entity.Session, error)
+	Find(deadline time.Time, filter *entity.SessionFilter) ([]entity.Session, int, error)
+	CountByIP(ip net.IP, deadline time.Time) (int, error)
+	CountByMitmHandle(deadline time.Time) (map[string]int, error)
+	GetByOrigin(origin string) ([]entity.Session, error)
+	Update(s *entity.Session) error
+	Touch(s *entity.Session) error
+	UpdateConnectivity(s *entity.Session) error
+	DeleteByRoomID(roomID int32) error
+	PurgeOld(deadline time.Time, archive bool) ([]entity.Session, error)
+}
+
+// sessionRepositories are the setups of all session repository implementations.
+var sessionRepositories = []struct {
+	name  string
+	setup func(t *testing.T) testedSessionRepository
+}{
+	{"gorm", setupSessionRepository},
+	{"memory", func(t *testing.T) testedSessionRepository { return NewMemorySessionRepository() }},
+}
+
+// sessionHistoryRepositories are the setups of all session repository implementations together with the history
+// they archive the purged sessions to.
+var sessionHistoryRepositories = []struct {
+	name  string
+	setup func(t *testing.T) (testedSessionRepository, testedHistoryRepository)
+}{
+	{"gorm", func(t *testing.T) (testedSessionRepository, testedHistoryRepository) {
+		db, err := model.GetSqliteDB(":memory:")
+		if err != nil {
+			t.Fatalf("Can't open sqlite3 db: %v", err)
+		}
+		db.AutoMigrate(entity.Session{}, entity.SessionHistory{})
+		return NewSessionRepository(db), NewHistoryRepository(db)
+	}},
+	{"memory", func(t *testing.T) (testedSessionRepository, testedHistoryRepository) {
+		historyRepository := NewMemoryHistoryRepository()
+		sessionRepository := NewMemorySessionRepository()
+		sessionRepository.SetHistoryRepository(historyRepository)
+		return sessionRepository, historyRepository
+	}},
+}
+
+func setupSessionRepository(t *testing.T) testedSessionRepository {
 	db, err := model.GetSqliteDB(":memory:")
 	//db = db.LogMode(true)
 	if err != nil {
@@ -52,240 +101,619 @@ func setupSessionRepository(t *testing.T) *SessionRepository {
 	return NewSessionRepository(db)
 }
 
+// testSessionRepositories runs the test against every session repository implementation.
+func testSessionRepositories(t *testing.T, test func(t *testing.T, sessionRepository testedSessionRepository)) {
+	for _, r := range sessionRepositories {
+		setup := r.setup
+		t.Run(r.name, func(t *testing.T) {
+			test(t, setup(t))
+		})
+	}
+}
+
 func TestSessionRepositoryCreate(t *testing.T) {
-	sessionRepository := setupSessionRepository(t)
-	session := testSession
+	testSessionRepositories(t, func(t *testing.T, sessionRepository testedSessionRepository) {
+		session := testSession
+
+		session.CalculateID()
+		session.CalculateContentHash()
+		err := sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
+	})
+}
 
-	session.CalculateID()
-	session.CalculateContentHash()
-	err := sessionRepository.Create(&session)
-	require.NoError(t, err, "Can't create session")
+func TestSessionRepositoryCreateDuplicateID(t *testing.T) {
+	testSessionRepositories(t, func(t *testing.T, sessionRepository testedSessionRepository) {
+		session := testSession
+		session.CalculateID()
+		session.CalculateContentHash()
+		require.NoError(t, sessionRepository.Create(&session), "Can't create session")
+
+		duplicate := session
+		duplicate.RoomID = 0
+		assert.Error(t, sessionRepository.Create(&duplicate), "Session was created twice")
+	})
 }
 
 func TestSessionRepositoryCreateIPNotNull(t *testing.T) {
-	sessionRepository := setupSessionRepository(t)
-	session := testSession
-
-	session.IP = nil
-	session.CalculateID()
-	session.CalculateContentHash()
-	err := sessionRepository.Create(&session)
-	require.Error(t, err, "Should not be able to create nil value for IP")
+	testSessionRepositories(t, func(t *testing.T, sessionRepository testedSessionRepository) {
+		session := testSession
+
+		session.IP = nil
+		session.CalculateID()
+		session.CalculateContentHash()
+		err := sessionRepository.Create(&session)
+		require.Error(t, err, "Should not be able to create nil value for IP")
+	})
 }
 
 func TestSessionRepositoryGetByID(t *testing.T) {
-	sessionRepository := setupSessionRepository(t)
-	session := testSession
+	testSessionRepositories(t, func(t *testing.T, sessionRepository testedSessionRepository) {
+		session := testSession
 
-	session.CalculateID()
-	session.CalculateContentHash()
-	err := sessionRepository.Create(&session)
-	require.NoError(t, err, "Can't create session")
+		session.CalculateID()
+		session.CalculateContentHash()
+		err := sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
 
-	newSession, err := sessionRepository.GetByID(session.ID)
-	require.NoError(t, err, "Can't get session by ID")
+		newSession, err := sessionRepository.GetByID(session.ID)
+		require.NoError(t, err, "Can't get session by ID")
 
-	require.NotNil(t, newSession)
+		require.NotNil(t, newSession)
 
-	assert.NotEmpty(t, newSession.ID)
-	assert.NotEmpty(t, newSession.ContentHash)
+		assert.NotEmpty(t, newSession.ID)
+		assert.NotEmpty(t, newSession.ContentHash)
 
-	assert.NotEqual(t, session.CreatedAt, newSession.CreatedAt)
-	assert.NotEqual(t, session.UpdatedAt, newSession.UpdatedAt)
+		assert.NotEqual(t, session.CreatedAt, newSession.CreatedAt)
+		assert.NotEqual(t, session.UpdatedAt, newSession.UpdatedAt)
 
-	// Make sure the rest is the same
-	session.CreatedAt = newSession.CreatedAt
-	session.UpdatedAt = newSession.UpdatedAt
-	assert.Equal(t, &session, newSession)
+		// Make sure the rest is the same
+		session.CreatedAt = newSession.CreatedAt
+		session.UpdatedAt = newSession.UpdatedAt
+		assert.Equal(t, &session, newSession)
 
-	noSession, err := sessionRepository.GetByID("should_not_exists")
-	require.NoError(t, err, "Can't get nil session")
-	assert.Nil(t, noSession)
+		noSession, err := sessionRepository.GetByID("should_not_exists")
+		require.NoError(t, err, "Can't get nil session")
+		assert.Nil(t, noSession)
+	})
 }
 
 func TestSessionRepositoryGetByRoomID(t *testing.T) {
-	sessionRepository := setupSessionRepository(t)
-	session := testSession
+	testSessionRepositories(t, func(t *testing.T, sessionRepository testedSessionRepository) {
+		session := testSession
 
-	session.RoomID = 400
-	session.CalculateID()
-	session.CalculateContentHash()
-	err := sessionRepository.Create(&session)
-	require.NoError(t, err, "Can't create session")
+		session.RoomID = 400
+		session.CalculateID()
+		session.CalculateContentHash()
+		err := sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
 
-	newSession, err := sessionRepository.GetByRoomID(session.RoomID)
-	require.NoError(t, err, "Can't get session by RoomID")
+		newSession, err := sessionRepository.GetByRoomID(session.RoomID)
+		require.NoError(t, err, "Can't get session by RoomID")
 
-	require.NotNil(t, newSession)
+		require.NotNil(t, newSession)
 
-	assert.NotEmpty(t, newSession.ID)
-	assert.NotEmpty(t, newSession.ContentHash)
+		assert.NotEmpty(t, newSession.ID)
+		assert.NotEmpty(t, newSession.ContentHash)
 
-	assert.NotEqual(t, session.CreatedAt, newSession.CreatedAt)
-	assert.NotEqual(t, session.UpdatedAt, newSession.UpdatedAt)
+		assert.NotEqual(t, session.CreatedAt, newSession.CreatedAt)
+		assert.NotEqual(t, session.UpdatedAt, newSession.UpdatedAt)
 
-	// Make sure the rest is the same
-	session.CreatedAt = newSession.CreatedAt
-	session.UpdatedAt = newSession.UpdatedAt
-	assert.Equal(t, &session, newSession)
+		// Make sure the rest is the same
+		session.CreatedAt = newSession.CreatedAt
+		session.UpdatedAt = newSession.UpdatedAt
+		assert.Equal(t, &session, newSession)
 
-	noSession, err := sessionRepository.GetByID("should_not_exists")
-	require.NoError(t, err, "Can't get nil session")
-	assert.Nil(t, noSession)
+		noSession, err := sessionRepository.GetByID("should_not_exists")
+		require.NoError(t, err, "Can't get nil session")
+		assert.Nil(t, noSession)
+	})
 }
 
 func TestSessionRepositoryGetAll(t *testing.T) {
-	sessionRepository := setupSessionRepository(t)
-	session := testSession
-
-	session.CalculateID()
-	session.CalculateContentHash()
-	session.RoomID = 0
-	err := sessionRepository.Create(&session)
-	require.NoError(t, err, "Can't create session")
-
-	session.Username = "aladin"
-	session.CalculateID()
-	session.CalculateContentHash()
-	session.RoomID = 0
-	err = sessionRepository.Create(&session)
-	require.NoError(t, err, "Can't create session")
-
-	session.Username = "invalid"
-	session.UpdatedAt = time.Now().Add(-2 * time.Minute)
-	session.CalculateID()
-	session.CalculateContentHash()
-	session.RoomID = 0
-	err = sessionRepository.Create(&session)
-	require.NoError(t, err, "Can't create session")
-
-	deadline := time.Now().Add(-1 * time.Minute)
-	sessions, err := sessionRepository.GetAll(deadline)
-	require.NoError(t, err, "Can't get all sessions with deadline")
-
-	require.NotNil(t, sessions)
-	require.Equal(t, 2, len(sessions), "Query seems to include non valid entries.")
-	assert.Less(t, sessions[0].Username, sessions[1].Username, "Sessions are not ordered by username")
-
-	sessions, err = sessionRepository.GetAll(time.Time{})
-	require.NoError(t, err, "Can't get all sessions without deadline")
-
-	require.NotNil(t, sessions)
-	require.Equal(t, 3, len(sessions), "Query seems to not include invalid entries.")
-	assert.Less(t, sessions[0].Username, sessions[1].Username, "Sessions are not ordered by username")
-	assert.Less(t, sessions[1].Username, sessions[2].Username, "Sessions are not ordered by username")
+	testSessionRepositories(t, func(t *testing.T, sessionRepository testedSessionRepository) {
+		session := testSession
+
+		session.CalculateID()
+		session.CalculateContentHash()
+		session.RoomID = 0
+		err := sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
+
+		session.Username = "aladin"
+		session.CalculateID()
+		session.CalculateContentHash()
+		session.RoomID = 0
+		err = sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
+
+		session.Username = "invalid"
+		session.UpdatedAt = time.Now().Add(-2 * time.Minute)
+		session.CalculateID()
+		session.CalculateContentHash()
+		session.RoomID = 0
+		err = sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
+
+		deadline := time.Now().Add(-1 * time.Minute)
+		sessions, err := sessionRepository.GetAll(deadline)
+		require.NoError(t, err, "Can't get all sessions with deadline")
+
+		require.NotNil(t, sessions)
+		require.Equal(t, 2, len(sessions), "Query seems to include non valid entries.")
+		assert.Less(t, sessions[0].Username, sessions[1].Username, "Sessions are not ordered by username")
+
+		sessions, err = sessionRepository.GetAll(time.Time{})
+		require.NoError(t, err, "Can't get all sessions without deadline")
+
+		require.NotNil(t, sessions)
+		require.Equal(t, 3, len(sessions), "Query seems to not include invalid entries.")
+		assert.Less(t, sessions[0].Username, sessions[1].Username, "Sessions are not ordered by username")
+		assert.Less(t, sessions[1].Username, sessions[2].Username, "Sessions are not ordered by username")
+	})
+}
+
+func TestSessionRepositoryFind(t *testing.T) {
+	testSessionRepositories(t, func(t *testing.T, sessionRepository testedSessionRepository) {
+		session := testSession
+
+		session.CalculateID()
+		session.CalculateContentHash()
+		session.RoomID = 0
+		err := sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
+
+		session.Username = "aladin"
+		session.GameName = "Super Mario 100%"
+		session.CoreName = "bsnes"
+		session.HasPassword = true
+		session.PlayerCount = 4
+		session.CalculateID()
+		session.CalculateContentHash()
+		session.RoomID = 0
+		err = sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
+
+		session.Username = "invalid"
+		session.UpdatedAt = time.Now().Add(-2 * time.Minute)
+		session.CalculateID()
+		session.CalculateContentHash()
+		session.RoomID = 0
+		err = sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
+
+		deadline := time.Now().Add(-1 * time.Minute)
+
+		sessions, count, err := sessionRepository.Find(deadline, &entity.SessionFilter{CoreName: "bsnes"})
+		require.NoError(t, err, "Can't find sessions by core")
+		require.Equal(t, 1, len(sessions))
+		assert.Equal(t, 1, count)
+		assert.Equal(t, "aladin", sessions[0].Username)
+
+		hasPassword := false
+		sessions, _, err = sessionRepository.Find(deadline, &entity.SessionFilter{HasPassword: &hasPassword})
+		require.NoError(t, err, "Can't find sessions by password")
+		require.Equal(t, 1, len(sessions))
+		assert.Equal(t, "zelda", sessions[0].Username)
+
+		sessions, _, err = sessionRepository.Find(deadline, &entity.SessionFilter{Search: "MARIO 100%"})
+		require.NoError(t, err, "Can't find sessions by search")
+		require.Equal(t, 1, len(sessions))
+		assert.Equal(t, "aladin", sessions[0].Username)
+
+		sessions, _, err = sessionRepository.Find(deadline, &entity.SessionFilter{Search: "_"})
+		require.NoError(t, err, "Can't find sessions by search")
+		assert.Equal(t, 0, len(sessions))
+
+		sessions, _, err = sessionRepository.Find(deadline, &entity.SessionFilter{RetroArchVersionPrefix: "1."})
+		require.NoError(t, err, "Can't find sessions by version")
+		assert.Equal(t, 2, len(sessions))
+
+		sessions, count, err = sessionRepository.Find(deadline, &entity.SessionFilter{
+			Sort:  []entity.SessionSort{{Field: entity.SortByPlayerCount, Descending: true}},
+			Limit: 1,
+		})
+		require.NoError(t, err, "Can't find sorted sessions")
+		require.Equal(t, 1, len(sessions))
+		assert.Equal(t, 2, count)
+		assert.Equal(t, "aladin", sessions[0].Username)
+
+		sessions, _, err = sessionRepository.Find(deadline, &entity.SessionFilter{
+			Sort:   []entity.SessionSort{{Field: entity.SortByPlayerCount, Descending: true}},
+			Limit:  1,
+			Offset: 1,
+		})
+		require.NoError(t, err, "Can't find sorted sessions")
+		require.Equal(t, 1, len(sessions))
+		assert.Equal(t, "zelda", sessions[0].Username)
+
+		sessions, count, err = sessionRepository.Find(deadline, &entity.SessionFilter{
+			Sort:   []entity.SessionSort{{Field: entity.SortByPlayerCount, Descending: true}},
+			Offset: 1,
+		})
+		require.NoError(t, err, "Can't find sessions with an offset but no limit")
+		require.Equal(t, 1, len(sessions))
+		assert.Equal(t, 2, count)
+		assert.Equal(t, "zelda", sessions[0].Username)
+
+		sessions, count, err = sessionRepository.Find(time.Time{}, &entity.SessionFilter{})
+		require.NoError(t, err, "Can't find sessions without deadline")
+		assert.Equal(t, 3, len(sessions))
+		assert.Equal(t, 3, count)
+	})
+}
+
+func TestSessionRepositoryCountByIP(t *testing.T) {
+	testSessionRepositories(t, func(t *testing.T, sessionRepository testedSessionRepository) {
+		session := testSession
+
+		session.CalculateID()
+		session.CalculateContentHash()
+		session.RoomID = 0
+		err := sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
+
+		session.Port = 55356
+		session.CalculateID()
+		session.CalculateContentHash()
+		session.RoomID = 0
+		err = sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
+
+		session.Port = 55357
+		session.UpdatedAt = time.Now().Add(-2 * time.Minute)
+		session.CalculateID()
+		session.CalculateContentHash()
+		session.RoomID = 0
+		err = sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
+
+		deadline := time.Now().Add(-1 * time.Minute)
+		count, err := sessionRepository.CountByIP(net.ParseIP("127.0.0.1"), deadline)
+		require.NoError(t, err, "Can't count sessions by IP")
+		assert.Equal(t, 2, count)
+
+		count, err = sessionRepository.CountByIP(net.ParseIP("127.0.0.2"), deadline)
+		require.NoError(t, err, "Can't count sessions by IP")
+		assert.Equal(t, 0, count)
+	})
+}
+
+func TestSessionRepositoryCountByMitmHandle(t *testing.T) {
+	testSessionRepositories(t, func(t *testing.T, sessionRepository testedSessionRepository) {
+		create := func(port uint16, hostMethod entity.HostMethod, handle string, updatedAt time.Time) {
+			session := testSession
+			session.Port = port
+			session.HostMethod = hostMethod
+			session.MitmHandle = handle
+			session.UpdatedAt = updatedAt
+			session.CalculateID()
+			session.CalculateContentHash()
+			session.RoomID = 0
+			require.NoError(t, sessionRepository.Create(&session), "Can't create session")
+		}
+
+		create(55355, entity.HostMethodMITM, "nyc", time.Now())
+		create(55356, entity.HostMethodMITM, "nyc", time.Now())
+		create(55357, entity.HostMethodMITM, "madrid", time.Now())
+		create(55358, entity.HostMethodMITM, "madrid", time.Now().Add(-2*time.Minute))
+		create(55359, entity.HostMethodUPNP, "", time.Now())
+
+		counts, err := sessionRepository.CountByMitmHandle(time.Now().Add(-1 * time.Minute))
+		require.NoError(t, err, "Can't count sessions by relay")
+		assert.Equal(t, map[string]int{"nyc": 2, "madrid": 1}, counts)
+	})
 }
 
 func TestSessionRepositoryUpdate(t *testing.T) {
-	sessionRepository := setupSessionRepository(t)
-	session := testSession
+	testSessionRepositories(t, func(t *testing.T, sessionRepository testedSessionRepository) {
+		session := testSession
 
-	session.CalculateID()
-	session.CalculateContentHash()
-	err := sessionRepository.Create(&session)
-	require.NoError(t, err, "Can't create session")
+		session.CalculateID()
+		session.CalculateContentHash()
+		err := sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
 
-	newIP := "83.12.41.222"
-	session.MitmAddress = newIP
+		newIP := "83.12.41.222"
+		session.MitmAddress = newIP
 
-	session.CalculateContentHash()
-	err = sessionRepository.Update(&session)
-	require.NoError(t, err, "Can't update session")
+		session.CalculateContentHash()
+		err = sessionRepository.Update(&session)
+		require.NoError(t, err, "Can't update session")
 
-	newSession, err := sessionRepository.GetByID(session.ID)
-	require.NoError(t, err, "Can't get session by ID")
+		newSession, err := sessionRepository.GetByID(session.ID)
+		require.NoError(t, err, "Can't get session by ID")
 
-	require.NotNil(t, newSession)
-	assert.Equal(t, newSession.MitmAddress, newIP)
+		require.NotNil(t, newSession)
+		assert.Equal(t, newSession.MitmAddress, newIP)
+	})
 }
 
 func TestSessionRepositoryTouch(t *testing.T) {
-	sessionRepository := setupSessionRepository(t)
-	session := testSession
+	testSessionRepositories(t, func(t *testing.T, sessionRepository testedSessionRepository) {
+		session := testSession
 
-	session.CalculateID()
-	session.CalculateContentHash()
-	err := sessionRepository.Create(&session)
-	require.NoError(t, err, "Can't create session")
+		session.CalculateID()
+		session.CalculateContentHash()
+		err := sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
 
-	oldSession, err := sessionRepository.GetByID(session.ID)
-	require.NoError(t, err, "Can't get session by ID")
+		oldSession, err := sessionRepository.GetByID(session.ID)
+		require.NoError(t, err, "Can't get session by ID")
 
-	oldTimestamp := oldSession.UpdatedAt
+		oldTimestamp := oldSession.UpdatedAt
 
-	err = sessionRepository.Touch(oldSession)
-	require.NoError(t, err, "Can't touch session")
+		err = sessionRepository.Touch(oldSession)
+		require.NoError(t, err, "Can't touch session")
 
-	newSession, err := sessionRepository.GetByID(session.ID)
-	require.NoError(t, err, "Can't get session by ID")
+		newSession, err := sessionRepository.GetByID(session.ID)
+		require.NoError(t, err, "Can't get session by ID")
 
-	require.NotNil(t, newSession)
-	assert.False(t, newSession.UpdatedAt.Equal(oldTimestamp), "New timestamp did not change after touch")
-	assert.True(t, newSession.UpdatedAt.After(oldTimestamp), "New timestamp is not older after touch")
+		require.NotNil(t, newSession)
+		assert.False(t, newSession.UpdatedAt.Equal(oldTimestamp), "New timestamp did not change after touch")
+		assert.True(t, newSession.UpdatedAt.After(oldTimestamp), "New timestamp is not older after touch")
 
-	assert.Equal(t, oldSession.ContentHash, newSession.ContentHash)
+		assert.Equal(t, oldSession.ContentHash, newSession.ContentHash)
+	})
 }
 
 func TestSessionRepositoryTouchPlayerCount(t *testing.T) {
-	sessionRepository := setupSessionRepository(t)
-	session1 := testSession
-	session2 := testSession
-	session2.PlayerCount = 3
-
-	session1.CalculateID()
-	session1.CalculateContentHash()
-	err := sessionRepository.Create(&session1)
-	require.NoError(t, err, "Can't create session")
+	testSessionRepositories(t, func(t *testing.T, sessionRepository testedSessionRepository) {
+		session1 := testSession
+		session2 := testSession
+		session2.PlayerCount = 3
+		session2.PeakPlayerCount = 3
+
+		session1.CalculateID()
+		session1.CalculateContentHash()
+		err := sessionRepository.Create(&session1)
+		require.NoError(t, err, "Can't create session")
+
+		prevSession, err := sessionRepository.GetByID(session1.ID)
+		require.NoError(t, err, "Can't get session by ID")
+
+		session2.CalculateID()
+		session2.CalculateContentHash()
+		err = sessionRepository.Touch(&session2)
+		require.NoError(t, err, "Can't touch session")
+
+		newSession, err := sessionRepository.GetByID(session1.ID)
+		require.NoError(t, err, "Can't get session by ID")
+
+		require.NotNil(t, newSession)
+
+		assert.Equal(t, prevSession.ContentHash, newSession.ContentHash)
+		assert.NotEqual(t, prevSession.PlayerCount, newSession.PlayerCount)
+		assert.Equal(t, int16(3), newSession.PeakPlayerCount)
+	})
+}
 
-	prevSession, err := sessionRepository.GetByID(session1.ID)
-	require.NoError(t, err, "Can't get session by ID")
+func TestSessionRepositoryTouchKeepsContent(t *testing.T) {
+	testSessionRepositories(t, func(t *testing.T, sessionRepository testedSessionRepository) {
+		session := testSession
+		session.CalculateID()
+		session.CalculateContentHash()
+		require.NoError(t, sessionRepository.Create(&session), "Can't create session")
+
+		touch := session
+		touch.GameName = "othergame"
+		touch.Connectable = false
+		touch.PlayerCount = 4
+		touch.SpectatorCount = 2
+		touch.PeakPlayerCount = 5
+		touch.PeakSpectatorCount = 3
+		require.NoError(t, sessionRepository.Touch(&touch), "Can't touch session")
+
+		newSession, err := sessionRepository.GetByID(session.ID)
+		require.NoError(t, err, "Can't get session by ID")
+		require.NotNil(t, newSession)
+		assert.Equal(t, int16(4), newSession.PlayerCount)
+		assert.Equal(t, int16(2), newSession.SpectatorCount)
+		assert.Equal(t, int16(5), newSession.PeakPlayerCount)
+		assert.Equal(t, int16(3), newSession.PeakSpectatorCount)
+		assert.Equal(t, "supergame", newSession.GameName, "Touch changed the content")
+		assert.True(t, newSession.Connectable, "Touch changed the connectivity")
+
+		// Touching an unknown session does nothing
+		touch.ID = "unknown"
+		require.NoError(t, sessionRepository.Touch(&touch), "Can't touch unknown session")
+		sessions, err := sessionRepository.GetAll(time.Time{})
+		require.NoError(t, err, "Can't get all sessions")
+		assert.Equal(t, 1, len(sessions))
+	})
+}
 
-	session2.CalculateID()
-	session2.CalculateContentHash()
-	err = sessionRepository.Touch(&session2)
-	require.NoError(t, err, "Can't touch session")
+func TestSessionRepositoryUpdateConnectivity(t *testing.T) {
+	testSessionRepositories(t, func(t *testing.T, sessionRepository testedSessionRepository) {
+		session := testSession
+		session.Connectable = true
+		session.IsRetroArch = true
+
+		session.CalculateID()
+		session.CalculateContentHash()
+		err := sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
+
+		oldSession, err := sessionRepository.GetByID(session.ID)
+		require.NoError(t, err, "Can't get session by ID")
+
+		oldSession.Connectable = false
+		oldSession.IsRetroArch = false
+		oldSession.ProtocolVersion = 6
+		oldSession.RequiresPassword = true
+		oldSession.ProbeMismatch = "password"
+		err = sessionRepository.UpdateConnectivity(oldSession)
+		require.NoError(t, err, "Can't update connectivity")
+
+		newSession, err := sessionRepository.GetByID(session.ID)
+		require.NoError(t, err, "Can't get session by ID")
+
+		require.NotNil(t, newSession)
+		assert.False(t, newSession.Connectable)
+		assert.False(t, newSession.IsRetroArch)
+		assert.Equal(t, uint32(6), newSession.ProtocolVersion)
+		assert.True(t, newSession.RequiresPassword)
+		assert.Equal(t, "password", newSession.ProbeMismatch)
+		assert.True(t, newSession.UpdatedAt.Equal(oldSession.UpdatedAt), "Timestamp changed after connectivity update")
+	})
+}
 
-	newSession, err := sessionRepository.GetByID(session1.ID)
-	require.NoError(t, err, "Can't get session by ID")
+func TestSessionRepositoryPurgeOld(t *testing.T) {
+	testSessionRepositories(t, func(t *testing.T, sessionRepository testedSessionRepository) {
+		session := testSession
+
+		session.CalculateID()
+		session.CalculateContentHash()
+		session.RoomID = 0
+		err := sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
+
+		session.Username = "aladin"
+		session.CalculateID()
+		session.CalculateContentHash()
+		session.RoomID = 0
+		err = sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
+
+		session.Username = "invalid"
+		session.UpdatedAt = time.Now().Add(-2 * time.Minute)
+		session.CalculateID()
+		session.CalculateContentHash()
+		session.RoomID = 0
+		err = sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
+
+		deadline := time.Now().Add(-1 * time.Minute)
+		oldSessions, err := sessionRepository.GetOld(deadline)
+		require.NoError(t, err, "Can't get old sessions")
+		require.Equal(t, 1, len(oldSessions))
+		assert.Equal(t, "invalid", oldSessions[0].Username)
+
+		purged, err := sessionRepository.PurgeOld(deadline, false)
+		require.NoError(t, err, "Can't purge old sessions")
+		require.Equal(t, 1, len(purged))
+		assert.Equal(t, "invalid", purged[0].Username)
+
+		sessions, err := sessionRepository.GetAll(time.Time{})
+		require.NoError(t, err, "Can't get all sessions")
+
+		require.NotNil(t, sessions)
+		require.Equal(t, len(sessions), 2, "Query seems to include non valid entries.")
+	})
+}
 
-	require.NotNil(t, newSession)
+func TestSessionRepositoryPurgeOldArchive(t *testing.T) {
+	for _, r := range sessionHistoryRepositories {
+		setup := r.setup
+		t.Run(r.name, func(t *testing.T) {
+			sessionRepository, historyRepository := setup(t)
+
+			session := testSession
+			session.PeakPlayerCount = 3
+			session.CreatedAt = time.Now().Add(-time.Hour)
+			session.UpdatedAt = time.Now().Add(-2 * time.Minute)
+			session.CalculateID()
+			session.CalculateContentHash()
+			require.NoError(t, sessionRepository.Create(&session), "Can't create session")
+
+			session.Username = "aladin"
+			session.RoomID = 0
+			session.UpdatedAt = time.Now()
+			session.CalculateID()
+			session.CalculateContentHash()
+			require.NoError(t, sessionRepository.Create(&session), "Can't create session")
+
+			purged, err := sessionRepository.PurgeOld(time.Now().Add(-time.Minute), true)
+			require.NoError(t, err, "Can't purge old sessions")
+			require.Equal(t, 1, len(purged))
+			assert.Equal(t, "zelda", purged[0].Username)
+
+			history, err := historyRepository.GetBetween(time.Now().Add(-2*time.Hour), time.Now())
+			require.NoError(t, err, "Can't get history")
+			require.Equal(t, 1, len(history))
+			assert.Equal(t, purged[0].RoomID, history[0].RoomID)
+			assert.Equal(t, int16(3), history[0].PeakPlayers)
+
+			// Purging again neither deletes nor archives anything
+			purged, err = sessionRepository.PurgeOld(time.Now().Add(-time.Minute), true)
+			require.NoError(t, err, "Can't purge old sessions")
+			assert.Empty(t, purged)
+			history, err = historyRepository.GetBetween(time.Now().Add(-2*time.Hour), time.Now())
+			require.NoError(t, err, "Can't get history")
+			assert.Equal(t, 1, len(history))
+		})
+	}
+}
 
-	assert.Equal(t, prevSession.ContentHash, newSession.ContentHash)
-	assert.NotEqual(t, prevSession.PlayerCount, newSession.PlayerCount)
+func TestSessionRepositoryOrigin(t *testing.T) {
+	testSessionRepositories(t, func(t *testing.T, sessionRepository testedSessionRepository) {
+		local := testSession
+		local.UpdatedAt = time.Now().Add(-2 * time.Minute)
+		local.CalculateID()
+		local.CalculateContentHash()
+		require.NoError(t, sessionRepository.Create(&local), "Can't create session")
+
+		mirrored := testSession
+		mirrored.Origin = "eu"
+		mirrored.UpdatedAt = time.Now().Add(-2 * time.Minute)
+		mirrored.CalculateOriginID(1)
+		mirrored.CalculateContentHash()
+		require.NoError(t, sessionRepository.Create(&mirrored), "Can't create mirrored session")
+		assert.NotEqual(t, local.ID, mirrored.ID)
+		assert.NotEqual(t, local.RoomID, mirrored.RoomID)
+
+		sessions, err := sessionRepository.GetByOrigin("eu")
+		require.NoError(t, err, "Can't get sessions by origin")
+		require.Equal(t, 1, len(sessions))
+		assert.Equal(t, mirrored.ID, sessions[0].ID)
+		assert.Equal(t, "eu", sessions[0].Origin)
+
+		sessions, err = sessionRepository.GetByOrigin("us")
+		require.NoError(t, err, "Can't get sessions by origin")
+		assert.Equal(t, 0, len(sessions))
+
+		// Mirrored sessions neither expire locally nor count for the quotas
+		deadline := time.Now().Add(-1 * time.Minute)
+		oldSessions, err := sessionRepository.GetOld(deadline)
+		require.NoError(t, err, "Can't get old sessions")
+		require.Equal(t, 1, len(oldSessions))
+		assert.Equal(t, local.ID, oldSessions[0].ID)
+
+		count, err := sessionRepository.CountByIP(testSession.IP, time.Now().Add(-3*time.Minute))
+		require.NoError(t, err, "Can't count sessions by IP")
+		assert.Equal(t, 1, count)
+
+		_, err = sessionRepository.PurgeOld(deadline, false)
+		require.NoError(t, err, "Can't purge old sessions")
+		sessions, err = sessionRepository.GetAll(time.Time{})
+		require.NoError(t, err, "Can't get all sessions")
+		require.Equal(t, 1, len(sessions))
+		assert.Equal(t, "eu", sessions[0].Origin)
+
+		mirrored.PlayerCount = 4
+		require.NoError(t, sessionRepository.Update(&mirrored), "Can't update mirrored session")
+		require.NoError(t, sessionRepository.DeleteByRoomID(mirrored.RoomID), "Can't delete mirrored session")
+		sessions, err = sessionRepository.GetByOrigin("eu")
+		require.NoError(t, err, "Can't get sessions by origin")
+		assert.Equal(t, 0, len(sessions))
+	})
 }
 
-func TestSessionRepositoryPurgeOld(t *testing.T) {
-	sessionRepository := setupSessionRepository(t)
-	session := testSession
-
-	session.CalculateID()
-	session.CalculateContentHash()
-	session.RoomID = 0
-	err := sessionRepository.Create(&session)
-	require.NoError(t, err, "Can't create session")
-
-	session.Username = "aladin"
-	session.CalculateID()
-	session.CalculateContentHash()
-	session.RoomID = 0
-	err = sessionRepository.Create(&session)
-	require.NoError(t, err, "Can't create session")
-
-	session.Username = "invalid"
-	session.UpdatedAt = time.Now().Add(-2 * time.Minute)
-	session.CalculateID()
-	session.CalculateContentHash()
-	session.RoomID = 0
-	err = sessionRepository.Create(&session)
-	require.NoError(t, err, "Can't create session")
-
-	deadline := time.Now().Add(-1 * time.Minute)
-	err = sessionRepository.PurgeOld(deadline)
-	require.NoError(t, err, "Can't purge old sessions")
-
-	sessions, err := sessionRepository.GetAll(time.Time{})
-	require.NoError(t, err, "Can't get all sessions")
-
-	require.NotNil(t, sessions)
-	require.Equal(t, len(sessions), 2, "Query seems to include non valid entries.")
+func TestSessionRepositoryDeleteByRoomID(t *testing.T) {
+	testSessionRepositories(t, func(t *testing.T, sessionRepository testedSessionRepository) {
+		session := testSession
+
+		session.RoomID = 400
+		session.CalculateID()
+		session.CalculateContentHash()
+		err := sessionRepository.Create(&session)
+		require.NoError(t, err, "Can't create session")
+
+		err = sessionRepository.DeleteByRoomID(session.RoomID)
+		require.NoError(t, err, "Can't delete session by RoomID")
+
+		noSession, err := sessionRepository.GetByRoomID(session.RoomID)
+		require.NoError(t, err, "Can't get nil session")
+		assert.Nil(t, noSession)
+	})
 }
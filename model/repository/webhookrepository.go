@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// WebhookRepository abstracts the database operation for WebhookDeliveries. The queue survives restarts and is
+// shared by all replicas using the same database.
+type WebhookRepository struct {
+	db *gorm.DB
+}
+
+// NewWebhookRepository returns a new WebhookRepository.
+func NewWebhookRepository(db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{db}
+}
+
+// Enqueue creates a new delivery.
+func (r *WebhookRepository) Enqueue(d *entity.WebhookDelivery) error {
+	if err := r.db.Create(d).Error; err != nil {
+		return fmt.Errorf("can't enqueue webhook delivery for %s: %w", d.Hook, err)
+	}
+
+	return nil
+}
+
+// GetDue returns up to limit deliveries whose next attempt is due, the oldest first.
+func (r *WebhookRepository) GetDue(now time.Time, limit int) ([]entity.WebhookDelivery, error) {
+	var d []entity.WebhookDelivery
+	if err := r.db.Where("next_attempt <= ?", now).Order("next_attempt, id").Limit(limit).Find(&d).Error; err != nil {
+		return nil, fmt.Errorf("can't query for due webhook deliveries: %w", err)
+	}
+
+	return d, nil
+}
+
+// Reschedule stores the attempts and the next attempt of a delivery.
+func (r *WebhookRepository) Reschedule(d *entity.WebhookDelivery) error {
+	err := r.db.Model(&entity.WebhookDelivery{}).
+		Where("id = ?", d.ID).
+		Updates(map[string]interface{}{"attempts": d.Attempts, "next_attempt": d.NextAttempt}).Error
+	if err != nil {
+		return fmt.Errorf("can't reschedule webhook delivery with ID %d: %w", d.ID, err)
+	}
+
+	return nil
+}
+
+// Delete deletes the delivery with the given ID.
+func (r *WebhookRepository) Delete(id uint) error {
+	if err := r.db.Where("id = ?", id).Delete(entity.WebhookDelivery{}).Error; err != nil {
+		return fmt.Errorf("can't delete webhook delivery with ID %d: %w", id, err)
+	}
+
+	return nil
+}
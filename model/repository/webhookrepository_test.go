@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/libretro/netplay-lobby-server-go/model"
+	"github.com/libretro/netplay-lobby-server-go/model/entity"
+)
+
+// testedWebhookRepository is implemented by every webhook repository the test suite runs against.
+type testedWebhookRepository interface {
+	Enqueue(d *entity.WebhookDelivery) error
+	GetDue(now time.Time, limit int) ([]entity.WebhookDelivery, error)
+	Reschedule(d *entity.WebhookDelivery) error
+	Delete(id uint) error
+}
+
+// webhookRepositories are the setups of all webhook repository implementations.
+var webhookRepositories = []struct {
+	name  string
+	setup func(t *testing.T) testedWebhookRepository
+}{
+	{"gorm", setupWebhookRepository},
+	{"memory", func(t *testing.T) testedWebhookRepository { return NewMemoryWebhookRepository() }},
+}
+
+func setupWebhookRepository(t *testing.T) testedWebhookRepository {
+	db, err := model.GetSqliteDB(":memory:")
+	if err != nil {
+		t.Fatalf("Can't open sqlite3 db: %v", err)
+	}
+	db.AutoMigrate(entity.WebhookDelivery{})
+
+	return NewWebhookRepository(db)
+}
+
+// testWebhookRepositories runs the test against every webhook repository implementation.
+func testWebhookRepositories(t *testing.T, test func(t *testing.T, webhookRepository testedWebhookRepository)) {
+	for _, r := range webhookRepositories {
+		setup := r.setup
+		t.Run(r.name, func(t *testing.T) {
+			test(t, setup(t))
+		})
+	}
+}
+
+func TestWebhookRepositoryGetDue(t *testing.T) {
+	testWebhookRepositories(t, func(t *testing.T, webhookRepository testedWebhookRepository) {
+		now := time.Now()
+
+		later := entity.WebhookDelivery{Hook: "discord", Event: "created", Payload: "{}", NextAttempt: now.Add(time.Minute)}
+		require.NoError(t, webhookRepository.Enqueue(&later), "Can't enqueue delivery")
+		second := entity.WebhookDelivery{Hook: "discord", Event: "purged", Payload: "{}", NextAttempt: now.Add(-time.Second)}
+		require.NoError(t, webhookRepository.Enqueue(&second), "Can't enqueue delivery")
+		first := entity.WebhookDelivery{Hook: "tournament", Event: "created", Payload: "{}", NextAttempt: now.Add(-time.Minute)}
+		require.NoError(t, webhookRepository.Enqueue(&first), "Can't enqueue delivery")
+		assert.NotZero(t, first.ID)
+
+		due, err := webhookRepository.GetDue(now, 10)
+		require.NoError(t, err, "Can't get due deliveries")
+		require.Equal(t, 2, len(due))
+		assert.Equal(t, first.ID, due[0].ID)
+		assert.Equal(t, "tournament", due[0].Hook)
+		assert.Equal(t, second.ID, due[1].ID)
+
+		due, err = webhookRepository.GetDue(now, 1)
+		require.NoError(t, err, "Can't get due deliveries")
+		require.Equal(t, 1, len(due))
+		assert.Equal(t, first.ID, due[0].ID)
+	})
+}
+
+func TestWebhookRepositoryRescheduleAndDelete(t *testing.T) {
+	testWebhookRepositories(t, func(t *testing.T, webhookRepository testedWebhookRepository) {
+		now := time.Now()
+
+		delivery := entity.WebhookDelivery{Hook: "discord", Event: "created", Payload: "{}", NextAttempt: now}
+		require.NoError(t, webhookRepository.Enqueue(&delivery), "Can't enqueue delivery")
+
+		delivery.Attempts = 1
+		delivery.NextAttempt = now.Add(time.Minute)
+		require.NoError(t, webhookRepository.Reschedule(&delivery), "Can't reschedule delivery")
+
+		due, err := webhookRepository.GetDue(now, 10)
+		require.NoError(t, err, "Can't get due deliveries")
+		assert.Equal(t, 0, len(due), "Rescheduled delivery is still due")
+
+		due, err = webhookRepository.GetDue(now.Add(time.Minute), 10)
+		require.NoError(t, err, "Can't get due deliveries")
+		require.Equal(t, 1, len(due))
+		assert.Equal(t, 1, due[0].Attempts)
+
+		require.NoError(t, webhookRepository.Delete(delivery.ID), "Can't delete delivery")
+		due, err = webhookRepository.GetDue(now.Add(time.Hour), 10)
+		require.NoError(t, err, "Can't get due deliveries")
+		assert.Equal(t, 0, len(due))
+	})
+}